@@ -26,6 +26,20 @@ func NewAPIEndpoint(region *Region, key APIKey) (*APIEndpoint, error) {
 	}, nil
 }
 
+// ForRegion returns an APIEndpoint for another Region, with the same
+// APIKey. Both endpoints share the same rate limit, as Riot Games
+// limits the requests per key.
+func (a *APIEndpoint) ForRegion(region *Region) (*APIEndpoint, error) {
+	if region.IsDynamic() == false {
+		return nil, fmt.Errorf("APIEndpoint only works with dynamic regions")
+	}
+	return &APIEndpoint{
+		g:      a.g,
+		region: region,
+		key:    a.key,
+	}, nil
+}
+
 // formats an url for that endpoint
 func (a *APIEndpoint) formatURL(url string, options map[string]string) string {
 	res := fmt.Sprintf("https://%s/api/lol/%s%s?api_key=%s", a.region.url, a.region.code, url, a.key)
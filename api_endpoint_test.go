@@ -0,0 +1,22 @@
+package lol
+
+import . "gopkg.in/check.v1"
+
+type APIEndpointSuite struct{}
+
+var _ = Suite(&APIEndpointSuite{})
+
+func (s *APIEndpointSuite) TestForRegionSharesRateLimit(c *C) {
+	euw, err := NewRegionByCode("euw")
+	c.Assert(err, IsNil)
+	na, err := NewRegionByCode("na")
+	c.Assert(err, IsNil)
+
+	api, err := NewAPIEndpoint(euw, "some-key")
+	c.Assert(err, IsNil)
+	other, err := api.ForRegion(na)
+	c.Assert(err, IsNil)
+	c.Check(other.region, Equals, na)
+	c.Check(other.key, Equals, api.key)
+	c.Check(other.g == api.g, Equals, true)
+}
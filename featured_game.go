@@ -1,6 +1,9 @@
 package lol
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+)
 
 // FeaturedGameInfo is an information about a featured game
 type FeaturedGameInfo struct {
@@ -58,3 +61,18 @@ func (a *APIEndpoint) GetFeaturedGames() (*FeaturedGames, error) {
 	return res, nil
 
 }
+
+// CurrentGameInfo converts a FeaturedGameInfo to a CurrentGameInfo,
+// so featured games can be handled like any game a Summoner is
+// currently playing. Masteries and Runes are not reported for
+// featured games, and are therefore left empty.
+func (g FeaturedGameInfo) CurrentGameInfo() (CurrentGameInfo, error) {
+	res := CurrentGameInfo{}
+	// both structures share the same JSON representation
+	data, err := json.Marshal(g)
+	if err != nil {
+		return res, err
+	}
+	err = json.Unmarshal(data, &res)
+	return res, err
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/atuleu/go-lol"
+	"github.com/atuleu/go-lol/x-go-lol"
+)
+
+type BookmarkCommand struct {
+	Remove bool `long:"remove" description:"Removes the bookmark instead of adding it"`
+}
+
+func (x *BookmarkCommand) Execute(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("bookmark needs the GameID of a replay")
+	}
+
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid GameID %s: %s", args[0], err)
+	}
+
+	i, err := NewInteractor(options)
+	if err != nil {
+		return err
+	}
+	gid := lol.GameID(id)
+
+	switch {
+	case len(args) == 1 && x.Remove == false:
+		loader, err := i.manager.Get(i.region, gid)
+		if err != nil {
+			return err
+		}
+		r, err := xlol.LoadReplay(loader)
+		if err != nil {
+			return err
+		}
+		for _, b := range r.Bookmarks {
+			fmt.Printf("%s at %s (chunk %d, keyframe %d)\n", b.Name, b.GameTime.Duration(), b.Chunk, b.KeyFrame)
+		}
+		return nil
+	case len(args) == 2 && x.Remove == true:
+		return xlol.UpdateReplay(i.manager, i.region, gid, func(r *xlol.Replay) error {
+			if r.RemoveBookmark(args[1]) == false {
+				return fmt.Errorf("Replay %s/%d has no bookmark %s", i.region.PlatformID(), id, args[1])
+			}
+			return nil
+		})
+	case len(args) == 3 && x.Remove == false:
+		t, err := time.ParseDuration(args[2])
+		if err != nil {
+			return fmt.Errorf("Invalid game time %s: %s", args[2], err)
+		}
+		return xlol.UpdateReplay(i.manager, i.region, gid, func(r *xlol.Replay) error {
+			b, err := r.AddBookmark(args[1], t)
+			if err != nil {
+				return err
+			}
+			log.Printf("Bookmarked %s at chunk %d, keyframe %d", b.Name, b.Chunk, b.KeyFrame)
+			return nil
+		})
+	}
+
+	return fmt.Errorf("bookmark takes a GameID, and a name and a game time (e.g. 12m30s) to add a bookmark, or a name with --remove")
+}
+
+func init() {
+	parser.AddCommand("bookmark",
+		"Bookmarks moments of a replay",
+		"Bookmarks a game time of a recorded replay under a name, so it can be replayed from there. Without name, it lists the bookmarks of the replay",
+		&BookmarkCommand{})
+}
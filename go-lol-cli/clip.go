@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/atuleu/go-lol/x-go-lol"
+)
+
+type ClipCommand struct {
+	From   string `long:"from" description:"Game time the clip starts at, e.g. 18m" default:"0s"`
+	To     string `long:"to" description:"Game time the clip ends at, e.g. 24m" required:"true"`
+	Output string `long:"output" short:"o" description:"File to save the clip to, its extension selects the format" required:"true"`
+}
+
+func (x *ClipCommand) Execute(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("clip requires a game, as <platformID>/<gameID>")
+	}
+	region, id, err := parseGameKey(args[0])
+	if err != nil {
+		return err
+	}
+	from, err := time.ParseDuration(x.From)
+	if err != nil {
+		return fmt.Errorf("Invalid game time %s: %s", x.From, err)
+	}
+	to, err := time.ParseDuration(x.To)
+	if err != nil {
+		return fmt.Errorf("Invalid game time %s: %s", x.To, err)
+	}
+
+	if _, err := os.Stat(x.Output); err == nil {
+		return fmt.Errorf("%s already exists", x.Output)
+	}
+
+	i, err := NewInteractor(options)
+	if err != nil {
+		return err
+	}
+
+	loader, err := i.manager.Get(region, id)
+	if err != nil {
+		return err
+	}
+	replay, err := xlol.LoadReplayWithData(loader)
+	if err != nil {
+		return err
+	}
+	clip, err := replay.Clip(from, to)
+	if err != nil {
+		return err
+	}
+
+	out, err := xlol.OpenReplayFile(x.Output)
+	if err != nil {
+		return err
+	}
+	err = clip.SaveWithData(out)
+	if errClose := closeFormatter(out); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(x.Output)
+		return fmt.Errorf("Could not save clip of game %s/%d: %s", region.PlatformID(), id, err)
+	}
+
+	log.Printf("Saved %s of game %s/%d to %s as game %d", clip.GameDuration(), region.PlatformID(), id, x.Output, clip.MetaData.GameKey.ID)
+	return nil
+}
+
+func init() {
+	parser.AddCommand("clip",
+		"Save a part of a replay to a file",
+		"Saves the part of a recorded replay, given as <platformID>/<gameID>, between two game times to a single file that can be shared and imported like any exported replay. The clip starts at the keyframe preceding its start",
+		&ClipCommand{})
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/atuleu/go-lol"
+	"launchpad.net/go-xdg"
+)
+
+// Config is the content of the go-lol-cli configuration file. Any
+// value that is not set is left to the command line default, and any
+// value given on the command line overrides the configuration file.
+//
+// An example of configuration file is:
+//
+//	region = "euw"
+//	replay-dir = "/srv/go-lol/replays"
+//
+//	[summoners]
+//	euw = [ "SomeSummoner", "Another Summoner" ]
+//	na = [ "NASummoner" ]
+//
+//	[watch]
+//	interval = "2m30s"
+//	max-downloads = 3
+//
+//	[retention]
+//	older-than = "168h"
+//	limit = 20
+//
+//	[replay]
+//	address = "localhost:8088"
+//	time-factor = 4
+//
+//	[s3]
+//	endpoint = "http://localhost:9000"
+//	bucket = "replays"
+//	prefix = "go-lol"
+type Config struct {
+	// Region is the code of the default region
+	Region string `toml:"region"`
+	// ReplayDir is the directory storing the replays
+	ReplayDir string `toml:"replay-dir"`
+	// Summoners are the Summoners watched by watch-summoner, by
+	// region code
+	Summoners map[string][]string `toml:"summoners"`
+
+	Watch struct {
+		// Interval between two checks of summoners in-game status
+		Interval string `toml:"interval"`
+		// MaxDownloads is the maximal number of games recorded in
+		// parallel
+		MaxDownloads int `toml:"max-downloads"`
+	} `toml:"watch"`
+
+	Retention struct {
+		// OlderThan is the maximal age of replays to keep
+		OlderThan string `toml:"older-than"`
+		// Limit is the maximal number of replays to keep
+		Limit *int `toml:"limit"`
+	} `toml:"retention"`
+
+	Replay struct {
+		// Address the replay server listens to
+		Address string `toml:"address"`
+		// TimeFactor is the time multiplication factor when
+		// streaming a replay
+		TimeFactor uint `toml:"time-factor"`
+	} `toml:"replay"`
+
+	// S3 configures the storage of the replays in an S3 compatible
+	// bucket. The credentials are read from AWS_ACCESS_KEY_ID and
+	// AWS_SECRET_ACCESS_KEY if not set.
+	S3 struct {
+		Endpoint  string `toml:"endpoint"`
+		Region    string `toml:"region"`
+		Bucket    string `toml:"bucket"`
+		Prefix    string `toml:"prefix"`
+		AccessKey string `toml:"access-key"`
+		SecretKey string `toml:"secret-key"`
+	} `toml:"s3"`
+}
+
+// configPath returns the path of the configuration file
+func configPath() string {
+	return path.Join(xdg.Config.Home(), "go-lol", "config.toml")
+}
+
+// LoadConfig loads the configuration file. A missing file is not an
+// error, an empty configuration is returned instead.
+func LoadConfig() (*Config, error) {
+	return loadConfigFile(configPath())
+}
+
+// loadConfigFile loads the configuration from filepath, or returns an
+// empty configuration if it does not exist.
+func loadConfigFile(filepath string) (*Config, error) {
+	res := &Config{}
+	if _, err := os.Stat(filepath); err != nil {
+		if os.IsNotExist(err) == true {
+			return res, nil
+		}
+		return nil, err
+	}
+
+	if _, err := toml.DecodeFile(filepath, res); err != nil {
+		return nil, fmt.Errorf("Could not parse configuration file %s: %s", filepath, err)
+	}
+
+	if err := res.check(); err != nil {
+		return nil, fmt.Errorf("Invalid configuration file %s: %s", filepath, err)
+	}
+	return res, nil
+}
+
+func (c *Config) check() error {
+	if len(c.Region) != 0 {
+		if _, err := lol.NewRegionByCode(c.Region); err != nil {
+			return err
+		}
+	}
+
+	for code := range c.Summoners {
+		if _, err := lol.NewRegionByCode(code); err != nil {
+			return fmt.Errorf("Invalid summoners list: %s", err)
+		}
+	}
+
+	if len(c.S3.Bucket) != 0 && len(c.S3.Endpoint) == 0 {
+		return fmt.Errorf("Missing S3 endpoint")
+	}
+
+	for _, d := range []string{c.Watch.Interval, c.Retention.OlderThan} {
+		if len(d) == 0 {
+			continue
+		}
+		if _, err := time.ParseDuration(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setDefault sets the default value of a command option. Since
+// defaults are only used when the option is not given on the command
+// line, it lets the command line overrides the configuration.
+func setDefault(command, longName, value string) error {
+	c := parser.Command
+	if len(command) != 0 {
+		c = parser.Find(command)
+	}
+	if c == nil {
+		return fmt.Errorf("Unknown command %s", command)
+	}
+	o := c.FindOptionByLongName(longName)
+	if o == nil {
+		return fmt.Errorf("Unknown option --%s for command %s", longName, command)
+	}
+	o.Default = []string{value}
+	return nil
+}
+
+// ApplyDefaults uses the configuration values as command line
+// defaults. It must be called before the command line is parsed.
+func (c *Config) ApplyDefaults() error {
+	type option struct {
+		command, longName, value string
+	}
+	options := []option{}
+
+	if len(c.Region) != 0 {
+		options = append(options, option{"", "region", c.Region})
+	}
+	if len(c.ReplayDir) != 0 {
+		options = append(options, option{"", "replay-dir", c.ReplayDir})
+	}
+	if len(c.Watch.Interval) != 0 {
+		options = append(options, option{"watch-summoner", "interval", c.Watch.Interval})
+	}
+	if c.Watch.MaxDownloads > 0 {
+		maxDownloads := strconv.Itoa(c.Watch.MaxDownloads)
+		options = append(options, option{"watch-summoner", "max-downloads", maxDownloads})
+		options = append(options, option{"watch-featured", "max-downloads", maxDownloads})
+	}
+	if len(c.Retention.OlderThan) != 0 {
+		options = append(options, option{"garbage-collect", "older-than", c.Retention.OlderThan})
+	}
+	if c.Retention.Limit != nil {
+		options = append(options, option{"garbage-collect", "limit", strconv.Itoa(*c.Retention.Limit)})
+	}
+	if len(c.Replay.Address) != 0 {
+		options = append(options, option{"replay", "address", c.Replay.Address})
+		options = append(options, option{"serve", "address", c.Replay.Address})
+	}
+	if c.Replay.TimeFactor != 0 {
+		timeFactor := strconv.FormatUint(uint64(c.Replay.TimeFactor), 10)
+		options = append(options, option{"replay", "time-factor", timeFactor})
+		options = append(options, option{"serve", "time-factor", timeFactor})
+	}
+
+	for _, o := range options {
+		if err := setDefault(o.command, o.longName, o.value); err != nil {
+			return fmt.Errorf("Could not apply configuration: %s", err)
+		}
+	}
+	return nil
+}
+
+var config *Config
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io/ioutil"
+	"path"
+
+	. "gopkg.in/check.v1"
+)
+
+type ConfigSuite struct{}
+
+var _ = Suite(&ConfigSuite{})
+
+func (s *ConfigSuite) TestLoadsConfig(c *C) {
+	testData := []struct {
+		Content string
+		Error   string
+	}{
+		{`
+region = "na"
+replay-dir = "/srv/replays"
+
+[summoners]
+euw = [ "Some Player" ]
+
+[watch]
+interval = "2m30s"
+max-downloads = 5
+`, ""},
+		{`region = "na`, "Could not parse configuration file .*"},
+		{`[watch]
+max-downloads = "five"`, "Could not parse configuration file .*"},
+		{`region = "nowhere"`, "Invalid configuration file .*"},
+		{`[summoners]
+nowhere = [ "Some Player" ]`, "Invalid configuration file .*: Invalid summoners list: .*"},
+		{`[retention]
+older-than = "one week"`, "Invalid configuration file .*"},
+		{`[s3]
+bucket = "replays"`, "Invalid configuration file .*: Missing S3 endpoint"},
+	}
+
+	for _, d := range testData {
+		filepath := path.Join(c.MkDir(), "config.toml")
+		c.Assert(ioutil.WriteFile(filepath, []byte(d.Content), 0644), IsNil)
+		config, err := loadConfigFile(filepath)
+		if len(d.Error) != 0 {
+			c.Check(err, ErrorMatches, d.Error, Commentf("content: %s", d.Content))
+			continue
+		}
+		c.Assert(err, IsNil, Commentf("content: %s", d.Content))
+		c.Check(config.Region, Equals, "na")
+		c.Check(config.ReplayDir, Equals, "/srv/replays")
+		c.Check(config.Summoners, DeepEquals, map[string][]string{"euw": {"Some Player"}})
+		c.Check(config.Watch.Interval, Equals, "2m30s")
+		c.Check(config.Watch.MaxDownloads, Equals, 5)
+	}
+
+	config, err := loadConfigFile(path.Join(c.MkDir(), "config.toml"))
+	c.Assert(err, IsNil)
+	c.Check(config, DeepEquals, &Config{})
+}
+
+func (s *ConfigSuite) TestAppliesDefaults(c *C) {
+	config := &Config{}
+	config.Region = "kr"
+	config.Watch.MaxDownloads = 7
+	config.Replay.Address = "localhost:9999"
+	limit := 0
+	config.Retention.Limit = &limit
+	c.Assert(config.ApplyDefaults(), IsNil)
+
+	testData := []struct {
+		Command  string
+		LongName string
+		Expected []string
+	}{
+		{"", "region", []string{"kr"}},
+		{"watch-summoner", "max-downloads", []string{"7"}},
+		{"watch-featured", "max-downloads", []string{"7"}},
+		{"replay", "address", []string{"localhost:9999"}},
+		{"serve", "address", []string{"localhost:9999"}},
+		{"garbage-collect", "limit", []string{"0"}},
+		{"watch-summoner", "interval", []string{"150s"}},
+	}
+
+	for _, d := range testData {
+		command := parser.Command
+		if len(d.Command) != 0 {
+			command = parser.Find(d.Command)
+		}
+		c.Assert(command, NotNil, Commentf("command: %s", d.Command))
+		o := command.FindOptionByLongName(d.LongName)
+		c.Assert(o, NotNil, Commentf("option: %s --%s", d.Command, d.LongName))
+		c.Check(o.Default, DeepEquals, d.Expected, Commentf("option: %s --%s", d.Command, d.LongName))
+	}
+
+	c.Check(setDefault("no-such-command", "region", "euw"), ErrorMatches, "Unknown command no-such-command")
+	c.Check(setDefault("serve", "no-such-option", "euw"), ErrorMatches, "Unknown option --no-such-option for command serve")
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/atuleu/go-lol"
+)
+
+type DiscardCommand struct {
+	All bool `long:"all" short:"a" description:"Discard all incomplete recordings of the region"`
+}
+
+func (x *DiscardCommand) Execute(args []string) error {
+	if len(args) == 0 && x.All == false {
+		return fmt.Errorf("discard needs the GameIDs of the recordings to discard, or --all")
+	}
+
+	i, err := NewInteractor(options)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]uint64, 0, len(args))
+	if x.All == true {
+		for _, r := range i.manager.IncompleteReplays()[i.region.Code()] {
+			ids = append(ids, uint64(r.MetaData.GameKey.ID))
+		}
+	}
+	for _, idStr := range args {
+		id, err := strconv.ParseUint(idStr, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid GameID %s: %s", idStr, err)
+		}
+		// ensures we never delete a complete replay
+		if _, err := findIncomplete(i, id); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+
+	for _, id := range ids {
+		log.Printf("Discarding incomplete recording %s/%d", i.region.PlatformID(), id)
+		if err := i.manager.Delete(i.region, lol.GameID(id)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	parser.AddCommand("discard",
+		"Discard interrupted recordings",
+		"Removes the data of recordings that were interrupted (data will be lost forever)",
+		&DiscardCommand{})
+}
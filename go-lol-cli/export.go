@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/atuleu/go-lol"
+	"github.com/atuleu/go-lol/x-go-lol"
+)
+
+type ExportCommand struct {
+	Output string `long:"output" short:"o" description:"File to export the replay to, its extension selects the format" required:"true"`
+}
+
+// parseGameKey parses a game identified as <platformID>/<gameID>
+func parseGameKey(key string) (*lol.Region, lol.GameID, error) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 2 {
+		return nil, 0, fmt.Errorf("Invalid game '%s', expected <platformID>/<gameID>", key)
+	}
+	region, err := lol.NewRegionByPlatformID(parts[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	id, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Invalid GameID %s: %s", parts[1], err)
+	}
+	return region, lol.GameID(id), nil
+}
+
+// closeFormatter closes a ReplayDataFormatter backed by a file
+func closeFormatter(f xlol.ReplayDataFormatter) error {
+	if closer, ok := f.(io.Closer); ok == true {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (x *ExportCommand) Execute(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("export requires a game, as <platformID>/<gameID>")
+	}
+	region, id, err := parseGameKey(args[0])
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(x.Output); err == nil {
+		return fmt.Errorf("%s already exists", x.Output)
+	}
+
+	i, err := NewInteractor(options)
+	if err != nil {
+		return err
+	}
+
+	loader, err := i.manager.Get(region, id)
+	if err != nil {
+		return err
+	}
+
+	out, err := xlol.OpenReplayFile(x.Output)
+	if err != nil {
+		return err
+	}
+	_, err = xlol.CopyReplay(out, loader)
+	if errClose := closeFormatter(out); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(x.Output)
+		return fmt.Errorf("Could not export game %s/%d: %s", region.PlatformID(), id, err)
+	}
+
+	log.Printf("Exported game %s/%d to %s", region.PlatformID(), id, x.Output)
+	return nil
+}
+
+func init() {
+	parser.AddCommand("export",
+		"Export a replay to a file",
+		"Exports a recorded replay, given as <platformID>/<gameID>, to a single file that can be shared. The format is selected by the file extension",
+		&ExportCommand{})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/atuleu/go-lol"
+	"github.com/atuleu/go-lol/x-go-lol"
+)
+
+type ImportCommand struct{}
+
+func (x *ImportCommand) Execute(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("import requires at least one replay file")
+	}
+
+	i, err := NewInteractor(options)
+	if err != nil {
+		return err
+	}
+
+	for _, filename := range args {
+		if err := importReplay(i, filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importReplay checks the integrity of a replay file, and copies it
+// to the replay manager.
+func importReplay(i *Interactor, filename string) error {
+	// opening a replay file would create it
+	if _, err := os.Stat(filename); err != nil {
+		return err
+	}
+	in, err := xlol.OpenReplayFile(filename)
+	if err != nil {
+		return err
+	}
+	defer closeFormatter(in)
+
+	replay, err := xlol.LoadReplayWithData(in)
+	if err != nil {
+		return fmt.Errorf("Could not import %s: %s", filename, err)
+	}
+	// some formats do not record the platform of the game
+	if len(replay.MetaData.GameKey.PlatformID) == 0 {
+		log.Printf("%s does not tell the platform of its game, importing it on %s", filename, i.region.PlatformID())
+		replay.MetaData.GameKey.PlatformID = i.region.PlatformID()
+	}
+	region, err := lol.NewRegionByPlatformID(replay.MetaData.GameKey.PlatformID)
+	if err != nil {
+		return fmt.Errorf("Could not import %s: %s", filename, err)
+	}
+	id := replay.MetaData.GameKey.ID
+
+	if _, err := i.manager.Create(region, id); err != nil {
+		return err
+	}
+	if err := i.manager.Store(replay); err != nil {
+		i.manager.Delete(region, id)
+		return fmt.Errorf("Could not import %s: %s", filename, err)
+	}
+
+	log.Printf("Imported game %s/%d from %s", region.PlatformID(), id, filename)
+	return nil
+}
+
+func init() {
+	parser.AddCommand("import",
+		"Import replay files",
+		"Imports replays exported in a single file. Their integrity is checked before they are added to the recorded replays",
+		&ImportCommand{})
+}
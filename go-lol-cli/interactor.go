@@ -2,16 +2,20 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path"
 
 	"github.com/atuleu/go-lol"
 	"github.com/atuleu/go-lol/x-go-lol"
+	"launchpad.net/go-xdg"
 )
 
 type Interactor struct {
 	region  *lol.Region
 	storer  lol.APIKeyStorer
 	key     lol.APIKey
-	manager *xlol.XdgReplayManager
+	manager xlol.ReplayManager
+	querier xlol.ReplayQuerier
 	api     *lol.APIEndpoint
 }
 
@@ -44,11 +48,54 @@ func NewInteractor(options *Options) (*Interactor, error) {
 		return nil, err
 	}
 
-	res.manager, err = xlol.NewXdgReplayManager()
+	var manager xlol.ReplayManager
+	indexPath := path.Join(xdg.Cache.Home(), "go-lol", "replays", "index.db")
+	if len(options.ReplayDir) != 0 {
+		manager, err = xlol.NewDirReplayManager(options.ReplayDir)
+		indexPath = path.Join(options.ReplayDir, "index.db")
+	} else if config != nil && len(config.S3.Bucket) != 0 {
+		manager, err = newS3ReplayManager(config)
+		indexPath = path.Join(xdg.Cache.Home(), "go-lol", "s3-"+config.S3.Bucket+".db")
+	} else {
+		manager, err = xlol.NewXdgReplayManager()
+	}
+	if err != nil {
+		return nil, err
+	}
 
+	index, err := xlol.NewReplayIndex(indexPath)
 	if err != nil {
 		return nil, err
 	}
+	indexed, err := xlol.NewIndexedReplayManager(manager, index)
+	if err != nil {
+		return nil, err
+	}
+	res.manager = indexed
+	res.querier = indexed
 
 	return res, nil
 }
+
+// newS3ReplayManager returns a ReplayManager storing the replays in the
+// configured S3 bucket
+func newS3ReplayManager(config *Config) (xlol.ReplayManager, error) {
+	s3 := xlol.S3Config{
+		Endpoint:  config.S3.Endpoint,
+		Region:    config.S3.Region,
+		Bucket:    config.S3.Bucket,
+		AccessKey: config.S3.AccessKey,
+		SecretKey: config.S3.SecretKey,
+	}
+	if len(s3.AccessKey) == 0 {
+		s3.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if len(s3.SecretKey) == 0 {
+		s3.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	bucket, err := xlol.NewS3Bucket(s3)
+	if err != nil {
+		return nil, err
+	}
+	return xlol.NewS3ReplayManager(bucket, config.S3.Prefix)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+)
+
+// interruptContext returns a context that is cancelled on SIGINT, so
+// recordings can be stopped cleanly and resumed later.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigint := make(chan os.Signal, 1)
+	signal.Notify(sigint, os.Interrupt)
+	go func() {
+		defer signal.Stop(sigint)
+		select {
+		case <-sigint:
+			log.Printf("Interrupted, stopping current recordings")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
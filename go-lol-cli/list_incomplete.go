@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/atuleu/go-lol/x-go-lol"
+)
+
+type ListIncompleteCommand struct{}
+
+func (x *ListIncompleteCommand) Execute(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("list-incomplete does not take any arguments")
+	}
+
+	i, err := NewInteractor(options)
+	if err != nil {
+		return err
+	}
+
+	replays := i.manager.IncompleteReplays()[i.region.Code()]
+	if len(replays) == 0 {
+		fmt.Printf("No incomplete recording for region %s\n", i.region.Code())
+		return nil
+	}
+
+	fmt.Printf("There are %d incomplete recordings for %s:\n", len(replays), i.region.Code())
+	for _, r := range replays {
+		fmt.Printf("  GameID:%s/%d at %s -- %d chunks, %d keyframes\n",
+			r.MetaData.GameKey.PlatformID,
+			r.MetaData.GameKey.ID,
+			r.MetaData.StartTime,
+			len(r.Chunks),
+			len(r.KeyFrames))
+		if len(r.MissingChunks) > 0 || len(r.MissingKeyFrames) > 0 {
+			fmt.Printf("    could not recover %d chunks and %d keyframes\n",
+				len(r.MissingChunks),
+				len(r.MissingKeyFrames))
+		}
+	}
+
+	return nil
+}
+
+// findIncomplete returns the incomplete replay for a game
+func findIncomplete(i *Interactor, id uint64) (*xlol.Replay, error) {
+	for _, r := range i.manager.IncompleteReplays()[i.region.Code()] {
+		if uint64(r.MetaData.GameKey.ID) == id {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("No incomplete recording for game %s/%d", i.region.PlatformID(), id)
+}
+
+func init() {
+	parser.AddCommand("list-incomplete",
+		"List recordings that were interrupted",
+		"List the recordings of the given region that were interrupted before the end of the game. They can be resumed with resume, or discarded with discard",
+		&ListIncompleteCommand{})
+}
@@ -1,18 +1,172 @@
 package main
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/atuleu/go-lol"
 	"github.com/atuleu/go-lol/x-go-lol"
 )
 
 type ListReplaysCommand struct {
-	RegionCode string `long:"region" short:"r" description:"region to use for looking up summoners" default:"euw"`
+	Summoner string  `long:"summoner" short:"s" description:"Only lists games where this summoner plays"`
+	Champion int     `long:"champion" short:"c" description:"Only lists games where this champion ID is played, by the summoner if one is given"`
+	Queues   []int64 `long:"queue" short:"q" description:"Only lists games of this queue ID, can be repeated"`
+	Since    string  `long:"since" description:"Only lists games started since this date (2006-01-02) or duration (e.g. 168h)"`
+	Sort     string  `long:"sort" description:"Sorts the replays by start date, duration or game ID" choice:"date" choice:"duration" choice:"id" default:"date"`
+	Reverse  bool    `long:"reverse" description:"Lists the oldest, shortest or lowest game ID first"`
+	Format   string  `long:"format" short:"f" description:"Output format" choice:"table" choice:"json" choice:"csv" default:"table"`
+}
+
+// parseSince parses a date, or a duration before now
+func parseSince(since string) (time.Time, error) {
+	if d, err := time.ParseDuration(since); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", since, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid date or duration %s", since)
+	}
+	return t, nil
+}
+
+type replaysByDate []*xlol.IndexedReplay
+
+func (l replaysByDate) Len() int {
+	return len(l)
+}
+
+func (l replaysByDate) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
+
+func (l replaysByDate) Less(i, j int) bool {
+	return l[i].StartTime.Before(l[j].StartTime)
+}
+
+type replaysByDuration []*xlol.IndexedReplay
+
+func (l replaysByDuration) Len() int {
+	return len(l)
+}
+
+func (l replaysByDuration) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
+
+func (l replaysByDuration) Less(i, j int) bool {
+	return l[i].Duration < l[j].Duration
+}
+
+type replaysByID []*xlol.IndexedReplay
+
+func (l replaysByID) Len() int {
+	return len(l)
+}
+
+func (l replaysByID) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
+
+func (l replaysByID) Less(i, j int) bool {
+	return l[i].GameID < l[j].GameID
+}
+
+// participantSummary is the machine readable output of a participant
+// of a replay
+type participantSummary struct {
+	SummonerID lol.SummonerID `json:"summonerId"`
+	Name       string         `json:"name"`
+	ChampionID lol.ChampionID `json:"championId"`
+	Champion   string         `json:"champion"`
+	TeamID     int64          `json:"teamId"`
+}
+
+// replaySummary is the machine readable output of a replay
+type replaySummary struct {
+	PlatformID       string               `json:"platformId"`
+	GameID           lol.GameID           `json:"gameId"`
+	StartTime        time.Time            `json:"startTime"`
+	Duration         float64              `json:"duration"`
+	Queue            lol.QueueID          `json:"queue"`
+	Map              lol.MapID            `json:"map"`
+	PlayerOfInterest lol.SummonerID       `json:"playerOfInterest"`
+	Participants     []participantSummary `json:"participants"`
+}
+
+func summarizeReplay(r *xlol.IndexedReplay, printer *xlol.ReplayPrinter) replaySummary {
+	res := replaySummary{
+		PlatformID:       r.PlatformID,
+		GameID:           r.GameID,
+		StartTime:        r.StartTime,
+		Duration:         r.Duration.Seconds(),
+		Queue:            r.Queue,
+		Map:              r.Map,
+		PlayerOfInterest: r.PlayerOfInterest,
+		Participants:     make([]participantSummary, 0, len(r.Participants)),
+	}
+	for _, p := range r.Participants {
+		res.Participants = append(res.Participants, participantSummary{
+			SummonerID: p.ID,
+			Name:       p.Name,
+			ChampionID: p.Champion,
+			Champion:   printer.ChampionName(p.Champion),
+			TeamID:     p.TeamID,
+		})
+	}
+	return res
+}
+
+func printJSON(summaries []replaySummary) error {
+	data, err := json.MarshalIndent(summaries, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", data)
+	return nil
+}
+
+// team formats the participants of a team as "Name (Champion)",
+// separated by semicolons
+func (s replaySummary) team(teamID int64) string {
+	players := []string{}
+	for _, p := range s.Participants {
+		if p.TeamID == teamID {
+			players = append(players, fmt.Sprintf("%s (%s)", p.Name, p.Champion))
+		}
+	}
+	return strings.Join(players, ";")
+}
+
+func printCSV(summaries []replaySummary) error {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"platform_id", "game_id", "start_time", "duration", "queue", "map", "player_of_interest", "blue_team", "red_team"})
+	for _, s := range summaries {
+		w.Write([]string{
+			s.PlatformID,
+			strconv.FormatUint(uint64(s.GameID), 10),
+			s.StartTime.Format(time.RFC3339),
+			strconv.FormatFloat(s.Duration, 'f', -1, 64),
+			strconv.FormatInt(int64(s.Queue), 10),
+			strconv.FormatInt(int64(s.Map), 10),
+			strconv.FormatInt(int64(s.PlayerOfInterest), 10),
+			s.team(100),
+			s.team(200),
+		})
+	}
+	w.Flush()
+	return w.Error()
 }
 
 func (x *ListReplaysCommand) Execute(args []string) error {
 	if len(args) != 0 {
-		return fmt.Errorf("list-replays does not take an Arguments")
+		return fmt.Errorf("list-replays does not take any arguments")
 	}
 
 	i, err := NewInteractor(options)
@@ -20,33 +174,71 @@ func (x *ListReplaysCommand) Execute(args []string) error {
 		return err
 	}
 
-	printer, err := xlol.NewReplayPrinter(i.region, i.key)
+	query := xlol.ReplayQuery{
+		PlatformID: i.region.PlatformID(),
+		Summoner:   x.Summoner,
+		Champion:   lol.ChampionID(x.Champion),
+	}
+	for _, q := range x.Queues {
+		query.Queues = append(query.Queues, lol.QueueID(q))
+	}
+	if len(x.Since) != 0 {
+		query.Since, err = parseSince(x.Since)
+		if err != nil {
+			return err
+		}
+	}
+
+	replays, err := i.querier.Query(query)
 	if err != nil {
 		return err
 	}
 
-	byCode := i.manager.Replays()
+	var sorted sort.Interface
+	switch x.Sort {
+	case "duration":
+		sorted = replaysByDuration(replays)
+	case "id":
+		sorted = replaysByID(replays)
+	default:
+		sorted = replaysByDate(replays)
+	}
+	if x.Reverse == false {
+		sorted = sort.Reverse(sorted)
+	}
+	sort.Stable(sorted)
 
-	replays := byCode[x.RegionCode]
+	printer, err := xlol.NewReplayPrinter(i.region, i.key)
+	if err != nil {
+		return err
+	}
 
-	if len(replays) == 0 {
-		return fmt.Errorf("No replay for region %s", x.RegionCode)
+	if x.Format == "table" {
+		if len(replays) == 0 {
+			return fmt.Errorf("No replay for region %s", i.region.Code())
+		}
+		fmt.Printf("There are %d replay available for %s:\n", len(replays), i.region.Code())
+		for _, r := range replays {
+			printer.Display(r.Replay())
+			fmt.Printf("\n")
+		}
+		return nil
 	}
 
-	fmt.Printf("There are %d replay available for %s:\n", len(replays), x.RegionCode)
+	summaries := make([]replaySummary, 0, len(replays))
 	for _, r := range replays {
-		printer.Display(r)
-		fmt.Printf("\n")
+		summaries = append(summaries, summarizeReplay(r, printer))
 	}
-
-	return nil
-
+	if x.Format == "csv" {
+		return printCSV(summaries)
+	}
+	return printJSON(summaries)
 }
 
 func init() {
 	parser.AddCommand("list-replays",
 		"List replays give the list of recorded replays for the given region",
-		"List replays give the list of recorded replays for the given region",
+		"List replays give the list of recorded replays for the given region. They can be filtered by summoner, champion, queue and start date, and printed as a table, JSON or CSV",
 		&ListReplaysCommand{})
 
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/atuleu/go-lol"
+	"github.com/atuleu/go-lol/x-go-lol"
+)
+
+type NoteCommand struct {
+	Append bool `long:"append" short:"a" description:"Appends a line to the notes instead of replacing them"`
+	Clear  bool `long:"clear" description:"Clears the notes"`
+}
+
+func (x *NoteCommand) Execute(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("note needs the GameID of a replay")
+	}
+
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid GameID %s: %s", args[0], err)
+	}
+	text := strings.Join(args[1:], " ")
+
+	i, err := NewInteractor(options)
+	if err != nil {
+		return err
+	}
+
+	if len(text) == 0 && x.Clear == false {
+		loader, err := i.manager.Get(i.region, lol.GameID(id))
+		if err != nil {
+			return err
+		}
+		r, err := xlol.LoadReplay(loader)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", r.Notes)
+		return nil
+	}
+
+	return xlol.UpdateReplay(i.manager, i.region, lol.GameID(id), func(r *xlol.Replay) error {
+		if x.Clear == true {
+			r.Notes = ""
+		}
+		if x.Append == true && len(r.Notes) != 0 {
+			r.Notes += "\n" + text
+		} else if len(text) != 0 {
+			r.Notes = text
+		}
+		return nil
+	})
+}
+
+func init() {
+	parser.AddCommand("note",
+		"Writes notes about a replay",
+		"Sets the free text notes of a recorded replay. Without text, it prints the notes of the replay",
+		&NoteCommand{})
+}
@@ -4,6 +4,7 @@ import "github.com/jessevdk/go-flags"
 
 type Options struct {
 	RegionCode string `long:"region" short:"r" description:"region to use for looking up summoners" default:"euw"`
+	ReplayDir  string `long:"replay-dir" description:"directory storing the replays, by default they are stored in the XDG cache directory"`
 }
 
 var options = &Options{}
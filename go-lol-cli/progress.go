@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/atuleu/go-lol/x-go-lol"
+)
+
+// A progressPrinter displays the progress of a recording on stderr
+type progressPrinter struct {
+	gameTime  time.Duration
+	chunks    int
+	keyframes int
+	endChunk  xlol.ChunkID
+}
+
+func (p *progressPrinter) print() {
+	end := ""
+	if p.endChunk > 0 {
+		end = ", game ended"
+	}
+	fmt.Fprintf(os.Stderr, "Recorded %02d:%02d of game time, %d chunks, %d keyframes%s\n",
+		int(p.gameTime.Minutes()),
+		int(p.gameTime.Seconds())%60,
+		p.chunks,
+		p.keyframes,
+		end)
+}
+
+// Notify implements xlol.SpectateObserver
+func (p *progressPrinter) Notify(event xlol.SpectateEvent) {
+	switch e := event.(type) {
+	case xlol.ChunkStoredEvent:
+		if e.GameTime > p.gameTime {
+			p.gameTime = e.GameTime
+		}
+		p.chunks = e.Chunks
+		p.print()
+	case xlol.KeyFrameStoredEvent:
+		p.keyframes = e.KeyFrames
+	case xlol.GameEndedEvent:
+		p.endChunk = e.EndGameChunkID
+		p.print()
+	}
+}
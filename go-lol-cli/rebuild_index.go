@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+type RebuildIndexCommand struct{}
+
+func (x *RebuildIndexCommand) Execute(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("rebuild-index does not take any arguments")
+	}
+
+	i, err := NewInteractor(options)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Rebuilding replay index")
+	return i.querier.Rebuild()
+}
+
+func init() {
+	parser.AddCommand("rebuild-index",
+		"Rebuilds the index of recorded replays",
+		"Replays are listed from an index, that is updated when they are recorded or deleted. It rebuilds the index from the stored replays, e.g. when they were modified by another tool",
+		&RebuildIndexCommand{})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/atuleu/go-lol/x-go-lol"
+)
+
+type RelayCommand struct {
+	Address string `long:"address" short:"a" description:"Address of the relay server" default:"localhost:8088"`
+	Delay   string `long:"delay" short:"d" description:"Delay (30s 3m) between the live game and the relayed stream" default:"3m"`
+}
+
+func (x *RelayCommand) Execute(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("relay requires a Summoner name")
+	}
+
+	delay, err := time.ParseDuration(x.Delay)
+	if err != nil {
+		return err
+	}
+
+	i, err := NewInteractor(options)
+	if err != nil {
+		return err
+	}
+
+	summoners, err := i.api.GetSummonerByName(args)
+	if err != nil {
+		return err
+	}
+	if len(summoners) == 0 {
+		return fmt.Errorf("Could not find Summoner %s", args[0])
+	}
+
+	info, err := i.api.GetCurrentGame(summoners[0].ID)
+	if err != nil {
+		return err
+	}
+	if info == nil {
+		return fmt.Errorf("Summoner %s is not in game", summoners[0].Name)
+	}
+
+	w, err := i.manager.Create(i.region, info.ID)
+	if err != nil {
+		return err
+	}
+	formatter, ok := w.(xlol.ReplayDataFormatter)
+	if ok == false {
+		return fmt.Errorf("Replay storage for game %s/%d cannot be read back", i.region.PlatformID(), info.ID)
+	}
+
+	api, err := xlol.NewSpectateAPI(i.region, info.ID)
+	if err != nil {
+		return err
+	}
+
+	relay, err := xlol.NewRelayServer(api, info.Observer.EncryptionKey, formatter, delay)
+	if err != nil {
+		return err
+	}
+
+	// listen before recording, so an unavailable address is reported
+	// immediately
+	l, err := net.Listen("tcp", x.Address)
+	if err != nil {
+		return err
+	}
+	errchan := make(chan error, 1)
+	go func() {
+		log.Printf("Relaying game %s/%d on %s with a delay of %s", i.region.PlatformID(), info.ID, x.Address, delay)
+		errchan <- relay.Serve(l)
+	}()
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	go func() {
+		for relay.Available() == false {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+		log.Printf(`Game is available, launch the LoL client as described at https://developer.riotgames.com/docs/spectating-games, with arguments "spectator %s %s %d %s"`,
+			x.Address, relay.EncryptionKey(), info.ID, i.region.PlatformID())
+	}()
+
+	replay, err := relay.Record(ctx)
+	if err == context.Canceled {
+		relay.Close()
+		return nil
+	}
+	missing, incomplete := err.(xlol.MissingDataError)
+	if err != nil && incomplete == false {
+		relay.Close()
+		return err
+	}
+
+	replay.AddGameInfo(*info)
+	if err := replay.HighlightSummoner(summoners[0].ID); err != nil {
+		return err
+	}
+	if err := i.manager.Store(replay); err != nil {
+		return err
+	}
+	if incomplete == true {
+		log.Printf("Game %s/%d recorded, but some data is lost: %s", i.region.PlatformID(), info.ID, missing)
+	}
+	log.Printf("Game %s/%d recorded, still serving it until interrupted", i.region.PlatformID(), info.ID)
+
+	select {
+	case err := <-errchan:
+		return err
+	case <-ctx.Done():
+	}
+	if err := relay.Close(); err != nil {
+		return err
+	}
+	return <-errchan
+}
+
+func init() {
+	parser.AddCommand("relay",
+		"Relay the current game of a Summoner",
+		"Records the current game of a Summoner and serves it to local spectator clients with a delay, so several clients can watch the game without each of them polling the LoL servers",
+		&RelayCommand{})
+}
@@ -5,15 +5,46 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"time"
 
 	"github.com/atuleu/go-lol"
 	"github.com/atuleu/go-lol/x-go-lol"
 )
 
 type ReplayCommand struct {
-	GameID     uint64 `long:"game-id" short:"g" description:"ID of the game to replay, if none the most recent on the region is replayed"`
-	Address    string `long:"address" short:"a" description:"Address of the replay server" default:"localhost:8088"`
-	TimeFactor uint   `long:"time-factor" short:"t" description:"Time multiplication factor when streaming game, a too high value may hinder the performance of the client" default:"4"`
+	GameID        uint64 `long:"game-id" short:"g" description:"ID of the game to replay, if none the most recent on the region is replayed"`
+	Address       string `long:"address" short:"a" description:"Address of the replay server" default:"localhost:8088"`
+	TimeFactor    uint   `long:"time-factor" short:"t" description:"Time multiplication factor when streaming game, a too high value may hinder the performance of the client" default:"4"`
+	Start         string `long:"start" short:"s" description:"Starts the replay at this game time (e.g. 12m30s), from the keyframe preceding it"`
+	StartKeyFrame int    `long:"start-keyframe" short:"k" description:"Starts the replay at this keyframe"`
+	Bookmark      string `long:"bookmark" short:"b" description:"Starts the replay at this bookmark"`
+}
+
+// setStart sets where server starts streaming
+func (x *ReplayCommand) setStart(server *xlol.ReplayServer) error {
+	count := 0
+	for _, set := range []bool{len(x.Start) != 0, x.StartKeyFrame != 0, len(x.Bookmark) != 0} {
+		if set == true {
+			count++
+		}
+	}
+	if count > 1 {
+		return fmt.Errorf("Only one of --start, --start-keyframe and --bookmark can be given")
+	}
+
+	switch {
+	case len(x.Start) != 0:
+		t, err := time.ParseDuration(x.Start)
+		if err != nil {
+			return fmt.Errorf("Invalid game time %s: %s", x.Start, err)
+		}
+		return server.StartAtGameTime(t)
+	case x.StartKeyFrame != 0:
+		return server.StartAtKeyFrame(xlol.KeyFrameID(x.StartKeyFrame))
+	case len(x.Bookmark) != 0:
+		return server.StartAtBookmark(x.Bookmark)
+	}
+	return nil
 }
 
 func (x *ReplayCommand) Execute(args []string) error {
@@ -47,6 +78,9 @@ func (x *ReplayCommand) Execute(args []string) error {
 		return err
 	}
 	server.TimeDivisor = xlol.DurationMs(x.TimeFactor)
+	if err := x.setStart(server); err != nil {
+		return err
+	}
 
 	launcher, err := NewLolReplayLauncher("")
 	if err != nil {
@@ -61,7 +95,7 @@ You may want to launch manually the LoL client as described at https://developer
 	signal.Notify(sigchan, os.Interrupt)
 
 	go func() {
-		log.Printf("Starting replay serve on %s", x.Address)
+		log.Printf("Starting replay serve on %s, it can be controlled at http://%s%s", x.Address, x.Address, xlol.ControlPrefix)
 		err := server.ListenAndServe(x.Address)
 		log.Printf("Server finished")
 		errchan <- err
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/atuleu/go-lol"
+	"github.com/atuleu/go-lol/x-go-lol"
+)
+
+type ResumeCommand struct{}
+
+func (x *ResumeCommand) Execute(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("resume needs the GameID of the recording to resume")
+	}
+
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid GameID %s: %s", args[0], err)
+	}
+
+	i, err := NewInteractor(options)
+	if err != nil {
+		return err
+	}
+
+	partial, err := findIncomplete(i, id)
+	if err != nil {
+		return err
+	}
+
+	gid := lol.GameID(id)
+	w, err := i.manager.Resume(i.region, gid)
+	if err != nil {
+		return err
+	}
+
+	api, err := xlol.NewSpectateAPI(i.region, gid)
+	if err != nil {
+		return err
+	}
+	api.Observer = &progressPrinter{}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	replay, err := api.SpectateGame(ctx, partial.EncryptionKey, w)
+	if err == context.Canceled {
+		log.Printf("Recording of game %s/%d interrupted, it can be resumed later", i.region.PlatformID(), id)
+		return nil
+	}
+	// a Replay that misses some data is stored anyway, the lost
+	// Chunks and KeyFrames are listed in its metadata
+	missing, incomplete := err.(xlol.MissingDataError)
+	if err != nil && incomplete == false {
+		return err
+	}
+
+	if err := i.manager.Store(replay); err != nil {
+		return err
+	}
+	if incomplete == true {
+		log.Printf("Game %s/%d recorded, but some data is lost: %s", i.region.PlatformID(), id, missing)
+	}
+	return nil
+}
+
+func init() {
+	parser.AddCommand("resume",
+		"Resume an interrupted recording",
+		"Resume the recording of a game that was interrupted. It only works if the game is still being played, or has just finished",
+		&ResumeCommand{})
+}
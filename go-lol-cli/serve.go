@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/atuleu/go-lol/x-go-lol"
+)
+
+type ServeCommand struct {
+	Address    string `long:"address" short:"a" description:"Address of the replay server" default:"localhost:8088"`
+	TimeFactor uint   `long:"time-factor" short:"t" description:"Initial time multiplication factor when streaming games" default:"4"`
+	Version    string `long:"spectator-version" description:"Spectator API version sent to the clients, defaults to the version of the latest replay of the region"`
+	Idle       string `long:"idle-timeout" description:"Time after which a stream that is not watched is closed, 0 to never close them" default:"30m"`
+}
+
+func (x *ServeCommand) Execute(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("serve does not take any arguments")
+	}
+	if x.TimeFactor == 0 {
+		return fmt.Errorf("Invalid time factor 0")
+	}
+	idle, err := time.ParseDuration(x.Idle)
+	if err != nil {
+		return fmt.Errorf("Invalid idle timeout %s: %s", x.Idle, err)
+	}
+
+	i, err := NewInteractor(options)
+	if err != nil {
+		return err
+	}
+
+	server, err := xlol.NewMultiReplayServer(i.manager)
+	if err != nil {
+		return err
+	}
+	server.TimeDivisor = xlol.DurationMs(x.TimeFactor)
+	server.IdleTimeout = idle
+	server.Version = x.Version
+	if len(server.Version) == 0 {
+		replays := i.manager.Replays()[i.region.Code()]
+		if len(replays) == 0 {
+			return fmt.Errorf("No replay available for platform %s to guess the spectator version, use --spectator-version", i.region.Code())
+		}
+		server.Version = replays[0].Version
+		log.Printf("Using spectator version %s", server.Version)
+	}
+
+	sigchan := make(chan os.Signal, 1)
+	signal.Notify(sigchan, os.Interrupt)
+
+	errchan := make(chan error, 1)
+	go func() {
+		log.Printf("Serving all replays on %s, they can be controlled at http://%s%s<platformID>/<gameID>/", x.Address, x.Address, xlol.ControlPrefix)
+		errchan <- server.ListenAndServe(x.Address)
+	}()
+
+	select {
+	case err := <-errchan:
+		return err
+	case <-sigchan:
+		log.Printf("Stopping the server after catching SIGINT")
+	}
+
+	if err := server.Close(); err != nil {
+		return err
+	}
+	return <-errchan
+}
+
+func init() {
+	parser.AddCommand("serve",
+		"Serve all recorded replays",
+		"Starts a long running replay server that streams any recorded replay requested by a spectator client. Each game is streamed and controlled independently",
+		&ServeCommand{})
+}
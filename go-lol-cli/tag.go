@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/atuleu/go-lol"
+	"github.com/atuleu/go-lol/x-go-lol"
+)
+
+type TagCommand struct {
+	Remove bool `long:"remove" description:"Removes the tags instead of adding them"`
+}
+
+func (x *TagCommand) Execute(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("tag needs the GameID of a replay")
+	}
+
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid GameID %s: %s", args[0], err)
+	}
+
+	i, err := NewInteractor(options)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 1 {
+		loader, err := i.manager.Get(i.region, lol.GameID(id))
+		if err != nil {
+			return err
+		}
+		r, err := xlol.LoadReplay(loader)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s\n", strings.Join(r.Tags, "\n"))
+		return nil
+	}
+
+	return xlol.UpdateReplay(i.manager, i.region, lol.GameID(id), func(r *xlol.Replay) error {
+		for _, tag := range args[1:] {
+			if x.Remove == false {
+				r.AddTag(tag)
+			} else if r.RemoveTag(tag) == false {
+				return fmt.Errorf("Replay %s/%d is not tagged with %s", i.region.PlatformID(), id, tag)
+			}
+		}
+		return nil
+	})
+}
+
+func init() {
+	parser.AddCommand("tag",
+		"Tags a replay",
+		"Adds or removes tags of a recorded replay, e.g. \"scrim\" or \"vs TeamX\". Without tags, it prints the tags of the replay",
+		&TagCommand{})
+}
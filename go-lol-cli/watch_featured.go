@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/atuleu/go-lol"
+	"github.com/atuleu/go-lol/x-go-lol"
+)
+
+type WatchFeaturedCommand struct {
+	Queues       []int64  `long:"queue" short:"q" description:"Only records featured games of this queue ID, can be repeated"`
+	Maps         []int64  `long:"map" short:"m" description:"Only records featured games on this map ID, can be repeated"`
+	Champions    []int    `long:"champion" short:"c" description:"Only records featured games where this champion ID is played, can be repeated"`
+	Players      []string `long:"player" short:"p" description:"Only records featured games where this summoner plays, can be repeated"`
+	MaxDownloads int      `long:"max-downloads" short:"j" description:"Maximal number of games to record in parallel" default:"2"`
+}
+
+func (x *WatchFeaturedCommand) Execute(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("watch-featured does not take any arguments")
+	}
+
+	i, err := NewInteractor(options)
+	if err != nil {
+		return err
+	}
+
+	recorder, err := xlol.NewReplayRecorder(i.manager, x.MaxDownloads)
+	if err != nil {
+		return err
+	}
+
+	watcher, err := xlol.NewFeaturedGameWatcher(i.region, i.api, recorder)
+	if err != nil {
+		return err
+	}
+
+	for _, q := range x.Queues {
+		watcher.Filter.Queues = append(watcher.Filter.Queues, lol.QueueID(q))
+	}
+	for _, m := range x.Maps {
+		watcher.Filter.Maps = append(watcher.Filter.Maps, lol.MapID(m))
+	}
+	for _, c := range x.Champions {
+		watcher.Filter.Champions = append(watcher.Filter.Champions, lol.ChampionID(c))
+	}
+	watcher.Filter.Players = x.Players
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	err = watcher.Watch(ctx)
+	cancel()
+	recorder.Wait()
+	if err == context.Canceled {
+		return nil
+	}
+	return err
+}
+
+func init() {
+	parser.AddCommand("watch-featured",
+		"Watch featured games and download the interesting ones",
+		"This command regularly polls the LoL server for featured games, and downloads the ones that matches the given queues, maps, champions or players",
+		&WatchFeaturedCommand{})
+}
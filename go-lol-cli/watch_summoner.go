@@ -1,8 +1,11 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"fmt"
-	"log"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/atuleu/go-lol"
@@ -10,12 +13,42 @@ import (
 )
 
 type WatchSummonerCommand struct {
-	Interval string `long:"interval" short:"n" description:"Interval (300s 2m30s 10m) to wait between game check, min: 10s" default:"150s"`
+	Interval     string `long:"interval" short:"n" description:"Interval (300s 2m30s 10m) to wait between game check, min: 10s" default:"150s"`
+	WatchList    string `long:"watch-list" short:"w" description:"File containing the Summoners to watch, one per line. Empty lines and lines starting with # are ignored"`
+	MaxDownloads int    `long:"max-downloads" short:"j" description:"Maximal number of games to record in parallel" default:"3"`
+}
+
+// readWatchList reads the Summoner names contained in a file
+func readWatchList(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open watch list: %s", err)
+	}
+	defer f.Close()
+
+	res := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		res = append(res, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Could not read watch list %s: %s", filename, err)
+	}
+	return res, nil
 }
 
 func (x *WatchSummonerCommand) Execute(args []string) error {
-	if len(args) != 1 {
-		return fmt.Errorf("watch-summoner require the Summoner To Watch")
+	names := args
+	if len(x.WatchList) != 0 {
+		fromFile, err := readWatchList(x.WatchList)
+		if err != nil {
+			return err
+		}
+		names = append(names, fromFile...)
 	}
 
 	sleepDuration, err := time.ParseDuration(x.Interval)
@@ -31,70 +64,74 @@ func (x *WatchSummonerCommand) Execute(args []string) error {
 		return err
 	}
 
-	ids, err := i.api.GetSummonerByName(args)
-	if err != nil {
-		if rerr, ok := err.(lol.RESTError); ok == true {
-			if rerr.Code != 404 {
-				return err
+	// Summoners given on the command line are watched on the
+	// selected region, otherwise we watch all the Summoners listed
+	// in the configuration file, on all regions.
+	watchLists := map[string][]string{}
+	if len(names) != 0 {
+		watchLists[i.region.Code()] = names
+	} else {
+		for code, names := range config.Summoners {
+			if len(names) != 0 {
+				watchLists[code] = names
 			}
 		}
-		return err
 	}
 
-	if len(ids) != 1 {
-		return fmt.Errorf("Could not find Summoner '%s'", args[0])
+	if len(watchLists) == 0 {
+		return fmt.Errorf("watch-summoner require at least one Summoner To Watch")
+	}
+
+	recorder, err := xlol.NewReplayRecorder(i.manager, x.MaxDownloads)
+	if err != nil {
+		return err
 	}
-	summoner := ids[0]
 
-	for {
-		currentGame, err := i.api.GetCurrentGame(summoner.ID)
+	watchers := make([]*xlol.SummonerWatcher, 0, len(watchLists))
+	for code, names := range watchLists {
+		region, err := lol.NewRegionByCode(code)
 		if err != nil {
-			return fmt.Errorf("Could not check if %s is in a game: %s", summoner.Name, err)
+			return err
 		}
-
-		if currentGame != nil {
-			log.Printf("%s is in game, we start download it", summoner.Name)
-
-			api, err := xlol.NewSpectateAPI(i.region, currentGame.ID)
+		// all regions share the rate limit of our key
+		api := i.api
+		if region != i.region {
+			api, err = i.api.ForRegion(region)
 			if err != nil {
 				return err
 			}
+		}
 
-			// ft, err := i.manager.Create(i.region, currentGame.ID)
-			// if err != nil {
-			// 	return err
-			// }
-
-			//spectate the game
-			replay, err := api.SpectateGame(currentGame.Observer.EncryptionKey, nil)
-			if err != nil {
-				return err
-			}
-
-			// adds replay info
-			replay.AddGameInfo(*currentGame)
-
-			err = i.manager.Store(replay)
-			if err != nil {
-				return err
-			}
+		watcher, err := xlol.NewSummonerWatcher(region, api, recorder, names)
+		if err != nil {
+			return err
 		}
+		watcher.Interval = sleepDuration
+		watchers = append(watchers, watcher)
+	}
 
-		// we sleep
-		log.Printf("Next check for %s in-game status at %s",
-			summoner.Name,
-			time.Now().Add(sleepDuration))
-		time.Sleep(sleepDuration)
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	errors := make(chan error, len(watchers))
+	for _, w := range watchers {
+		go func(w *xlol.SummonerWatcher) {
+			errors <- w.Watch(ctx)
+		}(w)
 	}
 
+	err = <-errors
+	cancel()
+	recorder.Wait()
+	if err == context.Canceled {
+		return nil
+	}
+	return err
 }
 
-var cachedir string
-
 func init() {
-
 	parser.AddCommand("watch-summoner",
-		"Watch a Summoner fro in Game status and download the game it plays",
-		"This command regularly polls the LoL server to check if a summoner is in Game, and download the replay of the game",
+		"Watch Summoners for in Game status and download the games they play",
+		"This command regularly polls the LoL server to check if any of the given summoners is in Game, and download the replay of the game. Several games can be downloaded at the same time, and a game is downloaded only once",
 		&WatchSummonerCommand{})
 }
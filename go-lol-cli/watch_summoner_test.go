@@ -0,0 +1,34 @@
+package main
+
+import (
+	"io/ioutil"
+	"path"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type WatchSummonerSuite struct{}
+
+var _ = Suite(&WatchSummonerSuite{})
+
+func (s *WatchSummonerSuite) TestReadsWatchList(c *C) {
+	filename := path.Join(c.MkDir(), "watch-list")
+	content := `# my team
+Some Player
+  Another Player
+
+#Not Watched
+Third
+`
+	c.Assert(ioutil.WriteFile(filename, []byte(content), 0644), IsNil)
+
+	names, err := readWatchList(filename)
+	c.Assert(err, IsNil)
+	c.Check(names, DeepEquals, []string{"Some Player", "Another Player", "Third"})
+
+	_, err = readWatchList(path.Join(c.MkDir(), "does-not-exist"))
+	c.Check(err, ErrorMatches, "Could not open watch list: .*")
+}
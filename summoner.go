@@ -17,7 +17,39 @@ type SummonerID uint64
 // Time converts EpochMillisecond to time.Time
 func (s EpochMillisecond) Time() time.Time {
 	secs := int64(s) / 1000
-	return time.Unix(secs, int64(s)-secs)
+	return time.Unix(secs, (int64(s)-secs*1000)*int64(time.Millisecond))
+}
+
+// FromTime sets the EpochMillisecond from a time.Time. Sub-millisecond
+// precision is truncated, and any time before EPOCH is clamped to
+// EPOCH, as EpochMillisecond cannot represent it.
+func (s *EpochMillisecond) FromTime(t time.Time) {
+	ms := t.UnixNano() / int64(time.Millisecond)
+	if ms < 0 {
+		ms = 0
+	}
+	*s = EpochMillisecond(ms)
+}
+
+// MarshalJSON marshalizes the EpochMillisecond as a JSON number of
+// milliseconds
+func (s EpochMillisecond) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatUint(uint64(s), 10)), nil
+}
+
+// UnmarshalJSON unmarshalizes the EpochMillisecond from a JSON number
+// of milliseconds. A JSON null leaves the value untouched.
+func (s *EpochMillisecond) UnmarshalJSON(text []byte) error {
+	str := string(text)
+	if str == "null" {
+		return nil
+	}
+	v, err := strconv.ParseUint(str, 10, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid EpochMillisecond %s: %s", str, err)
+	}
+	*s = EpochMillisecond(v)
+	return nil
 }
 
 // A Summoner is a representation of a player on LoL servers
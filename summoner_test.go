@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"strconv"
 	"strings"
+	"time"
 
 	. "gopkg.in/check.v1"
 )
@@ -70,3 +71,58 @@ func (s *SummonerSuite) TestGetSummonerName(c *C) {
 	}
 
 }
+
+func (s *SummonerSuite) TestEpochMillisecondConversion(c *C) {
+	testdata := []struct {
+		ms   EpochMillisecond
+		t    time.Time
+		json string
+	}{
+		{0, time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), "0"},
+		{1, time.Date(1970, 1, 1, 0, 0, 0, 1000000, time.UTC), "1"},
+		{999, time.Date(1970, 1, 1, 0, 0, 0, 999000000, time.UTC), "999"},
+		{1000, time.Date(1970, 1, 1, 0, 0, 1, 0, time.UTC), "1000"},
+		{1435834071123, time.Date(2015, 7, 2, 10, 47, 51, 123000000, time.UTC), "1435834071123"},
+		{1451606399999, time.Date(2015, 12, 31, 23, 59, 59, 999000000, time.UTC), "1451606399999"},
+	}
+
+	for _, d := range testdata {
+		c.Check(d.ms.Time().Equal(d.t), Equals, true,
+			Commentf("%d converted to %s, expected %s", d.ms, d.ms.Time().UTC(), d.t))
+
+		var fromTime EpochMillisecond
+		fromTime.FromTime(d.t)
+		c.Check(fromTime, Equals, d.ms)
+
+		data, err := json.Marshal(d.ms)
+		if c.Check(err, IsNil) == true {
+			c.Check(string(data), Equals, d.json)
+		}
+
+		var unmarshaled EpochMillisecond
+		if c.Check(json.Unmarshal([]byte(d.json), &unmarshaled), IsNil) == true {
+			c.Check(unmarshaled, Equals, d.ms)
+		}
+	}
+
+	// sub-millisecond precision is truncated
+	var truncated EpochMillisecond
+	truncated.FromTime(time.Date(2015, 7, 2, 10, 47, 51, 123456789, time.UTC))
+	c.Check(truncated, Equals, EpochMillisecond(1435834071123))
+
+	// time before EPOCH are clamped
+	var clamped EpochMillisecond
+	clamped.FromTime(time.Date(1969, 12, 31, 23, 59, 59, 0, time.UTC))
+	c.Check(clamped, Equals, EpochMillisecond(0))
+
+	// null leaves the value untouched
+	untouched := EpochMillisecond(42)
+	c.Check(json.Unmarshal([]byte("null"), &untouched), IsNil)
+	c.Check(untouched, Equals, EpochMillisecond(42))
+
+	invalid := []string{`"1000"`, "-1", "1.5"}
+	for _, text := range invalid {
+		var v EpochMillisecond
+		c.Check(json.Unmarshal([]byte(text), &v), ErrorMatches, "Invalid EpochMillisecond .*")
+	}
+}
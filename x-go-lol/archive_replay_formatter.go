@@ -0,0 +1,419 @@
+package xlol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+)
+
+// ArchiveReplayFormatter is a ReplayDataFormatter that stores a whole
+// replay in a single file, so it can easily be copied or shared.
+//
+// The file starts with a header holding the replay data
+// (replayData.json) and the index of the Chunks, KeyFrames and end of
+// game statistics, followed by their data. Any of them can be read
+// without loading the others.
+//
+// An existing archive is opened read-only. Data written through the
+// formatter is streamed to a temporary file next to the archive, and
+// the archive is only rewritten, without the superseded data, when
+// the formatter is closed. An interrupted write leaves the archive
+// untouched.
+type ArchiveReplayFormatter struct {
+	filename string
+	file     *os.File
+
+	// held by the writer of the record being written
+	writing sync.Mutex
+
+	mx       sync.RWMutex
+	spool    *os.File
+	end      int64
+	index    map[archiveKey]archiveEntry
+	modified bool
+	closed   bool
+}
+
+const (
+	archiveMagic         string = "go-lol-replay"
+	archiveFormatVersion uint16 = 2
+	archiveHeaderSize    int64  = int64(len(archiveMagic)) + 2 + 8 + 4
+	archiveEntrySize     int64  = 1 + 4 + 8 + 8
+	archiveSpoolSuffix   string = ".part"
+)
+
+type archiveKind uint8
+
+const (
+	archiveReplayData archiveKind = iota + 1
+	archiveChunk
+	archiveKeyFrame
+	archiveEndOfGameStats
+)
+
+type archiveKey struct {
+	kind archiveKind
+	id   uint32
+}
+
+// archiveKeys sorts archiveKey by kind and ID
+type archiveKeys []archiveKey
+
+func (k archiveKeys) Len() int {
+	return len(k)
+}
+
+func (k archiveKeys) Less(i, j int) bool {
+	if k[i].kind != k[j].kind {
+		return k[i].kind < k[j].kind
+	}
+	return k[i].id < k[j].id
+}
+
+func (k archiveKeys) Swap(i, j int) {
+	k[i], k[j] = k[j], k[i]
+}
+
+// archiveEntry is a section of the archive or of the spool file
+type archiveEntry struct {
+	file   *os.File
+	offset int64
+	size   int64
+}
+
+func (e archiveEntry) reader() *io.SectionReader {
+	return io.NewSectionReader(e.file, e.offset, e.size)
+}
+
+// NewArchiveReplayFormatter returns a ReplayDataFormatter that will
+// save and load data from the file filename. The file is only
+// created once the formatter is closed.
+func NewArchiveReplayFormatter(filename string) (*ArchiveReplayFormatter, error) {
+	res := &ArchiveReplayFormatter{
+		filename: filename,
+		index:    make(map[archiveKey]archiveEntry),
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) == true {
+			res.modified = true
+			return res, nil
+		}
+		return nil, fmt.Errorf("Could not open replay archive %s: %s", filename, err)
+	}
+	res.file = f
+	if err := res.load(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Could not load replay archive %s: %s", filename, err)
+	}
+	return res, nil
+}
+
+// load checks the archive header and reads its index
+func (l *ArchiveReplayFormatter) load() error {
+	info, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	header := make([]byte, archiveHeaderSize)
+	n, err := l.file.ReadAt(header, 0)
+	if n < len(archiveMagic) || string(header[:len(archiveMagic)]) != archiveMagic {
+		return fmt.Errorf("Not a go-lol replay archive")
+	}
+	if err != nil {
+		return fmt.Errorf("Invalid header: %s", err)
+	}
+	fields := header[len(archiveMagic):]
+	if v := binary.BigEndian.Uint16(fields[0:2]); v != archiveFormatVersion {
+		return fmt.Errorf("Mismatched archive format version %d, expected %d", v, archiveFormatVersion)
+	}
+	replayDataSize := int64(binary.BigEndian.Uint64(fields[2:10]))
+	count := int64(binary.BigEndian.Uint32(fields[10:14]))
+
+	indexOffset := archiveHeaderSize + replayDataSize
+	dataOffset := indexOffset + count*archiveEntrySize
+	if replayDataSize > size || dataOffset > size {
+		return fmt.Errorf("Truncated archive")
+	}
+	if replayDataSize > 0 {
+		l.index[archiveKey{archiveReplayData, 0}] = archiveEntry{
+			file:   l.file,
+			offset: archiveHeaderSize,
+			size:   replayDataSize,
+		}
+	}
+
+	index := make([]byte, count*archiveEntrySize)
+	if _, err := l.file.ReadAt(index, indexOffset); err != nil {
+		return fmt.Errorf("Invalid index: %s", err)
+	}
+	for i := int64(0); i < count; i++ {
+		entry := index[i*archiveEntrySize : (i+1)*archiveEntrySize]
+		key := archiveKey{
+			kind: archiveKind(entry[0]),
+			id:   binary.BigEndian.Uint32(entry[1:5]),
+		}
+		if key.kind <= archiveReplayData || key.kind > archiveEndOfGameStats {
+			return fmt.Errorf("Invalid record kind %d in index", key.kind)
+		}
+		e := archiveEntry{
+			file:   l.file,
+			offset: int64(binary.BigEndian.Uint64(entry[5:13])),
+			size:   int64(binary.BigEndian.Uint64(entry[13:21])),
+		}
+		if e.offset < dataOffset || e.offset+e.size > size {
+			return fmt.Errorf("Truncated archive")
+		}
+		l.index[key] = e
+	}
+	return nil
+}
+
+// Close writes the archive if it was modified, and closes the
+// underlying files. Any writer not closed yet will fail to save its
+// data.
+func (l *ArchiveReplayFormatter) Close() error {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	if l.closed == true {
+		return fmt.Errorf("Archive %s already closed", l.filename)
+	}
+	l.closed = true
+
+	var err error
+	if l.modified == true {
+		err = l.write()
+	}
+	if l.spool != nil {
+		l.spool.Close()
+		os.Remove(l.spool.Name())
+	}
+	if l.file != nil {
+		l.file.Close()
+	}
+	return err
+}
+
+// write writes all the indexed data to a new archive, which replaces
+// the previous one.
+func (l *ArchiveReplayFormatter) write() error {
+	keys := make(archiveKeys, 0, len(l.index))
+	for key := range l.index {
+		if key.kind != archiveReplayData {
+			keys = append(keys, key)
+		}
+	}
+	sort.Sort(keys)
+	replayData := l.index[archiveKey{archiveReplayData, 0}]
+
+	header := make([]byte, archiveHeaderSize, archiveHeaderSize+int64(len(keys))*archiveEntrySize)
+	copy(header, archiveMagic)
+	fields := header[len(archiveMagic):]
+	binary.BigEndian.PutUint16(fields[0:2], archiveFormatVersion)
+	binary.BigEndian.PutUint64(fields[2:10], uint64(replayData.size))
+	binary.BigEndian.PutUint32(fields[10:14], uint32(len(keys)))
+
+	index := make([]byte, 0, int64(len(keys))*archiveEntrySize)
+	offset := archiveHeaderSize + replayData.size + int64(len(keys))*archiveEntrySize
+	for _, key := range keys {
+		e := l.index[key]
+		entry := make([]byte, archiveEntrySize)
+		entry[0] = byte(key.kind)
+		binary.BigEndian.PutUint32(entry[1:5], key.id)
+		binary.BigEndian.PutUint64(entry[5:13], uint64(offset))
+		binary.BigEndian.PutUint64(entry[13:21], uint64(e.size))
+		index = append(index, entry...)
+		offset += e.size
+	}
+
+	f, err := os.Create(l.filename + tmpSuffix)
+	if err != nil {
+		return fmt.Errorf("Could not write replay archive %s: %s", l.filename, err)
+	}
+	err = func() error {
+		if _, err := f.Write(header); err != nil {
+			return err
+		}
+		if replayData.size > 0 {
+			if _, err := io.Copy(f, replayData.reader()); err != nil {
+				return err
+			}
+		}
+		if _, err := f.Write(index); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if _, err := io.Copy(f, l.index[key].reader()); err != nil {
+				return err
+			}
+		}
+		return f.Close()
+	}()
+	if err == nil {
+		err = os.Rename(f.Name(), l.filename)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("Could not write replay archive %s: %s", l.filename, err)
+	}
+	l.modified = false
+	return nil
+}
+
+func (l *ArchiveReplayFormatter) has(key archiveKey) bool {
+	l.mx.RLock()
+	defer l.mx.RUnlock()
+	e, ok := l.index[key]
+	return ok == true && e.size > 0
+}
+
+func (l *ArchiveReplayFormatter) open(key archiveKey) (io.ReadCloser, error) {
+	l.mx.RLock()
+	defer l.mx.RUnlock()
+	if l.closed == true {
+		return nil, fmt.Errorf("Archive %s is closed", l.filename)
+	}
+	e, ok := l.index[key]
+	if ok == false {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(e.reader()), nil
+}
+
+// archiveWriter streams a record at the end of the spool file. The
+// record is indexed once closed.
+type archiveWriter struct {
+	archive  *ArchiveReplayFormatter
+	key      archiveKey
+	offset   int64
+	size     int64
+	err      error
+	isClosed bool
+}
+
+func (w *archiveWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.archive.spool.WriteAt(p, w.offset+w.size)
+	w.size += int64(n)
+	w.err = err
+	return n, err
+}
+
+func (w *archiveWriter) Close() error {
+	if w.isClosed == true {
+		return fmt.Errorf("Record already closed")
+	}
+	w.isClosed = true
+	defer w.archive.writing.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	return w.archive.commit(w.key, w.offset, w.size)
+}
+
+// commit indexes a record written in the spool file
+func (l *ArchiveReplayFormatter) commit(key archiveKey, offset, size int64) error {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	if l.closed == true {
+		return fmt.Errorf("Archive %s is closed", l.filename)
+	}
+	l.index[key] = archiveEntry{file: l.spool, offset: offset, size: size}
+	l.end = offset + size
+	l.modified = true
+	return nil
+}
+
+// create returns a writer for a record. Records are written one at a
+// time: it blocks until the previous writer is closed.
+func (l *ArchiveReplayFormatter) create(key archiveKey) (io.WriteCloser, error) {
+	l.writing.Lock()
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	if l.closed == true {
+		l.writing.Unlock()
+		return nil, fmt.Errorf("Archive %s is closed", l.filename)
+	}
+	if l.spool == nil {
+		spool, err := os.OpenFile(l.filename+archiveSpoolSuffix, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			l.writing.Unlock()
+			return nil, err
+		}
+		l.spool = spool
+	}
+	return &archiveWriter{archive: l, key: key, offset: l.end}, nil
+}
+
+// HasChunk returns true if data is available for a given Chunk
+func (l *ArchiveReplayFormatter) HasChunk(id ChunkID) bool {
+	return l.has(archiveKey{archiveChunk, uint32(id)})
+}
+
+// HasKeyFrame returns true if data is available for a given KeyFrame
+func (l *ArchiveReplayFormatter) HasKeyFrame(id KeyFrameID) bool {
+	return l.has(archiveKey{archiveKeyFrame, uint32(id)})
+}
+
+// HasEndOfGameStats returns true if data is available for End of Game
+// statistics
+func (l *ArchiveReplayFormatter) HasEndOfGameStats() bool {
+	return l.has(archiveKey{archiveEndOfGameStats, 0})
+}
+
+// OpenChunk returns a io.ReadCloser for reading data for a given
+// Chunk
+func (l *ArchiveReplayFormatter) OpenChunk(id ChunkID) (io.ReadCloser, error) {
+	return l.open(archiveKey{archiveChunk, uint32(id)})
+}
+
+// OpenKeyFrame returns a io.ReadCloser for reading data for a given
+// KeyFrame
+func (l *ArchiveReplayFormatter) OpenKeyFrame(id KeyFrameID) (io.ReadCloser, error) {
+	return l.open(archiveKey{archiveKeyFrame, uint32(id)})
+}
+
+// OpenEndOfGameStats returns a io.ReadCloser for reading data for the end
+// of game statistics
+func (l *ArchiveReplayFormatter) OpenEndOfGameStats() (io.ReadCloser, error) {
+	return l.open(archiveKey{archiveEndOfGameStats, 0})
+}
+
+// Open returns a io.ReadCloser for reading replay data
+func (l *ArchiveReplayFormatter) Open() (io.ReadCloser, error) {
+	return l.open(archiveKey{archiveReplayData, 0})
+}
+
+// CreateChunk returns a io.WriteCloser to write data for a given
+// Chunk. Data is available once it is closed.
+func (l *ArchiveReplayFormatter) CreateChunk(id ChunkID) (io.WriteCloser, error) {
+	return l.create(archiveKey{archiveChunk, uint32(id)})
+}
+
+// CreateKeyFrame returns a io.WriteCloser to write data for a given
+// KeyFrame. Data is available once it is closed.
+func (l *ArchiveReplayFormatter) CreateKeyFrame(id KeyFrameID) (io.WriteCloser, error) {
+	return l.create(archiveKey{archiveKeyFrame, uint32(id)})
+}
+
+// CreateEndOfGameStats returns a io.WriteCloser to write data for the
+// end of game statistics. Data is available once it is closed.
+func (l *ArchiveReplayFormatter) CreateEndOfGameStats() (io.WriteCloser, error) {
+	return l.create(archiveKey{archiveEndOfGameStats, 0})
+}
+
+// Create returns a io.WriteCloser to write replay data. Data is
+// available once it is closed.
+func (l *ArchiveReplayFormatter) Create() (io.WriteCloser, error) {
+	return l.create(archiveKey{archiveReplayData, 0})
+}
@@ -0,0 +1,192 @@
+package xlol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	. "gopkg.in/check.v1"
+)
+
+type ArchiveFormatSuite struct{}
+
+var _ = Suite(&ArchiveFormatSuite{})
+
+func (s *ArchiveFormatSuite) TestSavesAndLoadsReplay(c *C) {
+	filename := path.Join(c.MkDir(), "replay.glr")
+	original := newTestReplay(20, 30000)
+
+	archive, err := NewArchiveReplayFormatter(filename)
+	c.Assert(err, IsNil)
+	c.Assert(original.SaveWithData(archive), IsNil)
+	c.Assert(archive.Close(), IsNil)
+
+	archive, err = NewArchiveReplayFormatter(filename)
+	c.Assert(err, IsNil)
+	defer archive.Close()
+
+	c.Check(archive.HasChunk(20), Equals, true)
+	c.Check(archive.HasChunk(21), Equals, false)
+	c.Check(archive.HasKeyFrame(8), Equals, true)
+	c.Check(archive.HasEndOfGameStats(), Equals, true)
+
+	loaded, err := LoadReplayWithData(archive)
+	c.Assert(err, IsNil)
+	c.Check(loaded.MetaData, DeepEquals, original.MetaData)
+	c.Check(loaded.Chunks, DeepEquals, original.Chunks)
+	c.Check(loaded.KeyFrames, DeepEquals, original.KeyFrames)
+
+	f, err := archive.OpenEndOfGameStats()
+	c.Assert(err, IsNil)
+	data, err := ioutil.ReadAll(f)
+	c.Check(err, IsNil)
+	c.Check(string(data), Equals, "end of game stats")
+
+	_, err = archive.OpenChunk(21)
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *ArchiveFormatSuite) TestStoresReplayDataInHeader(c *C) {
+	filename := path.Join(c.MkDir(), "replay.glr")
+	original := newTestReplay(20, 30000)
+	archive, err := NewArchiveReplayFormatter(filename)
+	c.Assert(err, IsNil)
+	c.Assert(original.SaveWithData(archive), IsNil)
+	c.Assert(archive.Close(), IsNil)
+
+	content, err := ioutil.ReadFile(filename)
+	c.Assert(err, IsNil)
+	c.Assert(int64(len(content)) > archiveHeaderSize, Equals, true)
+	size := int64(binary.BigEndian.Uint64(content[len(archiveMagic)+2:]))
+	var replay Replay
+	c.Check(json.Unmarshal(content[archiveHeaderSize:archiveHeaderSize+size], &replay), IsNil)
+	c.Check(replay.MetaData, DeepEquals, original.MetaData)
+	count := int64(binary.BigEndian.Uint32(content[len(archiveMagic)+10:]))
+	// all Chunks, KeyFrames and the end of game stats are indexed
+	c.Check(count, Equals, int64(len(original.Chunks)+len(original.KeyFrames)+1))
+	_, err = os.Stat(filename + archiveSpoolSuffix)
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *ArchiveFormatSuite) TestCompactsSupersededData(c *C) {
+	filename := path.Join(c.MkDir(), "replay.glr")
+	archive, err := NewArchiveReplayFormatter(filename)
+	c.Assert(err, IsNil)
+
+	for _, content := range []string{"first", "second"} {
+		for _, create := range []func() (io.WriteCloser, error){
+			archive.Create,
+			func() (io.WriteCloser, error) { return archive.CreateChunk(3) },
+		} {
+			w, err := create()
+			c.Assert(err, IsNil)
+			w.Write([]byte(content))
+			c.Assert(w.Close(), IsNil)
+		}
+	}
+	c.Assert(archive.Close(), IsNil)
+
+	content, err := ioutil.ReadFile(filename)
+	c.Assert(err, IsNil)
+	c.Check(bytes.Contains(content, []byte("first")), Equals, false)
+	c.Check(int64(len(content)), Equals, archiveHeaderSize+archiveEntrySize+2*int64(len("second")))
+
+	archive, err = NewArchiveReplayFormatter(filename)
+	c.Assert(err, IsNil)
+	defer archive.Close()
+	for _, open := range []func() (io.ReadCloser, error){
+		archive.Open,
+		func() (io.ReadCloser, error) { return archive.OpenChunk(3) },
+	} {
+		f, err := open()
+		c.Assert(err, IsNil)
+		data, err := ioutil.ReadAll(f)
+		c.Check(err, IsNil)
+		c.Check(string(data), Equals, "second")
+	}
+}
+
+func (s *ArchiveFormatSuite) TestReadingDoesNotModifyArchive(c *C) {
+	filename := path.Join(c.MkDir(), "replay.glr")
+	original := newTestReplay(20, 30000)
+	archive, err := NewArchiveReplayFormatter(filename)
+	c.Assert(err, IsNil)
+	c.Assert(original.SaveWithData(archive), IsNil)
+	c.Assert(archive.Close(), IsNil)
+	content, err := ioutil.ReadFile(filename)
+	c.Assert(err, IsNil)
+
+	c.Assert(os.Chmod(filename, 0444), IsNil)
+	archive, err = NewArchiveReplayFormatter(filename)
+	c.Assert(err, IsNil)
+	_, err = LoadReplayWithData(archive)
+	c.Check(err, IsNil)
+	c.Assert(archive.Close(), IsNil)
+
+	after, err := ioutil.ReadFile(filename)
+	c.Assert(err, IsNil)
+	c.Check(after, DeepEquals, content)
+}
+
+func (s *ArchiveFormatSuite) TestInterruptedWriteKeepsArchive(c *C) {
+	filename := path.Join(c.MkDir(), "replay.glr")
+	archive, err := NewArchiveReplayFormatter(filename)
+	c.Assert(err, IsNil)
+	w, err := archive.CreateChunk(1)
+	c.Assert(err, IsNil)
+	w.Write([]byte("chunk 1 data"))
+	c.Assert(w.Close(), IsNil)
+	c.Assert(archive.Close(), IsNil)
+	content, err := ioutil.ReadFile(filename)
+	c.Assert(err, IsNil)
+
+	// the process stops before the archive is closed
+	archive, err = NewArchiveReplayFormatter(filename)
+	c.Assert(err, IsNil)
+	w, err = archive.CreateChunk(2)
+	c.Assert(err, IsNil)
+	w.Write([]byte("chunk 2 data"))
+	c.Check(archive.HasChunk(2), Equals, false)
+	c.Assert(w.Close(), IsNil)
+	c.Check(archive.HasChunk(2), Equals, true)
+
+	after, err := ioutil.ReadFile(filename)
+	c.Assert(err, IsNil)
+	c.Check(after, DeepEquals, content)
+
+	reopened, err := NewArchiveReplayFormatter(filename)
+	c.Assert(err, IsNil)
+	defer reopened.Close()
+	c.Check(reopened.HasChunk(1), Equals, true)
+	c.Check(reopened.HasChunk(2), Equals, false)
+}
+
+func (s *ArchiveFormatSuite) TestRejectsTruncatedArchive(c *C) {
+	filename := path.Join(c.MkDir(), "replay.glr")
+	archive, err := NewArchiveReplayFormatter(filename)
+	c.Assert(err, IsNil)
+	c.Assert(newTestReplay(20, 30000).SaveWithData(archive), IsNil)
+	c.Assert(archive.Close(), IsNil)
+
+	info, err := os.Stat(filename)
+	c.Assert(err, IsNil)
+	c.Assert(os.Truncate(filename, info.Size()-3), IsNil)
+
+	_, err = NewArchiveReplayFormatter(filename)
+	c.Check(err, ErrorMatches, "Could not load replay archive .*: Truncated archive")
+	info, err = os.Stat(filename)
+	c.Assert(err, IsNil)
+	c.Check(info.Size() > 0, Equals, true)
+}
+
+func (s *ArchiveFormatSuite) TestRejectsInvalidFile(c *C) {
+	filename := path.Join(c.MkDir(), "replay.glr")
+	c.Assert(ioutil.WriteFile(filename, []byte("this is not an archive"), 0644), IsNil)
+
+	_, err := NewArchiveReplayFormatter(filename)
+	c.Check(err, ErrorMatches, "Could not load replay archive .*: Not a go-lol replay archive")
+}
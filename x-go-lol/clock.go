@@ -0,0 +1,116 @@
+package xlol
+
+import (
+	"sync"
+	"time"
+)
+
+// A Clock tells the current time, and waits for time to pass. It lets
+// the ReplayServer and SpectateAPI timings be simulated in tests.
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// After sends the current time on the returned channel once d
+	// has elapsed
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// SystemClock is the Clock of the operating system
+var SystemClock Clock = systemClock{}
+
+type manualTimer struct {
+	deadline time.Time
+	c        chan time.Time
+}
+
+// A ManualClock is a Clock whose time only passes when it is
+// advanced. It is safe for concurrent use.
+type ManualClock struct {
+	mx     sync.Mutex
+	now    time.Time
+	timers []manualTimer
+}
+
+// NewManualClock returns a ManualClock set to now
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Now returns the current time of the clock
+func (c *ManualClock) Now() time.Time {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.now
+}
+
+// After returns a channel that receives the clock time once it is
+// advanced by d or more.
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	t := manualTimer{
+		deadline: c.now.Add(d),
+		c:        make(chan time.Time, 1),
+	}
+	if d <= 0 {
+		t.c <- c.now
+		return t.c
+	}
+	// keeps timers sorted by deadline
+	pos := len(c.timers)
+	for pos > 0 && c.timers[pos-1].deadline.After(t.deadline) {
+		pos--
+	}
+	c.timers = append(c.timers, manualTimer{})
+	copy(c.timers[pos+1:], c.timers[pos:])
+	c.timers[pos] = t
+	return t.c
+}
+
+// Advance moves the clock forward by d, and fires all the channels
+// whose deadline is reached.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.setTime(c.now.Add(d))
+}
+
+// AdvanceToNext moves the clock forward to the earliest deadline of
+// the pending After calls and fires it. It returns false if nothing
+// is waiting on the clock.
+func (c *ManualClock) AdvanceToNext() bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if len(c.timers) == 0 {
+		return false
+	}
+	c.setTime(c.timers[0].deadline)
+	return true
+}
+
+// Waiters returns the number of pending After calls
+func (c *ManualClock) Waiters() int {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return len(c.timers)
+}
+
+func (c *ManualClock) setTime(now time.Time) {
+	if now.After(c.now) {
+		c.now = now
+	}
+	for len(c.timers) > 0 && c.timers[0].deadline.After(c.now) == false {
+		c.timers[0].c <- c.now
+		c.timers = c.timers[1:]
+	}
+}
@@ -0,0 +1,46 @@
+package xlol
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type ManualClockSuite struct{}
+
+var _ = Suite(&ManualClockSuite{})
+
+func fired(ch <-chan time.Time) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *ManualClockSuite) TestFiresInDeadlineOrder(c *C) {
+	start := time.Date(2015, 7, 7, 12, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+
+	c.Check(fired(clock.After(0)), Equals, true)
+	c.Check(clock.AdvanceToNext(), Equals, false)
+
+	late := clock.After(2 * time.Minute)
+	early := clock.After(time.Minute)
+	c.Check(clock.Waiters(), Equals, 2)
+
+	clock.Advance(30 * time.Second)
+	c.Check(fired(early), Equals, false)
+	c.Check(clock.Now(), Equals, start.Add(30*time.Second))
+
+	c.Check(clock.AdvanceToNext(), Equals, true)
+	c.Check(clock.Now(), Equals, start.Add(time.Minute))
+	c.Check(fired(early), Equals, true)
+	c.Check(fired(late), Equals, false)
+
+	clock.Advance(5 * time.Minute)
+	c.Check(fired(late), Equals, true)
+	c.Check(clock.Waiters(), Equals, 0)
+	c.Check(clock.Now(), Equals, start.Add(6*time.Minute))
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path"
 	"regexp"
+	"strings"
 )
 
 // ExpandedReplayFormatter is a ReplayDataLoader that expand all its
@@ -61,6 +62,8 @@ const (
 	replayData = "replayData.json"
 	chunk      = "chunk"
 	keyframe   = "keyframe"
+	// suffix of the files being written
+	tmpSuffix = ".tmp"
 )
 
 type invalidFileError struct {
@@ -83,6 +86,9 @@ func (l *ExpandedReplayFormatter) checkCompatible(version string) error {
 var binRx = regexp.MustCompile(`\A([a-z]+)\.([0-9]{4})\.bin\z`)
 
 func (l *ExpandedReplayFormatter) checkFileName(filename string) error {
+	// files whose writing was interrupted are ignored, and
+	// overwritten by the next write
+	filename = strings.TrimSuffix(filename, tmpSuffix)
 	m := binRx.FindStringSubmatch(filename)
 	if len(m) != 0 {
 		if m[1] != chunk && m[1] != keyframe {
@@ -214,27 +220,68 @@ func (l *ExpandedReplayFormatter) OpenEndOfGameStats() (io.ReadCloser, error) {
 	return os.Open(l.endOfGamePath())
 }
 
+// atomicFile is written to a temporary file, that is renamed to its
+// final path once closed. The data is therefore never available
+// partially written, even if the process is interrupted.
+type atomicFile struct {
+	f    *os.File
+	path string
+	err  error
+}
+
+func createAtomicFile(filepath string) (io.WriteCloser, error) {
+	f, err := os.Create(filepath + tmpSuffix)
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{f: f, path: filepath}, nil
+}
+
+func (f *atomicFile) Write(p []byte) (int, error) {
+	n, err := f.f.Write(p)
+	if err != nil && f.err == nil {
+		f.err = err
+	}
+	return n, err
+}
+
+// Close closes the temporary file and renames it to its final path,
+// unless a write failed.
+func (f *atomicFile) Close() error {
+	err := f.f.Close()
+	if err == nil {
+		err = f.err
+	}
+	if err != nil {
+		os.Remove(f.f.Name())
+		return err
+	}
+	return os.Rename(f.f.Name(), f.path)
+}
+
 // CreateChunk returns a truncated io.WriteCloser to write data for a
-// given Chunk
+// given Chunk. The data is only available once it is closed.
 func (l *ExpandedReplayFormatter) CreateChunk(id ChunkID) (io.WriteCloser, error) {
-	return os.Create(l.chunkPath(id))
+	return createAtomicFile(l.chunkPath(id))
 }
 
 // CreateKeyFrame returns a truncated io.WriteCloser to write data for a
-// given KeyFrame
+// given KeyFrame. The data is only available once it is closed.
 func (l *ExpandedReplayFormatter) CreateKeyFrame(id KeyFrameID) (io.WriteCloser, error) {
-	return os.Create(l.keyFramePath(id))
+	return createAtomicFile(l.keyFramePath(id))
 }
 
 // CreateEndOfGameStats returns a truncated io.WriteCloser to write
-// data for the end of game statistics
+// data for the end of game statistics. The data is only available
+// once it is closed.
 func (l *ExpandedReplayFormatter) CreateEndOfGameStats() (io.WriteCloser, error) {
-	return os.Create(l.endOfGamePath())
+	return createAtomicFile(l.endOfGamePath())
 }
 
-// Create returns a truncatde io.WriteCloser to write replay data
+// Create returns a truncated io.WriteCloser to write replay data. The
+// data is only available once it is closed.
 func (l *ExpandedReplayFormatter) Create() (io.WriteCloser, error) {
-	return os.Create(l.dataPath())
+	return createAtomicFile(l.dataPath())
 }
 
 // Open returns a io.ReadCloser for reading replay data
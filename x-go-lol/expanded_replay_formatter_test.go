@@ -17,3 +17,30 @@ func (s *ExpandedFormatSuite) TestFilenameRegexp(c *C) {
 	}
 
 }
+
+func (s *ExpandedFormatSuite) TestDataIsAvailableOnceClosed(c *C) {
+	basedir := c.MkDir()
+	l, err := NewExpandedReplayFormatter(basedir)
+	c.Assert(err, IsNil)
+
+	w, err := l.CreateChunk(1)
+	c.Assert(err, IsNil)
+	_, err = w.Write([]byte("some data"))
+	c.Assert(err, IsNil)
+	c.Check(l.HasChunk(1), Equals, false)
+	c.Assert(w.Close(), IsNil)
+	c.Check(l.HasChunk(1), Equals, true)
+
+	// an interrupted write leaves a file that does not invalidate
+	// the directory
+	w, err = l.CreateKeyFrame(1)
+	c.Assert(err, IsNil)
+	_, err = w.Write([]byte("some data"))
+	c.Assert(err, IsNil)
+	_, err = NewExpandedReplayFormatter(basedir)
+	c.Check(err, IsNil)
+	c.Check(l.HasKeyFrame(1), Equals, false)
+	c.Check(l.checkFileName("keyframe.0001.bin.tmp"), IsNil)
+	c.Check(l.checkFileName("foo.tmp"), NotNil)
+	c.Assert(w.Close(), IsNil)
+}
@@ -0,0 +1,196 @@
+package xlol
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/atuleu/go-lol"
+)
+
+// A FeaturedGameFilter selects the featured games that should be
+// recorded. A game matches if it matches every non-empty criterion,
+// and it matches a criterion if it matches any of its values. An
+// empty FeaturedGameFilter matches all games.
+type FeaturedGameFilter struct {
+	Queues    []lol.QueueID
+	Maps      []lol.MapID
+	Champions []lol.ChampionID
+	// Players are Summoner names, compared case and space
+	// insensitively
+	Players []string
+}
+
+// normalizeSummonerName returns the name used by Riot to compare
+// Summoner names, i.e. lower cased without spaces
+func normalizeSummonerName(name string) string {
+	return strings.ToLower(strings.Replace(name, " ", "", -1))
+}
+
+// Match returns true if the game is selected by the filter
+func (f FeaturedGameFilter) Match(g lol.FeaturedGameInfo) bool {
+	if len(f.Queues) > 0 {
+		found := false
+		for _, q := range f.Queues {
+			if q == g.GameQueue {
+				found = true
+				break
+			}
+		}
+		if found == false {
+			return false
+		}
+	}
+
+	if len(f.Maps) > 0 {
+		found := false
+		for _, m := range f.Maps {
+			if m == g.Map {
+				found = true
+				break
+			}
+		}
+		if found == false {
+			return false
+		}
+	}
+
+	if len(f.Champions) > 0 {
+		found := false
+		for _, c := range f.Champions {
+			for _, p := range g.Participants {
+				if p.Champion == c {
+					found = true
+					break
+				}
+			}
+		}
+		if found == false {
+			return false
+		}
+	}
+
+	if len(f.Players) > 0 {
+		found := false
+		for _, name := range f.Players {
+			for _, p := range g.Participants {
+				if normalizeSummonerName(p.Name) == normalizeSummonerName(name) {
+					found = true
+					break
+				}
+			}
+		}
+		if found == false {
+			return false
+		}
+	}
+
+	return true
+}
+
+// featuredGameGetter is the part of a lol.APIEndpoint used to list
+// the featured games
+type featuredGameGetter interface {
+	GetFeaturedGames() (*lol.FeaturedGames, error)
+}
+
+// A FeaturedGameWatcher polls the featured games of a Region, and
+// records the one selected by its FeaturedGameFilter through a
+// ReplayRecorder.
+type FeaturedGameWatcher struct {
+	region   *lol.Region
+	api      featuredGameGetter
+	recorder *ReplayRecorder
+	Filter   FeaturedGameFilter
+
+	// minimal time between two polls, also used before retrying
+	// the first poll
+	minInterval time.Duration
+}
+
+const (
+	// featured games are polled at the interval given by the server,
+	// but not less than this
+	minFeaturedGamePollInterval time.Duration = 10 * time.Second
+	// interval to use when the server does not give any
+	defaultFeaturedGamePollInterval time.Duration = 5 * time.Minute
+)
+
+// NewFeaturedGameWatcher creates a new FeaturedGameWatcher for the
+// featured games returned by api, on region.
+func NewFeaturedGameWatcher(region *lol.Region, api *lol.APIEndpoint, recorder *ReplayRecorder) (*FeaturedGameWatcher, error) {
+	if api == nil {
+		return nil, fmt.Errorf("Empty API endpoint")
+	}
+	if recorder == nil {
+		return nil, fmt.Errorf("Empty replay recorder")
+	}
+	return &FeaturedGameWatcher{
+		region:      region,
+		api:         api,
+		recorder:    recorder,
+		minInterval: minFeaturedGamePollInterval,
+	}, nil
+}
+
+// poll checks once the featured games, starts recording the matching
+// ones and returns the time to wait before the next poll.
+func (w *FeaturedGameWatcher) poll(ctx context.Context) (time.Duration, error) {
+	games, err := w.api.GetFeaturedGames()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, g := range games.Games {
+		if w.Filter.Match(g) == false {
+			continue
+		}
+		if w.recorder.IsRecording(w.region, g.ID) == true {
+			continue
+		}
+		info, err := g.CurrentGameInfo()
+		if err != nil {
+			return 0, err
+		}
+		err = w.recorder.Record(ctx, w.region, info, 0)
+		if err != nil {
+			log.Printf("Could not record featured game %s/%d: %s", w.region.PlatformID(), g.ID, err)
+			continue
+		}
+		log.Printf("Recording featured game %s", info)
+	}
+
+	interval := time.Duration(games.RefrehInterval) * time.Second
+	if interval == 0 {
+		interval = defaultFeaturedGamePollInterval
+	}
+	if interval < w.minInterval {
+		interval = w.minInterval
+	}
+	return interval, nil
+}
+
+// Watch polls the featured games at the refresh interval given by the
+// server, and records every game selected by the Filter. A failed
+// poll is retried after the last refresh interval. It only returns
+// with ctx.Err() once ctx is cancelled. The recordings are
+// interrupted too.
+func (w *FeaturedGameWatcher) Watch(ctx context.Context) error {
+	interval := w.minInterval
+	for {
+		next, err := w.poll(ctx)
+		if err != nil {
+			log.Printf("Could not check featured games on %s: %s", w.region.PlatformID(), err)
+		} else {
+			interval = next
+		}
+		log.Printf("Next check for featured games at %s", time.Now().Add(interval))
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package xlol
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/atuleu/go-lol"
+	. "gopkg.in/check.v1"
+)
+
+type FeaturedGameWatcherSuite struct {
+	game lol.FeaturedGameInfo
+}
+
+var _ = Suite(&FeaturedGameWatcherSuite{})
+
+func (s *FeaturedGameWatcherSuite) SetUpSuite(c *C) {
+	gameJSON := `{
+  "gameId": 2200000000,
+  "gameQueueConfigId": 4,
+  "mapId": 11,
+  "platformId": "EUW1",
+  "participants": [
+    { "summonerName": "Some Player", "championId": 103, "teamId": 100 },
+    { "summonerName": "Another", "championId": 64, "teamId": 200 }
+  ]
+}`
+	c.Assert(json.Unmarshal([]byte(gameJSON), &s.game), IsNil)
+}
+
+func (s *FeaturedGameWatcherSuite) TestFilterMatching(c *C) {
+	testdata := []struct {
+		filter   FeaturedGameFilter
+		expected bool
+	}{
+		{FeaturedGameFilter{}, true},
+		{FeaturedGameFilter{Queues: []lol.QueueID{lol.RANKEDSOLO5x5}}, true},
+		{FeaturedGameFilter{Queues: []lol.QueueID{lol.ARAM5x5, lol.RANKEDSOLO5x5}}, true},
+		{FeaturedGameFilter{Queues: []lol.QueueID{lol.ARAM5x5}}, false},
+		{FeaturedGameFilter{Maps: []lol.MapID{11}}, true},
+		{FeaturedGameFilter{Maps: []lol.MapID{12}}, false},
+		{FeaturedGameFilter{Champions: []lol.ChampionID{1, 64}}, true},
+		{FeaturedGameFilter{Champions: []lol.ChampionID{1}}, false},
+		{FeaturedGameFilter{Players: []string{"someplayer"}}, true},
+		{FeaturedGameFilter{Players: []string{"ANOTHER"}}, true},
+		{FeaturedGameFilter{Players: []string{"nobody"}}, false},
+		{FeaturedGameFilter{Queues: []lol.QueueID{lol.RANKEDSOLO5x5}, Players: []string{"nobody"}}, false},
+		{FeaturedGameFilter{Queues: []lol.QueueID{lol.RANKEDSOLO5x5}, Maps: []lol.MapID{11}, Champions: []lol.ChampionID{103}}, true},
+	}
+
+	for _, d := range testdata {
+		c.Check(d.filter.Match(s.game), Equals, d.expected, Commentf("filter: %+v", d.filter))
+	}
+}
+
+// failingFeaturedGames fails the first request, and cancels the
+// watch on the second one
+type failingFeaturedGames struct {
+	mx     sync.Mutex
+	calls  int
+	cancel context.CancelFunc
+}
+
+func (f *failingFeaturedGames) GetFeaturedGames() (*lol.FeaturedGames, error) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	f.calls++
+	if f.calls == 1 {
+		return nil, fmt.Errorf("Too many requests")
+	}
+	f.cancel()
+	return &lol.FeaturedGames{}, nil
+}
+
+func (s *FeaturedGameWatcherSuite) TestRetriesFailedPoll(c *C) {
+	region, err := lol.NewRegionByCode("euw")
+	c.Assert(err, IsNil)
+	recorder, err := NewReplayRecorder(NewMemoryReplayManager(), 1)
+	c.Assert(err, IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	api := &failingFeaturedGames{cancel: cancel}
+	w := &FeaturedGameWatcher{
+		region:      region,
+		api:         api,
+		recorder:    recorder,
+		minInterval: 10 * time.Millisecond,
+	}
+
+	c.Check(w.Watch(ctx), Equals, context.Canceled)
+	api.mx.Lock()
+	defer api.mx.Unlock()
+	c.Check(api.calls, Equals, 2)
+}
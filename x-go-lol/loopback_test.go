@@ -0,0 +1,343 @@
+package xlol
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atuleu/go-lol"
+	. "gopkg.in/check.v1"
+)
+
+// newTestReplay builds a complete Replay with fake data, laid out like
+// the ones sent by the spectator servers: Chunks 1 to 5 are the
+// loading screen, and each KeyFrame spans two Chunks from Chunk 6 to
+// the end of the game at lastChunk, which must be even.
+func newTestReplay(lastChunk ChunkID, chunkDuration DurationMs) *Replay {
+	lastKeyFrame := KeyFrameID((lastChunk - 4) / 2)
+	start := time.Date(2015, 7, 7, 12, 29, 23, 0, time.UTC)
+
+	r := NewEmptyReplay()
+	r.Version = "1.82.89"
+	r.EncryptionKey = "some-encryption-key"
+	r.MetaData.GameKey.ID = 2190090792
+	r.MetaData.GameKey.PlatformID = "EUW1"
+	r.MetaData.ChunkTimeInterval = 30000
+	r.MetaData.StartTime = LolTime{start}
+	r.MetaData.EndStartupChunkID = 4
+	r.MetaData.StartGameChunkID = 6
+	r.MetaData.EndGameChunkID = int(lastChunk)
+	r.MetaData.EndGameKeyFrameID = int(lastKeyFrame)
+	r.MetaData.LastChunkID = int(lastChunk)
+	r.MetaData.LastKeyFrameID = int(lastKeyFrame)
+
+	for id := ChunkID(1); id <= lastChunk; id++ {
+		c := Chunk{
+			ChunkInfo: ChunkInfo{
+				ID:           id,
+				Duration:     chunkDuration,
+				ReceivedTime: LolTime{start.Add(time.Duration(id) * 30 * time.Second)},
+			},
+			data: []byte(fmt.Sprintf("chunk %d data", id)),
+		}
+		if id >= 6 {
+			c.KeyFrame = KeyFrameID((id - 4) / 2)
+		}
+		r.addChunk(c)
+	}
+
+	for id := KeyFrameID(1); id <= lastKeyFrame; id++ {
+		next := ChunkID(2*id + 4)
+		chunks := []ChunkID{next}
+		if next < lastChunk {
+			chunks = append(chunks, next+1)
+		}
+		r.addKeyFrame(KeyFrame{
+			KeyFrameInfo: KeyFrameInfo{
+				ID:           id,
+				ReceivedTime: LolTime{start.Add(time.Duration(next) * 30 * time.Second)},
+				NextChunkID:  next,
+			},
+			Chunks: chunks,
+			data:   []byte(fmt.Sprintf("keyframe %d data", id)),
+		})
+	}
+	r.endOfGameStats = []byte("end of game stats")
+	return r
+}
+
+type LoopbackSuite struct{}
+
+var _ = Suite(&LoopbackSuite{})
+
+// serveTestReplay serves original with a ReplayServer on a local
+// port. It returns the server, its base URL, and a function that
+// closes it.
+func serveTestReplay(c *C, original *Replay, timeDivisor DurationMs, clock Clock) (*ReplayServer, string, func()) {
+	served, err := NewExpandedReplayFormatter(c.MkDir())
+	c.Assert(err, IsNil)
+	c.Assert(original.SaveWithData(served), IsNil)
+
+	server, err := NewReplayServer(served)
+	c.Assert(err, IsNil)
+	server.TimeDivisor = timeDivisor
+	server.Clock = clock
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.Serve(l)
+	}()
+	return server, "http://" + l.Addr().String(), func() {
+		c.Check(server.Close(), IsNil)
+		c.Check(<-serverErr, IsNil)
+	}
+}
+
+// newTestSpectateAPI returns a SpectateAPI for the game of original,
+// served at baseURL
+func newTestSpectateAPI(c *C, original *Replay, baseURL string, clock Clock, options ...SpectateOption) *SpectateAPI {
+	region, err := lol.NewRegionByCode("euw")
+	c.Assert(err, IsNil)
+	options = append(options,
+		WithBaseURL(baseURL),
+		WithTimeout(5*time.Second),
+		WithClock(clock))
+	api, err := NewSpectateAPI(region, original.MetaData.GameKey.ID, options...)
+	c.Assert(err, IsNil)
+	return api
+}
+
+// recordTestReplay records the game of api, and returns the recorded
+// Replay and the formatter it was written to.
+func recordTestReplay(c *C, api *SpectateAPI, encryptionKey string) (*Replay, *ExpandedReplayFormatter) {
+	recorded, err := NewExpandedReplayFormatter(c.MkDir())
+	c.Assert(err, IsNil)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	replay, err := api.SpectateGame(ctx, encryptionKey, recorded)
+	c.Assert(err, IsNil)
+	return replay, recorded
+}
+
+// recordServedReplay serves original with a ReplayServer, and
+// records it with a SpectateAPI. It returns the recorded Replay, the
+// formatter it was written to, and the first Chunk streamed by the
+// server.
+func recordServedReplay(c *C, original *Replay, timeDivisor DurationMs, clock Clock, options ...SpectateOption) (*Replay, *ExpandedReplayFormatter, ChunkID) {
+	server, baseURL, closeServer := serveTestReplay(c, original, timeDivisor, clock)
+	defer closeServer()
+
+	api := newTestSpectateAPI(c, original, baseURL, clock, options...)
+	replay, recorded := recordTestReplay(c, api, server.EncryptionKey())
+	return replay, recorded, server.startStreamChunk
+}
+
+// checkRecordedReplay checks that replay and the data written to
+// recorded are identical to original
+func checkRecordedReplay(c *C, original, replay *Replay, recorded ReplayDataLoader, startStreamChunk ChunkID) {
+	c.Check(replay.Version, Equals, original.Version)
+	c.Check(replay.EncryptionKey, Equals, original.EncryptionKey)
+	c.Check(replay.MetaData.StartGameChunkID, Equals, original.MetaData.StartGameChunkID)
+	c.Check(replay.MetaData.EndGameChunkID, Equals, original.MetaData.EndGameChunkID)
+	c.Check(replay.endOfGameStats, DeepEquals, original.endOfGameStats)
+
+	c.Assert(replay.Chunks, HasLen, len(original.Chunks))
+	for i, expected := range original.Chunks {
+		chunk := replay.Chunks[i]
+		c.Check(chunk.ID, Equals, expected.ID)
+		c.Check(chunk.KeyFrame, Equals, expected.KeyFrame, Commentf("Chunk %d", expected.ID))
+		c.Check(chunk.data, DeepEquals, expected.data, Commentf("Chunk %d", expected.ID))
+		if expected.ID >= startStreamChunk {
+			c.Check(chunk.Duration, Equals, expected.Duration, Commentf("Chunk %d", expected.ID))
+		}
+	}
+
+	c.Assert(replay.KeyFrames, HasLen, len(original.KeyFrames))
+	for i, expected := range original.KeyFrames {
+		kf := replay.KeyFrames[i]
+		c.Check(kf.ID, Equals, expected.ID)
+		c.Check(kf.NextChunkID, Equals, expected.NextChunkID, Commentf("KeyFrame %d", expected.ID))
+		c.Check(kf.data, DeepEquals, expected.data, Commentf("KeyFrame %d", expected.ID))
+	}
+
+	// data is written as soon as it is downloaded
+	for _, chunk := range original.Chunks {
+		c.Check(recorded.HasChunk(chunk.ID), Equals, true, Commentf("Chunk %d", chunk.ID))
+	}
+	for _, kf := range original.KeyFrames {
+		c.Check(recorded.HasKeyFrame(kf.ID), Equals, true, Commentf("KeyFrame %d", kf.ID))
+	}
+}
+
+func (s *LoopbackSuite) TestRecordsServedReplay(c *C) {
+	original := newTestReplay(16, 300)
+	replay, recorded, startStreamChunk := recordServedReplay(c, original, 10, SystemClock,
+		WithMinPollInterval(10*time.Millisecond))
+	checkRecordedReplay(c, original, replay, recorded, startStreamChunk)
+}
+
+func (s *LoopbackSuite) TestRecordsFullGameWithManualClock(c *C) {
+	// a 30 minutes game, streamed in real time
+	original := newTestReplay(66, 30000)
+	clock := NewManualClock(time.Now())
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				clock.AdvanceToNext()
+			}
+		}
+	}()
+
+	start := clock.Now()
+	replay, recorded, startStreamChunk := recordServedReplay(c, original, 1, clock)
+	checkRecordedReplay(c, original, replay, recorded, startStreamChunk)
+	// the server streams one Chunk every 30s from Chunk 7 to 66
+	c.Check(clock.Now().Sub(start) >= 59*30*time.Second, Equals, true)
+}
+
+func (s *LoopbackSuite) TestResumesFromTruncatedChunk(c *C) {
+	original := newTestReplay(16, 300)
+	server, baseURL, closeServer := serveTestReplay(c, original, 10, SystemClock)
+	defer closeServer()
+
+	// a previous recording was interrupted while it was writing
+	// Chunk 5
+	recorded, err := NewExpandedReplayFormatter(c.MkDir())
+	c.Assert(err, IsNil)
+	partial := NewEmptyReplay()
+	partial.EncryptionKey = server.EncryptionKey()
+	c.Assert(partial.unsafeSave(recorded), IsNil)
+	for _, chunk := range original.Chunks[:4] {
+		c.Assert(partial.saveChunk(recorded, chunk), IsNil)
+	}
+	c.Assert(ioutil.WriteFile(recorded.chunkPath(5)+tmpSuffix, original.Chunks[4].data[:3], 0644), IsNil)
+	c.Check(recorded.HasChunk(5), Equals, false)
+
+	api := newTestSpectateAPI(c, original, baseURL, SystemClock, WithMinPollInterval(10*time.Millisecond))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	replay, err := api.SpectateGame(ctx, server.EncryptionKey(), recorded)
+	c.Assert(err, IsNil)
+	checkRecordedReplay(c, original, replay, recorded, server.startStreamChunk)
+
+	f, err := recorded.OpenChunk(5)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	c.Assert(err, IsNil)
+	c.Check(data, DeepEquals, original.Chunks[4].data)
+}
+
+// flakyProxy forwards requests to a spectator server, but answers
+// once with an HTTP 500 to the requests of the given paths
+type flakyProxy struct {
+	mx     sync.Mutex
+	proxy  http.Handler
+	failed map[string]bool
+}
+
+func (p *flakyProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mx.Lock()
+	failed, ok := p.failed[r.URL.Path]
+	if ok == true && failed == false {
+		p.failed[r.URL.Path] = true
+		p.mx.Unlock()
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	p.mx.Unlock()
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (s *LoopbackSuite) TestRetriesFailedDownloads(c *C) {
+	original := newTestReplay(16, 300)
+	server, baseURL, closeServer := serveTestReplay(c, original, 10, SystemClock)
+	defer closeServer()
+
+	target, err := url.Parse(baseURL)
+	c.Assert(err, IsNil)
+	api := newTestSpectateAPI(c, original, baseURL, SystemClock)
+	proxy := &flakyProxy{
+		proxy: httputil.NewSingleHostReverseProxy(target),
+		failed: map[string]bool{
+			strings.TrimPrefix(api.Format(GetGameDataChunk, 8), baseURL): false,
+			strings.TrimPrefix(api.Format(GetKeyFrame, 3), baseURL):      false,
+			strings.TrimPrefix(api.Format(GetGameMetaData, 1), baseURL):  false,
+		},
+	}
+	proxyServer := httptest.NewServer(proxy)
+	defer proxyServer.Close()
+
+	api = newTestSpectateAPI(c, original, proxyServer.URL, SystemClock, WithMinPollInterval(10*time.Millisecond))
+	replay, recorded := recordTestReplay(c, api, server.EncryptionKey())
+	checkRecordedReplay(c, original, replay, recorded, server.startStreamChunk)
+
+	proxy.mx.Lock()
+	defer proxy.mx.Unlock()
+	for p, failed := range proxy.failed {
+		c.Check(failed, Equals, true, Commentf("%s", p))
+	}
+}
+
+func (s *LoopbackSuite) TestStartsAtGameTime(c *C) {
+	original := newTestReplay(16, 30000)
+	_, err := original.AddBookmark("baron", 3*time.Minute)
+	c.Assert(err, IsNil)
+	formatter, err := NewExpandedReplayFormatter(c.MkDir())
+	c.Assert(err, IsNil)
+	c.Assert(original.SaveWithData(formatter), IsNil)
+	server, err := NewReplayServer(formatter)
+	c.Assert(err, IsNil)
+
+	c.Check(server.StartAtKeyFrame(42), ErrorMatches, "Unknown KeyFrame 42")
+	c.Check(server.StartAtGameTime(time.Hour), ErrorMatches, "Game time 1h0m0s is after the end of the game .*")
+	c.Check(server.StartAtBookmark("dragon"), ErrorMatches, "Unknown bookmark dragon")
+	c.Assert(server.StartAtBookmark("baron"), IsNil)
+	c.Check(server.startStreamChunk, Equals, ChunkID(12))
+	c.Assert(server.StartAtGameTime(2*time.Minute+15*time.Second), IsNil)
+	c.Check(server.startStreamChunk, Equals, ChunkID(10))
+
+	clock := NewManualClock(time.Date(2015, 7, 7, 12, 0, 0, 0, time.UTC))
+	server.Clock = clock
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.Serve(l)
+	}()
+	defer func() {
+		c.Check(server.Close(), IsNil)
+		c.Check(<-serverErr, IsNil)
+	}()
+
+	api := newTestSpectateAPI(c, original, "http://"+l.Addr().String(), clock)
+	var cInfo LastChunkInfo
+	c.Assert(api.Get(GetLastChunkInfo, 1, &cInfo), IsNil)
+	c.Check(cInfo.ID, Equals, ChunkID(10))
+	c.Check(cInfo.AssociatedKeyFrameID, Equals, KeyFrameID(3))
+	var metadata GameMetadata
+	c.Assert(api.Get(GetGameMetaData, 1, &metadata), IsNil)
+	c.Assert(metadata.PendingAvailableChunkInfo, HasLen, 1)
+	c.Check(metadata.PendingAvailableChunkInfo[0].ID, Equals, ChunkID(10))
+
+	// the beginning of the game can still be reached
+	c.Assert(server.SeekKeyFrame(1), IsNil)
+	status, err := server.Status()
+	c.Assert(err, IsNil)
+	c.Check(status.Chunk, Equals, ChunkID(6))
+}
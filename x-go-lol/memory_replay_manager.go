@@ -0,0 +1,267 @@
+package xlol
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/atuleu/go-lol"
+)
+
+// A MemoryReplayManager is a ReplayManager that keeps all its data in
+// memory. It is mostly meant for tests.
+type MemoryReplayManager struct {
+	mx      sync.Mutex
+	replays map[gameKey]*memoryReplayFormatter
+}
+
+// NewMemoryReplayManager creates an empty MemoryReplayManager
+func NewMemoryReplayManager() *MemoryReplayManager {
+	return &MemoryReplayManager{
+		replays: make(map[gameKey]*memoryReplayFormatter),
+	}
+}
+
+// Store saves all the Replay data.
+func (m *MemoryReplayManager) Store(r *Replay) error {
+	key := gameKey{platformID: r.MetaData.GameKey.PlatformID, id: r.MetaData.GameKey.ID}
+	m.mx.Lock()
+	formatter, ok := m.replays[key]
+	if ok == false {
+		formatter = newMemoryReplayFormatter()
+		m.replays[key] = formatter
+	}
+	m.mx.Unlock()
+	return r.SaveWithData(formatter)
+}
+
+func (m *MemoryReplayManager) get(region *lol.Region, id lol.GameID) (*memoryReplayFormatter, bool) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	formatter, ok := m.replays[gameKey{platformID: region.PlatformID(), id: id}]
+	return formatter, ok
+}
+
+// Get returns a ReplayDataLoader for a given lol.Region and
+// lol.GameID that is fully stored in the Manager.
+func (m *MemoryReplayManager) Get(region *lol.Region, id lol.GameID) (ReplayDataLoader, error) {
+	formatter, ok := m.get(region, id)
+	if ok == false {
+		return nil, fmt.Errorf("No replay for game %s/%d", region.PlatformID(), id)
+	}
+	if formatter.HasEndOfGameStats() == false {
+		return nil, fmt.Errorf("Requested game %s/%d is not finished, missing EndOfGameStats",
+			region.PlatformID(), id)
+	}
+	return formatter, nil
+}
+
+// Create returns a ReplayDataWriter for a replay identified by its
+// lol.Region and lol.GameID. It will fails if a replay already exists
+// for that Game.
+func (m *MemoryReplayManager) Create(region *lol.Region, id lol.GameID) (ReplayDataWriter, error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	key := gameKey{platformID: region.PlatformID(), id: id}
+	if _, ok := m.replays[key]; ok == true {
+		return nil, fmt.Errorf("Cannot create a replay for game %s/%d: some replay data already exists",
+			region.PlatformID(), id)
+	}
+	formatter := newMemoryReplayFormatter()
+	m.replays[key] = formatter
+	return formatter, nil
+}
+
+// sortedReplays returns the complete and incomplete replays, by region
+// code.
+func (m *MemoryReplayManager) sortedReplays() (map[string][]*Replay, map[string][]*Replay) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	complete := make(map[string][]*Replay)
+	incomplete := make(map[string][]*Replay)
+	for key, formatter := range m.replays {
+		region, err := lol.NewRegionByPlatformID(key.platformID)
+		if err != nil {
+			continue
+		}
+		r, ok, err := loadStoredReplay(formatter)
+		if err != nil {
+			continue
+		}
+		if ok == true {
+			complete[region.Code()] = append(complete[region.Code()], r)
+		} else {
+			incomplete[region.Code()] = append(incomplete[region.Code()], r)
+		}
+	}
+	for _, replays := range []map[string][]*Replay{complete, incomplete} {
+		for _, list := range replays {
+			sort.Sort(sort.Reverse(replayList(list)))
+		}
+	}
+	return complete, incomplete
+}
+
+// Replays return all Replay stored in the MemoryReplayManager
+func (m *MemoryReplayManager) Replays() map[string][]*Replay {
+	res, _ := m.sortedReplays()
+	return res
+}
+
+// IncompleteReplays returns all the replays whose recording was
+// interrupted.
+func (m *MemoryReplayManager) IncompleteReplays() map[string][]*Replay {
+	_, res := m.sortedReplays()
+	return res
+}
+
+// Resume returns a ReplayDataFormatter for a replay whose recording
+// was interrupted. It will fail if there is no such replay, or if the
+// replay is complete.
+func (m *MemoryReplayManager) Resume(region *lol.Region, id lol.GameID) (ReplayDataFormatter, error) {
+	formatter, ok := m.get(region, id)
+	if ok == false {
+		return nil, fmt.Errorf("No replay for game %s/%d", region.PlatformID(), id)
+	}
+	if _, complete, err := loadStoredReplay(formatter); err != nil {
+		return nil, fmt.Errorf("Could not resume replay for game %s/%d: %s", region.PlatformID(), id, err)
+	} else if complete == true {
+		return nil, fmt.Errorf("Replay for game %s/%d is complete", region.PlatformID(), id)
+	}
+	return formatter, nil
+}
+
+// Delete ensure that the replay is deleted from the manager.
+func (m *MemoryReplayManager) Delete(region *lol.Region, id lol.GameID) error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	delete(m.replays, gameKey{platformID: region.PlatformID(), id: id})
+	return nil
+}
+
+// CleanUp removes all replays whose data cannot be loaded.
+func (m *MemoryReplayManager) CleanUp() error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	for key, formatter := range m.replays {
+		if _, _, err := loadStoredReplay(formatter); err != nil {
+			delete(m.replays, key)
+		}
+	}
+	return nil
+}
+
+// memoryReplayFormatter is a ReplayDataFormatter that keeps its data
+// in memory
+type memoryReplayFormatter struct {
+	mx             sync.Mutex
+	replayData     []byte
+	endOfGameStats []byte
+	chunks         map[ChunkID][]byte
+	keyFrames      map[KeyFrameID][]byte
+}
+
+func newMemoryReplayFormatter() *memoryReplayFormatter {
+	return &memoryReplayFormatter{
+		chunks:    make(map[ChunkID][]byte),
+		keyFrames: make(map[KeyFrameID][]byte),
+	}
+}
+
+func (f *memoryReplayFormatter) open(data []byte, ok bool) (io.ReadCloser, error) {
+	if ok == false {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// bufferedWriter buffers data, which is saved once closed. It allows
+// several records to be written concurrently.
+type bufferedWriter struct {
+	bytes.Buffer
+	save     func(data []byte) error
+	isClosed bool
+}
+
+func (w *bufferedWriter) Close() error {
+	if w.isClosed == true {
+		return fmt.Errorf("Record already closed")
+	}
+	w.isClosed = true
+	return w.save(w.Bytes())
+}
+
+func (f *memoryReplayFormatter) create(save func(data []byte)) (io.WriteCloser, error) {
+	return &bufferedWriter{
+		save: func(data []byte) error {
+			f.mx.Lock()
+			defer f.mx.Unlock()
+			save(append([]byte{}, data...))
+			return nil
+		},
+	}, nil
+}
+
+func (f *memoryReplayFormatter) HasChunk(id ChunkID) bool {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	return len(f.chunks[id]) > 0
+}
+
+func (f *memoryReplayFormatter) HasKeyFrame(id KeyFrameID) bool {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	return len(f.keyFrames[id]) > 0
+}
+
+func (f *memoryReplayFormatter) HasEndOfGameStats() bool {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	return len(f.endOfGameStats) > 0
+}
+
+func (f *memoryReplayFormatter) Open() (io.ReadCloser, error) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	return f.open(f.replayData, f.replayData != nil)
+}
+
+func (f *memoryReplayFormatter) OpenChunk(id ChunkID) (io.ReadCloser, error) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	data, ok := f.chunks[id]
+	return f.open(data, ok)
+}
+
+func (f *memoryReplayFormatter) OpenKeyFrame(id KeyFrameID) (io.ReadCloser, error) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	data, ok := f.keyFrames[id]
+	return f.open(data, ok)
+}
+
+func (f *memoryReplayFormatter) OpenEndOfGameStats() (io.ReadCloser, error) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	return f.open(f.endOfGameStats, f.endOfGameStats != nil)
+}
+
+func (f *memoryReplayFormatter) Create() (io.WriteCloser, error) {
+	return f.create(func(data []byte) { f.replayData = data })
+}
+
+func (f *memoryReplayFormatter) CreateChunk(id ChunkID) (io.WriteCloser, error) {
+	return f.create(func(data []byte) { f.chunks[id] = data })
+}
+
+func (f *memoryReplayFormatter) CreateKeyFrame(id KeyFrameID) (io.WriteCloser, error) {
+	return f.create(func(data []byte) { f.keyFrames[id] = data })
+}
+
+func (f *memoryReplayFormatter) CreateEndOfGameStats() (io.WriteCloser, error) {
+	return f.create(func(data []byte) { f.endOfGameStats = data })
+}
@@ -0,0 +1,143 @@
+package xlol
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A MissingDataError is returned when some Chunks or KeyFrames could
+// not be downloaded before they aged out of the spectator window.
+type MissingDataError struct {
+	Chunks    []ChunkID
+	KeyFrames []KeyFrameID
+}
+
+// Error returns a textual representation of the MissingDataError
+func (e MissingDataError) Error() string {
+	parts := []string{}
+	if len(e.Chunks) > 0 {
+		ids := make([]string, 0, len(e.Chunks))
+		for _, id := range e.Chunks {
+			ids = append(ids, fmt.Sprintf("%d", id))
+		}
+		parts = append(parts, fmt.Sprintf("Chunks %s", strings.Join(ids, ",")))
+	}
+	if len(e.KeyFrames) > 0 {
+		ids := make([]string, 0, len(e.KeyFrames))
+		for _, id := range e.KeyFrames {
+			ids = append(ids, fmt.Sprintf("%d", id))
+		}
+		parts = append(parts, fmt.Sprintf("KeyFrames %s", strings.Join(ids, ",")))
+	}
+	return fmt.Sprintf("Could not recover %s", strings.Join(parts, " and "))
+}
+
+// missingData tracks the Chunks and KeyFrames the server could not
+// provide yet. They are retried until they age out of the spectator
+// window, i.e. until they are older than any Chunk or KeyFrame
+// advertised in the game metadata. Then they are considered lost.
+type missingData struct {
+	missing map[downloadJob]bool
+	lost    map[downloadJob]bool
+}
+
+func newMissingData() *missingData {
+	return &missingData{
+		missing: make(map[downloadJob]bool),
+		lost:    make(map[downloadJob]bool),
+	}
+}
+
+// add marks a job as missing, it will be retried.
+func (m *missingData) add(job downloadJob) {
+	m.missing[job] = true
+}
+
+// retries returns the missing jobs that should be retried according
+// to the spectator window of gm, and considers the other ones
+// lost. Returned jobs are not considered missing anymore, until they
+// are added again.
+func (m *missingData) retries(gm GameMetadata) []downloadJob {
+	oldestChunk := ChunkID(0)
+	for _, ci := range gm.PendingAvailableChunkInfo {
+		if oldestChunk == 0 || ci.ID < oldestChunk {
+			oldestChunk = ci.ID
+		}
+	}
+	oldestKeyFrame := KeyFrameID(0)
+	for _, kfi := range gm.PendingAvailableKeyFrameInfo {
+		if oldestKeyFrame == 0 || kfi.ID < oldestKeyFrame {
+			oldestKeyFrame = kfi.ID
+		}
+	}
+
+	res := make([]downloadJob, 0, len(m.missing))
+	for job := range m.missing {
+		delete(m.missing, job)
+		agedOut := false
+		switch job.function {
+		case GetGameDataChunk:
+			agedOut = oldestChunk > 0 && ChunkID(job.id) < oldestChunk
+		case GetKeyFrame:
+			agedOut = oldestKeyFrame > 0 && KeyFrameID(job.id) < oldestKeyFrame
+		}
+		if agedOut == true {
+			m.lost[job] = true
+			continue
+		}
+		res = append(res, job)
+	}
+	sort.Sort(downloadJobList(res))
+	return res
+}
+
+// giveUp considers all missing jobs lost
+func (m *missingData) giveUp() {
+	for job := range m.missing {
+		m.lost[job] = true
+		delete(m.missing, job)
+	}
+}
+
+// err returns a MissingDataError if any data is lost, nil otherwise
+func (m *missingData) err() error {
+	if len(m.lost) == 0 {
+		return nil
+	}
+	lost := make([]downloadJob, 0, len(m.lost))
+	for job := range m.lost {
+		lost = append(lost, job)
+	}
+	sort.Sort(downloadJobList(lost))
+
+	res := MissingDataError{}
+	for _, job := range lost {
+		switch job.function {
+		case GetGameDataChunk:
+			res.Chunks = append(res.Chunks, ChunkID(job.id))
+		case GetKeyFrame:
+			res.KeyFrames = append(res.KeyFrames, KeyFrameID(job.id))
+		}
+	}
+	return res
+}
+
+// A downloadJobList is a slice of downloadJob that implements
+// sort.Interface, KeyFrames are sorted before Chunks
+type downloadJobList []downloadJob
+
+func (l downloadJobList) Len() int {
+	return len(l)
+}
+
+func (l downloadJobList) Less(i, j int) bool {
+	if l[i].function == l[j].function {
+		return l[i].id < l[j].id
+	}
+	return l[i].function > l[j].function
+}
+
+func (l downloadJobList) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
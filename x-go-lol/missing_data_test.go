@@ -0,0 +1,36 @@
+package xlol
+
+import . "gopkg.in/check.v1"
+
+type MissingDataSuite struct{}
+
+var _ = Suite(&MissingDataSuite{})
+
+func (s *MissingDataSuite) TestRetriesUntilOutOfWindow(c *C) {
+	m := newMissingData()
+	c.Check(m.err(), IsNil)
+
+	m.add(downloadJob{GetGameDataChunk, 3})
+	m.add(downloadJob{GetGameDataChunk, 5})
+	m.add(downloadJob{GetKeyFrame, 2})
+
+	gm := GameMetadata{
+		PendingAvailableChunkInfo:    []ChunkInfo{{ID: 4}, {ID: 5}, {ID: 6}},
+		PendingAvailableKeyFrameInfo: []KeyFrameInfo{{ID: 2}, {ID: 3}},
+	}
+
+	c.Check(m.retries(gm), DeepEquals, []downloadJob{
+		{GetKeyFrame, 2},
+		{GetGameDataChunk, 5},
+	})
+	// retried jobs are not missing anymore
+	c.Check(m.retries(gm), HasLen, 0)
+
+	m.add(downloadJob{GetKeyFrame, 2})
+	m.giveUp()
+	c.Check(m.err(), DeepEquals, MissingDataError{
+		Chunks:    []ChunkID{3},
+		KeyFrames: []KeyFrameID{2},
+	})
+	c.Check(m.err(), ErrorMatches, "Could not recover Chunks 3 and KeyFrames 2")
+}
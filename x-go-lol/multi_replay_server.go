@@ -0,0 +1,263 @@
+package xlol
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atuleu/go-lol"
+)
+
+// A ReplayGetter gives access to stored replays. Any ReplayManager is
+// a ReplayGetter.
+type ReplayGetter interface {
+	Get(*lol.Region, lol.GameID) (ReplayDataLoader, error)
+}
+
+// A MultiReplayServer serves over http any replay of a ReplayGetter.
+// Requests are routed according to the platform and game ID of their
+// URL, and each game is streamed independently of the others, as by
+// its own ReplayServer. Streams that are not requested for
+// IdleTimeout are closed, and start again from the beginning if they
+// are requested later.
+//
+// The control API of a game is available under
+// ControlPrefix/<platformID>/<gameID>/, i.e.
+// /control/EUW1/2190090792/pause.
+type MultiReplayServer struct {
+	getter   ReplayGetter
+	listener net.Listener
+	quit     chan struct{}
+
+	mx      sync.Mutex
+	streams map[gameKey]*multiStream
+	closed  bool
+
+	// TimeDivisor is the initial TimeDivisor of each stream
+	TimeDivisor DurationMs
+	// Clock is used to stream the replays, it is SystemClock by
+	// default
+	Clock Clock
+	// IdleTimeout is the time after which a stream that is not
+	// requested is closed. Streams are never closed if it is zero.
+	IdleTimeout time.Duration
+	// Version is the spectator API version sent to the clients. As
+	// the version request does not tell which game it is for, it
+	// is the same for all games.
+	Version string
+}
+
+// a multiStream is a stream of a MultiReplayServer
+type multiStream struct {
+	server *ReplayServer
+	// last time the stream was requested
+	lastUsed time.Time
+}
+
+// NewMultiReplayServer creates a MultiReplayServer for the replays of
+// getter
+func NewMultiReplayServer(getter ReplayGetter) (*MultiReplayServer, error) {
+	if getter == nil {
+		return nil, fmt.Errorf("Empty replay getter")
+	}
+	return &MultiReplayServer{
+		getter:      getter,
+		quit:        make(chan struct{}),
+		streams:     make(map[gameKey]*multiStream),
+		TimeDivisor: 4,
+		Clock:       SystemClock,
+		IdleTimeout: 30 * time.Minute,
+	}, nil
+}
+
+// lookup returns the running ReplayServer of a game, if any, and
+// marks it as used. It must be called with mx locked.
+func (m *MultiReplayServer) lookup(key gameKey) (*ReplayServer, bool) {
+	s, ok := m.streams[key]
+	if ok == false {
+		return nil, false
+	}
+	s.lastUsed = m.Clock.Now()
+	return s.server, true
+}
+
+// Open returns the ReplayServer streaming a game, and starts it if
+// needed.
+func (m *MultiReplayServer) Open(region *lol.Region, id lol.GameID) (*ReplayServer, error) {
+	key := gameKey{platformID: region.PlatformID(), id: id}
+
+	m.mx.Lock()
+	h, ok := m.lookup(key)
+	closed := m.closed
+	m.mx.Unlock()
+	if closed == true {
+		return nil, ErrServerClosed
+	}
+	if ok == true {
+		return h, nil
+	}
+
+	// the replay is loaded without blocking the other streams
+	loader, err := m.getter.Get(region, id)
+	if err != nil {
+		return nil, err
+	}
+	h, err = NewReplayServer(loader)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if m.closed == true {
+		return nil, ErrServerClosed
+	}
+	// the game may have been opened by a concurrent request
+	if running, ok := m.lookup(key); ok == true {
+		return running, nil
+	}
+	h.TimeDivisor = m.TimeDivisor
+	h.Clock = m.Clock
+	h.start()
+	log.Printf("Opened stream of game %s/%d", key.platformID, key.id)
+	m.streams[key] = &multiStream{server: h, lastUsed: m.Clock.Now()}
+	return h, nil
+}
+
+// closeIdleStreams closes the streams that were not requested for
+// IdleTimeout
+func (m *MultiReplayServer) closeIdleStreams() {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	now := m.Clock.Now()
+	for key, s := range m.streams {
+		if now.Sub(s.lastUsed) < m.IdleTimeout {
+			continue
+		}
+		log.Printf("Closing idle stream of game %s/%d", key.platformID, key.id)
+		s.server.stop()
+		delete(m.streams, key)
+	}
+}
+
+// evictIdleStreams regularly closes idle streams, until quit is
+// closed
+func (m *MultiReplayServer) evictIdleStreams(period time.Duration) {
+	for {
+		select {
+		case <-m.quit:
+			return
+		case <-m.Clock.After(period):
+			m.closeIdleStreams()
+		}
+	}
+}
+
+// open returns the ReplayServer of a game from the platform and game
+// IDs of an URL
+func (m *MultiReplayServer) open(platformID, gameID string) (*ReplayServer, error) {
+	region, err := lol.NewRegionByPlatformID(platformID)
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.ParseUint(gameID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid game ID %s: %s", gameID, err)
+	}
+	return m.Open(region, lol.GameID(id))
+}
+
+func (m *MultiReplayServer) handle(w http.ResponseWriter, req *http.Request) {
+	URL := req.URL.Path
+
+	if strings.HasPrefix(URL, ControlPrefix) == true {
+		parts := strings.SplitN(strings.TrimPrefix(URL, ControlPrefix), "/", 3)
+		if len(parts) != 3 {
+			http.NotFound(w, req)
+			return
+		}
+		h, err := m.open(parts[0], parts[1])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		h.handleControl(parts[2], w, req)
+		return
+	}
+
+	if URL == Prefix+string(Version) {
+		if len(m.Version) == 0 {
+			http.Error(w, "No spectator version configured", http.StatusNotFound)
+			return
+		}
+		w.Header()["Content-Type"] = []string{"text/plain"}
+		if _, err := io.Copy(w, bytes.NewBufferString(m.Version)); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	if strings.HasPrefix(URL, Prefix) == false {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(URL, Prefix), "/")
+	if len(parts) < 3 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	h, err := m.open(parts[1], parts[2])
+	if err != nil {
+		log.Printf("Could not open replay for %s: %s", URL, err)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	h.handle(w, req)
+}
+
+// ListenAndServe starts an http server on the given address to show
+// the replays
+func (m *MultiReplayServer) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return m.Serve(l)
+}
+
+// Serve shows the replays over http to the connections accepted by
+// l. It returns once the MultiReplayServer is closed.
+func (m *MultiReplayServer) Serve(l net.Listener) error {
+	m.mx.Lock()
+	m.listener = l
+	idleTimeout := m.IdleTimeout
+	m.mx.Unlock()
+	if idleTimeout > 0 {
+		go m.evictIdleStreams(idleTimeout)
+	}
+	return serveHTTP(l, m.handle)
+}
+
+// Close stops a running MultiReplayServer and all its streams
+func (m *MultiReplayServer) Close() error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if m.listener == nil {
+		return fmt.Errorf("Server is not listening")
+	}
+	if m.closed == false {
+		close(m.quit)
+	}
+	m.closed = true
+	for _, s := range m.streams {
+		defer s.server.stop()
+	}
+	return m.listener.Close()
+}
@@ -0,0 +1,150 @@
+package xlol
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/atuleu/go-lol"
+	. "gopkg.in/check.v1"
+)
+
+// mapReplayGetter is a ReplayGetter backed by a map
+type mapReplayGetter map[lol.GameID]ReplayDataLoader
+
+func (g mapReplayGetter) Get(region *lol.Region, id lol.GameID) (ReplayDataLoader, error) {
+	if l, ok := g[id]; ok == true {
+		return l, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+type MultiReplayServerSuite struct {
+	region  *lol.Region
+	server  *MultiReplayServer
+	baseURL string
+	errors  chan error
+}
+
+var _ = Suite(&MultiReplayServerSuite{})
+
+func (s *MultiReplayServerSuite) SetUpTest(c *C) {
+	var err error
+	s.region, err = lol.NewRegionByCode("euw")
+	c.Assert(err, IsNil)
+
+	getter := mapReplayGetter{}
+	for _, id := range []lol.GameID{1001, 1002} {
+		r := newTestReplay(16, 30000)
+		r.MetaData.GameKey.ID = id
+		r.Version = "version-of-" + id.String()
+		formatter, err := NewExpandedReplayFormatter(c.MkDir())
+		c.Assert(err, IsNil)
+		c.Assert(r.SaveWithData(formatter), IsNil)
+		getter[id] = formatter
+	}
+
+	s.server, err = NewMultiReplayServer(getter)
+	c.Assert(err, IsNil)
+	s.server.TimeDivisor = 1
+	s.server.Clock = NewManualClock(time.Now())
+	// idle streams are closed explicitly by the tests
+	s.server.IdleTimeout = 0
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	s.baseURL = "http://" + l.Addr().String()
+	s.errors = make(chan error, 1)
+	go func() {
+		s.errors <- s.server.Serve(l)
+	}()
+	// waits for the server to be listening
+	resp, err := http.Get(s.baseURL)
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+}
+
+func (s *MultiReplayServerSuite) TearDownTest(c *C) {
+	c.Check(s.server.Close(), IsNil)
+	c.Check(<-s.errors, IsNil)
+}
+
+func (s *MultiReplayServerSuite) api(c *C, id lol.GameID) *SpectateAPI {
+	api, err := NewSpectateAPI(s.region, id, WithBaseURL(s.baseURL))
+	c.Assert(err, IsNil)
+	return api
+}
+
+func (s *MultiReplayServerSuite) TestServesGamesIndependently(c *C) {
+	first := s.api(c, 1001)
+	second := s.api(c, 1002)
+
+	var cInfo LastChunkInfo
+	c.Assert(first.Get(GetLastChunkInfo, 1, &cInfo), IsNil)
+	c.Check(cInfo.ID, Equals, ChunkID(6))
+
+	resp, err := http.PostForm(s.baseURL+ControlPrefix+"EUW1/1002/seek", url.Values{"keyframe": {"4"}})
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, Equals, http.StatusOK)
+
+	c.Assert(second.Get(GetLastChunkInfo, 1, &cInfo), IsNil)
+	c.Check(cInfo.ID, Equals, ChunkID(12))
+	c.Assert(first.Get(GetLastChunkInfo, 1, &cInfo), IsNil)
+	c.Check(cInfo.ID, Equals, ChunkID(6))
+
+	var data bytes.Buffer
+	c.Assert(second.ReadAll(GetGameDataChunk, 12, &data), IsNil)
+	c.Check(data.String(), Equals, "chunk 12 data")
+
+	unknown := s.api(c, 1003)
+	c.Check(unknown.Get(GetLastChunkInfo, 1, &cInfo), DeepEquals, lol.RESTError{Code: http.StatusNotFound})
+}
+
+func (s *MultiReplayServerSuite) TestAnswersConfiguredVersion(c *C) {
+	api := s.api(c, 1001)
+	_, err := api.Version()
+	c.Check(err, DeepEquals, lol.RESTError{Code: http.StatusNotFound})
+
+	s.server.Version = "1.82.89"
+	var cInfo LastChunkInfo
+	for _, id := range []lol.GameID{1002, 1001} {
+		c.Assert(s.api(c, id).Get(GetLastChunkInfo, 1, &cInfo), IsNil)
+		version, err := api.Version()
+		c.Assert(err, IsNil)
+		c.Check(version, Equals, "1.82.89")
+	}
+}
+
+func (s *MultiReplayServerSuite) TestClosesIdleStreams(c *C) {
+	clock := s.server.Clock.(*ManualClock)
+	s.server.mx.Lock()
+	s.server.IdleTimeout = time.Minute
+	s.server.mx.Unlock()
+
+	first, err := s.server.Open(s.region, 1001)
+	c.Assert(err, IsNil)
+	_, err = s.server.Open(s.region, 1002)
+	c.Assert(err, IsNil)
+
+	clock.Advance(40 * time.Second)
+	again, err := s.server.Open(s.region, 1001)
+	c.Assert(err, IsNil)
+	c.Check(again, Equals, first)
+
+	clock.Advance(40 * time.Second)
+	s.server.closeIdleStreams()
+	s.server.mx.Lock()
+	c.Check(s.server.streams, HasLen, 1)
+	s.server.mx.Unlock()
+
+	// a closed stream starts again when requested
+	clock.Advance(time.Minute)
+	s.server.closeIdleStreams()
+	again, err = s.server.Open(s.region, 1001)
+	c.Assert(err, IsNil)
+	c.Check(again, Not(Equals), first)
+}
@@ -0,0 +1,352 @@
+package xlol
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// a relaySnapshot is the state of the upstream game at a given date
+type relaySnapshot struct {
+	date     time.Time
+	metadata GameMetadata
+	cInfo    LastChunkInfo
+}
+
+// A RelayServer records a live game through a SpectateAPI, and serves
+// it at the same time with the spectator REST protocol, with a given
+// delay. Many local clients can then watch a game through a single
+// upstream connection.
+type RelayServer struct {
+	api           *SpectateAPI
+	encryptionKey string
+	formatter     ReplayDataFormatter
+	delay         time.Duration
+	listener      net.Listener
+
+	mx      sync.Mutex
+	version string
+	// snapshots of the upstream game, by date
+	snapshots []relaySnapshot
+	// data fully written by the recording
+	storedChunks    map[ChunkID]bool
+	storedKeyFrames map[KeyFrameID]bool
+	// the recording is finished, no more data will be available
+	complete bool
+
+	// Clock is used to delay the stream, it is SystemClock by
+	// default
+	Clock Clock
+}
+
+// NewRelayServer creates a RelayServer that records the game of api
+// through formatter, and serves it with the given delay.
+func NewRelayServer(api *SpectateAPI, encryptionKey string, formatter ReplayDataFormatter, delay time.Duration) (*RelayServer, error) {
+	if api == nil {
+		return nil, fmt.Errorf("Empty spectate API")
+	}
+	if formatter == nil {
+		return nil, fmt.Errorf("Empty replay formatter")
+	}
+	if delay < 0 {
+		return nil, fmt.Errorf("Invalid negative delay %s", delay)
+	}
+	return &RelayServer{
+		api:             api,
+		encryptionKey:   encryptionKey,
+		formatter:       formatter,
+		delay:           delay,
+		storedChunks:    make(map[ChunkID]bool),
+		storedKeyFrames: make(map[KeyFrameID]bool),
+		Clock:           SystemClock,
+	}, nil
+}
+
+// EncryptionKey returns the encryption key used to encrypt the game
+// data.
+func (r *RelayServer) EncryptionKey() string {
+	return r.encryptionKey
+}
+
+// Notify implements SpectateObserver, it records the state of the
+// upstream game and the data written so far.
+func (r *RelayServer) Notify(event SpectateEvent) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	switch e := event.(type) {
+	case MetadataUpdatedEvent:
+		r.snapshots = append(r.snapshots, relaySnapshot{
+			date:     r.Clock.Now(),
+			metadata: e.Metadata,
+			cInfo:    e.LastChunk,
+		})
+	case ChunkStoredEvent:
+		r.storedChunks[e.ID] = true
+	case KeyFrameStoredEvent:
+		r.storedKeyFrames[e.ID] = true
+	}
+}
+
+// Record records the game until its end, or until ctx is
+// cancelled. Any Observer of the SpectateAPI is still notified. Once
+// it returns, all the recorded data is served without waiting for
+// more. As SpectateAPI.SpectateGame, it returns the replay with a
+// MissingDataError if some data could not be recorded.
+func (r *RelayServer) Record(ctx context.Context) (*Replay, error) {
+	defer func() {
+		r.mx.Lock()
+		r.complete = true
+		r.mx.Unlock()
+	}()
+
+	version, err := r.api.Version()
+	if err != nil {
+		return nil, err
+	}
+	r.mx.Lock()
+	r.version = version
+	r.mx.Unlock()
+
+	previous := r.api.Observer
+	r.api.Observer = SpectateObserverFunc(func(event SpectateEvent) {
+		r.Notify(event)
+		if previous != nil {
+			previous.Notify(event)
+		}
+	})
+	defer func() {
+		r.api.Observer = previous
+	}()
+
+	replay, err := r.api.SpectateGame(ctx, r.encryptionKey, r.formatter)
+	if _, incomplete := err.(MissingDataError); err != nil && incomplete == false {
+		return nil, err
+	}
+	if serr := replay.saveEndOfGameStats(r.formatter); serr != nil {
+		return nil, serr
+	}
+	return replay, err
+}
+
+// recorded returns true if the data of every Chunk and KeyFrame
+// referenced by a snapshot is fully written. The upstream metadata is
+// updated before the data is downloaded, and the data is downloaded
+// in parallel. It must be called with mx locked.
+func (r *RelayServer) recorded(s relaySnapshot) bool {
+	for _, ci := range s.metadata.PendingAvailableChunkInfo {
+		if r.storedChunks[ci.ID] == false {
+			return false
+		}
+	}
+	for _, kfi := range s.metadata.PendingAvailableKeyFrameInfo {
+		if r.storedKeyFrames[kfi.ID] == false {
+			return false
+		}
+	}
+	if s.cInfo.ID > 0 && r.storedChunks[s.cInfo.ID] == false {
+		return false
+	}
+	if s.cInfo.AssociatedKeyFrameID > 0 && r.storedKeyFrames[s.cInfo.AssociatedKeyFrameID] == false {
+		return false
+	}
+	return true
+}
+
+// current returns the snapshot to serve now, i.e. the last one older
+// than the delay whose data is recorded. The end of the game is only
+// served once the recording is complete, so all its data is
+// available.
+func (r *RelayServer) current() (relaySnapshot, time.Duration, bool) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	now := r.Clock.Now()
+	idx := -1
+	for i, s := range r.snapshots {
+		if s.date.Add(r.delay).After(now) == true {
+			break
+		}
+		ended := s.cInfo.EndGameChunkID > 0 && s.cInfo.ID >= s.cInfo.EndGameChunkID
+		if ended == true && r.complete == false {
+			break
+		}
+		if r.complete == false && r.recorded(s) == false {
+			continue
+		}
+		idx = i
+	}
+	if idx < 0 {
+		return relaySnapshot{}, 0, false
+	}
+	// older snapshots will never be served again
+	r.snapshots = r.snapshots[idx:]
+	res := r.snapshots[0]
+	return res, now.Sub(res.date.Add(r.delay)), true
+}
+
+// Available returns true if the game can be watched by clients, i.e.
+// once the delay elapsed after the recording started.
+func (r *RelayServer) Available() bool {
+	_, _, ok := r.current()
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return ok == true && len(r.version) != 0
+}
+
+// checkParam checks that the URL parts are for the relayed game, and
+// returns its parameter
+func (r *RelayServer) checkParam(parts []string) (string, bool) {
+	if len(parts) < 4 {
+		return "", false
+	}
+	ok := parts[1] == r.api.region.PlatformID() &&
+		parts[2] == fmt.Sprintf("%d", r.api.id)
+	return parts[3], ok
+}
+
+func (r *RelayServer) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header()["Content-Type"] = []string{"application/json"}
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		panic(err)
+	}
+}
+
+func (r *RelayServer) copyData(w http.ResponseWriter, open func() (io.ReadCloser, error)) {
+	f, err := open()
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	w.Header()["Content-Type"] = []string{"application/octet-stream"}
+	if _, err := io.Copy(w, f); err != nil {
+		panic(err)
+	}
+}
+
+func (r *RelayServer) handle(w http.ResponseWriter, req *http.Request) {
+	log.Printf("Got relay request %s %s %s from %s", req.Proto, req.Method, req.URL.Path, req.RemoteAddr)
+
+	URL := req.URL.Path
+	if URL == Prefix+string(Version) {
+		r.mx.Lock()
+		version := r.version
+		r.mx.Unlock()
+		if len(version) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header()["Content-Type"] = []string{"text/plain"}
+		if _, err := io.Copy(w, bytes.NewBufferString(version)); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	if strings.HasPrefix(URL, Prefix) == false {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(URL, Prefix), "/")
+	param, ok := r.checkParam(parts)
+	if ok == false {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	function := SpectateFunction(parts[0])
+	if function == EndOfGameStats {
+		r.mx.Lock()
+		complete := r.complete
+		r.mx.Unlock()
+		if complete == false {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		r.copyData(w, r.formatter.OpenEndOfGameStats)
+		return
+	}
+
+	snapshot, late, ok := r.current()
+	if ok == false {
+		// nothing to serve yet
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	id, err := strconv.Atoi(param)
+	if err != nil && (function == GetGameDataChunk || function == GetKeyFrame) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch function {
+	case GetGameMetaData:
+		r.writeJSON(w, snapshot.metadata)
+	case GetLastChunkInfo:
+		cInfo := snapshot.cInfo
+		cInfo.AvailableSince += toDurationMs(late)
+		cInfo.NextAvailableChunk -= toDurationMs(late)
+		if cInfo.NextAvailableChunk < 0 {
+			cInfo.NextAvailableChunk = 0
+		}
+		r.writeJSON(w, cInfo)
+	case GetGameDataChunk:
+		// data more recent than the delayed state is not served
+		if ChunkID(id) > snapshot.cInfo.ID {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		r.copyData(w, func() (io.ReadCloser, error) {
+			return r.formatter.OpenChunk(ChunkID(id))
+		})
+	case GetKeyFrame:
+		if KeyFrameID(id) > snapshot.cInfo.AssociatedKeyFrameID {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		r.copyData(w, func() (io.ReadCloser, error) {
+			return r.formatter.OpenKeyFrame(KeyFrameID(id))
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// ListenAndServe starts an http server on the given address to relay
+// the game
+func (r *RelayServer) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return r.Serve(l)
+}
+
+// Serve relays the game over http to the connections accepted by
+// l. It returns once the RelayServer is closed.
+func (r *RelayServer) Serve(l net.Listener) error {
+	r.mx.Lock()
+	r.listener = l
+	r.mx.Unlock()
+	return serveHTTP(l, r.handle)
+}
+
+// Close stops a running RelayServer. It does not stop the recording.
+func (r *RelayServer) Close() error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if r.listener == nil {
+		return fmt.Errorf("Server is not listening")
+	}
+	return r.listener.Close()
+}
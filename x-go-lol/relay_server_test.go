@@ -0,0 +1,189 @@
+package xlol
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/atuleu/go-lol"
+	. "gopkg.in/check.v1"
+)
+
+type RelayServerSuite struct{}
+
+var _ = Suite(&RelayServerSuite{})
+
+// serveRelay serves relay on a local port. It returns its base URL,
+// and a function that closes it.
+func serveRelay(c *C, relay *RelayServer) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	errors := make(chan error, 1)
+	go func() {
+		errors <- relay.Serve(l)
+	}()
+	return "http://" + l.Addr().String(), func() {
+		c.Check(relay.Close(), IsNil)
+		c.Check(<-errors, IsNil)
+	}
+}
+
+func (s *RelayServerSuite) TestRelaysLiveGame(c *C) {
+	original := newTestReplay(16, 300)
+	upstream, upstreamURL, closeUpstream := serveTestReplay(c, original, 10, SystemClock)
+	defer closeUpstream()
+
+	formatter, err := NewExpandedReplayFormatter(c.MkDir())
+	c.Assert(err, IsNil)
+	upstreamAPI := newTestSpectateAPI(c, original, upstreamURL, SystemClock, WithMinPollInterval(10*time.Millisecond))
+	relay, err := NewRelayServer(upstreamAPI, upstream.EncryptionKey(), formatter, 0)
+	c.Assert(err, IsNil)
+	relayURL, closeRelay := serveRelay(c, relay)
+	defer closeRelay()
+
+	recordErr := make(chan error, 1)
+	go func() {
+		_, err := relay.Record(context.Background())
+		recordErr <- err
+	}()
+
+	for i := 0; relay.Available() == false; i++ {
+		if i > 200 {
+			c.Fatalf("Relayed game is not available")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	api := newTestSpectateAPI(c, original, relayURL, SystemClock, WithMinPollInterval(10*time.Millisecond))
+	replay, recorded := recordTestReplay(c, api, relay.EncryptionKey())
+	c.Check(<-recordErr, IsNil)
+	checkRecordedReplay(c, original, replay, recorded, upstream.startStreamChunk)
+}
+
+func (s *RelayServerSuite) TestDelaysUpstreamGame(c *C) {
+	original := newTestReplay(16, 30000)
+	formatter, err := NewExpandedReplayFormatter(c.MkDir())
+	c.Assert(err, IsNil)
+	c.Assert(original.SaveWithData(formatter), IsNil)
+
+	upstreamAPI := newTestSpectateAPI(c, original, "http://localhost:1", SystemClock)
+	relay, err := NewRelayServer(upstreamAPI, original.EncryptionKey, formatter, time.Minute)
+	c.Assert(err, IsNil)
+	clock := NewManualClock(time.Now())
+	relay.Clock = clock
+	relayURL, closeRelay := serveRelay(c, relay)
+	defer closeRelay()
+	api := newTestSpectateAPI(c, original, relayURL, SystemClock)
+
+	relay.Notify(MetadataUpdatedEvent{
+		Metadata:  original.MetaData,
+		LastChunk: LastChunkInfo{ID: 6, AssociatedKeyFrameID: 1, NextAvailableChunk: 20000},
+	})
+	relay.Notify(ChunkStoredEvent{ID: 6})
+	relay.Notify(KeyFrameStoredEvent{ID: 1})
+	clock.Advance(30 * time.Second)
+	relay.Notify(MetadataUpdatedEvent{
+		Metadata:  original.MetaData,
+		LastChunk: LastChunkInfo{ID: 7, AssociatedKeyFrameID: 1, NextAvailableChunk: 20000},
+	})
+
+	c.Check(relay.Available(), Equals, false)
+	var cInfo LastChunkInfo
+	c.Check(api.Get(GetLastChunkInfo, 1, &cInfo), DeepEquals, lol.RESTError{Code: http.StatusNotFound})
+
+	clock.Advance(35 * time.Second)
+	c.Assert(api.Get(GetLastChunkInfo, 1, &cInfo), IsNil)
+	c.Check(cInfo.ID, Equals, ChunkID(6))
+	c.Check(cInfo.AvailableSince, Equals, DurationMs(5000))
+	c.Check(cInfo.NextAvailableChunk, Equals, DurationMs(15000))
+
+	var data bytes.Buffer
+	c.Check(api.ReadAll(GetGameDataChunk, 6, &data), IsNil)
+	c.Check(data.String(), Equals, "chunk 6 data")
+	c.Check(api.ReadAll(GetGameDataChunk, 7, &data), DeepEquals, lol.RESTError{Code: http.StatusNotFound})
+	c.Check(api.ReadAll(EndOfGameStats, NullParam, &data), DeepEquals, lol.RESTError{Code: http.StatusNotFound})
+
+	// Chunk 7 is on disk, but not fully written yet
+	clock.Advance(30 * time.Second)
+	c.Assert(api.Get(GetLastChunkInfo, 1, &cInfo), IsNil)
+	c.Check(cInfo.ID, Equals, ChunkID(6))
+
+	relay.Notify(ChunkStoredEvent{ID: 7})
+	c.Assert(api.Get(GetLastChunkInfo, 1, &cInfo), IsNil)
+	c.Check(cInfo.ID, Equals, ChunkID(7))
+}
+
+func (s *RelayServerSuite) TestWaitsForAllSnapshotData(c *C) {
+	original := newTestReplay(16, 30000)
+	formatter, err := NewExpandedReplayFormatter(c.MkDir())
+	c.Assert(err, IsNil)
+	c.Assert(original.SaveWithData(formatter), IsNil)
+
+	upstreamAPI := newTestSpectateAPI(c, original, "http://localhost:1", SystemClock)
+	relay, err := NewRelayServer(upstreamAPI, original.EncryptionKey, formatter, 0)
+	c.Assert(err, IsNil)
+	relayURL, closeRelay := serveRelay(c, relay)
+	defer closeRelay()
+	api := newTestSpectateAPI(c, original, relayURL, SystemClock)
+
+	metadata := original.MetaData
+	for _, id := range []ChunkID{6, 7, 8} {
+		chunk, ok := original.ChunkByID(id)
+		c.Assert(ok, Equals, true)
+		metadata.PendingAvailableChunkInfo = append(metadata.PendingAvailableChunkInfo, chunk.ChunkInfo)
+	}
+	for _, id := range []KeyFrameID{1, 2} {
+		kf, ok := original.KeyFrameByID(id)
+		c.Assert(ok, Equals, true)
+		metadata.PendingAvailableKeyFrameInfo = append(metadata.PendingAvailableKeyFrameInfo, kf.KeyFrameInfo)
+	}
+	relay.Notify(MetadataUpdatedEvent{
+		Metadata:  metadata,
+		LastChunk: LastChunkInfo{ID: 8, AssociatedKeyFrameID: 2, NextAvailableChunk: 20000},
+	})
+
+	// the last Chunk and KeyFrame are written before the others
+	relay.Notify(ChunkStoredEvent{ID: 8})
+	relay.Notify(KeyFrameStoredEvent{ID: 2})
+	relay.Notify(ChunkStoredEvent{ID: 6})
+	var cInfo LastChunkInfo
+	c.Check(api.Get(GetLastChunkInfo, 1, &cInfo), DeepEquals, lol.RESTError{Code: http.StatusNotFound})
+
+	relay.Notify(ChunkStoredEvent{ID: 7})
+	c.Check(api.Get(GetLastChunkInfo, 1, &cInfo), DeepEquals, lol.RESTError{Code: http.StatusNotFound})
+	relay.Notify(KeyFrameStoredEvent{ID: 1})
+	c.Assert(api.Get(GetLastChunkInfo, 1, &cInfo), IsNil)
+	c.Check(cInfo.ID, Equals, ChunkID(8))
+}
+
+func (s *RelayServerSuite) TestServesEndOnceRecordingStops(c *C) {
+	original := newTestReplay(16, 30000)
+	formatter, err := NewExpandedReplayFormatter(c.MkDir())
+	c.Assert(err, IsNil)
+	c.Assert(original.SaveWithData(formatter), IsNil)
+
+	// the upstream server is not reachable, the recording fails
+	upstreamAPI := newTestSpectateAPI(c, original, "http://localhost:1", SystemClock, WithTimeout(time.Second))
+	relay, err := NewRelayServer(upstreamAPI, original.EncryptionKey, formatter, 0)
+	c.Assert(err, IsNil)
+	relayURL, closeRelay := serveRelay(c, relay)
+	defer closeRelay()
+	api := newTestSpectateAPI(c, original, relayURL, SystemClock)
+
+	relay.Notify(MetadataUpdatedEvent{
+		Metadata:  original.MetaData,
+		LastChunk: LastChunkInfo{ID: 16, AssociatedKeyFrameID: 7, EndGameChunkID: 16},
+	})
+	var cInfo LastChunkInfo
+	c.Check(api.Get(GetLastChunkInfo, 1, &cInfo), DeepEquals, lol.RESTError{Code: http.StatusNotFound})
+
+	_, err = relay.Record(context.Background())
+	c.Check(err, NotNil)
+
+	c.Assert(api.Get(GetLastChunkInfo, 1, &cInfo), IsNil)
+	c.Check(cInfo.ID, Equals, ChunkID(16))
+	var data bytes.Buffer
+	c.Check(api.ReadAll(EndOfGameStats, NullParam, &data), IsNil)
+}
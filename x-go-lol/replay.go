@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"reflect"
 	"sort"
+	"time"
 
 	"github.com/atuleu/go-lol"
 )
@@ -114,6 +115,20 @@ type Replay struct {
 
 	// PlayerOfInterest
 	PlayerOfInterest lol.SummonerID
+
+	// MissingChunks and MissingKeyFrames are the data that could not
+	// be downloaded while recording
+	MissingChunks    []ChunkID
+	MissingKeyFrames []KeyFrameID
+
+	// Tags, Notes and Bookmarks are defined by the user
+	Tags      []string
+	Notes     string
+	Bookmarks []Bookmark
+
+	// ClippedFrom is the ID of the game a clip was cut from, it is
+	// zero if the Replay is not a clip
+	ClippedFrom lol.GameID
 }
 
 // NewEmptyReplay creates a new empty replay
@@ -352,10 +367,34 @@ func (r *Replay) Consolidate() {
 	}
 }
 
+// isMissingChunk returns true if the data of a Chunk could not be
+// recorded
+func (r *Replay) isMissingChunk(id ChunkID) bool {
+	for _, missing := range r.MissingChunks {
+		if missing == id {
+			return true
+		}
+	}
+	return false
+}
+
+// isMissingKeyFrame returns true if the data of a KeyFrame could not
+// be recorded
+func (r *Replay) isMissingKeyFrame(id KeyFrameID) bool {
+	for _, missing := range r.MissingKeyFrames {
+		if missing == id {
+			return true
+		}
+	}
+	return false
+}
+
 // check is checking for integrity of all Replay data, i.e. that all
 // data is loaded in memory or is accessible through the given
 // loader. Passing a nil loader, will ensure that all required data is
-// loaded in memory
+// loaded in memory. The Chunks and KeyFrames that could not be
+// recorded, i.e. MissingChunks and MissingKeyFrames, are not
+// required.
 func (r *Replay) check(loader ReplayDataLoader) error {
 	if len(r.Chunks) == 0 {
 		return nil
@@ -373,7 +412,7 @@ func (r *Replay) check(loader ReplayDataLoader) error {
 			}
 		}
 
-		if len(c.data) == 0 {
+		if len(c.data) == 0 && r.isMissingChunk(c.ID) == false {
 			if loader == nil {
 				return fmt.Errorf("Data for chunk %d is not loaded, and no loader defined", c.ID)
 			}
@@ -386,6 +425,10 @@ func (r *Replay) check(loader ReplayDataLoader) error {
 			continue
 		}
 
+		if r.isMissingKeyFrame(c.KeyFrame) == true {
+			continue
+		}
+
 		kfIdx, ok := r.keyframeByID[c.KeyFrame]
 		if ok == false {
 			return fmt.Errorf("Missing metadata for Keyframe %d (associated with chunk %d)", c.KeyFrame, c.ID)
@@ -457,6 +500,151 @@ func (r *Replay) loadKeyFrame(loader ReplayDataLoader, id KeyFrameID) error {
 	return nil
 }
 
+// loadAvailableData is loading in memory all binary data available
+// through loader, and adds any Chunk or KeyFrame that has data but is
+// not yet known by the Replay. It is used to resume the recording of a
+// Replay.
+func (r *Replay) loadAvailableData(loader ReplayDataLoader) error {
+	maxChunkID := ChunkID(0)
+	if len(r.Chunks) > 0 {
+		maxChunkID = r.Chunks[len(r.Chunks)-1].ID
+	}
+	for id := ChunkID(1); id <= maxChunkID+1 || loader.HasChunk(id) == true; id++ {
+		if loader.HasChunk(id) == false {
+			continue
+		}
+		r.addChunk(Chunk{ChunkInfo: ChunkInfo{ID: id}})
+		if err := r.loadChunk(loader, id); err != nil {
+			return err
+		}
+	}
+
+	maxKeyFrameID := KeyFrameID(0)
+	if len(r.KeyFrames) > 0 {
+		maxKeyFrameID = r.KeyFrames[len(r.KeyFrames)-1].ID
+	}
+	for id := KeyFrameID(1); id <= maxKeyFrameID+1 || loader.HasKeyFrame(id) == true; id++ {
+		if loader.HasKeyFrame(id) == false {
+			continue
+		}
+		r.addKeyFrame(KeyFrame{KeyFrameInfo: KeyFrameInfo{ID: id}})
+		if err := r.loadKeyFrame(loader, id); err != nil {
+			return err
+		}
+	}
+
+	if loader.HasEndOfGameStats() == false {
+		return nil
+	}
+	reader, err := loader.OpenEndOfGameStats()
+	if err != nil {
+		return fmt.Errorf("Could not open End Of Game Stat: %s", err)
+	}
+	defer reader.Close()
+	r.endOfGameStats, err = ioutil.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("Could not read end of game stat data: %s", err)
+	}
+	return nil
+}
+
+func (r *Replay) hasChunkData(id ChunkID) bool {
+	c, ok := r.ChunkByID(id)
+	return ok == true && len(c.data) > 0
+}
+
+func (r *Replay) hasKeyFrameData(id KeyFrameID) bool {
+	kf, ok := r.KeyFrameByID(id)
+	return ok == true && len(kf.data) > 0
+}
+
+// dataCount returns the number of Chunks and KeyFrames whose data is
+// available
+func (r *Replay) dataCount() (int, int) {
+	chunks, keyframes := 0, 0
+	for _, c := range r.Chunks {
+		if len(c.data) > 0 {
+			chunks++
+		}
+	}
+	for _, kf := range r.KeyFrames {
+		if len(kf.data) > 0 {
+			keyframes++
+		}
+	}
+	return chunks, keyframes
+}
+
+// GameTime returns the game time at the end of the Chunk id. Chunks
+// of the loading screen are not counted, and the Chunks whose
+// duration is unknown are supposed to last ChunkTimeInterval.
+func (r *Replay) GameTime(id ChunkID) time.Duration {
+	res := time.Duration(0)
+	for _, c := range r.Chunks {
+		if c.ID > id {
+			break
+		}
+		if int(c.ID) < r.MetaData.StartGameChunkID {
+			continue
+		}
+		d := c.Duration.Duration()
+		if d == 0 {
+			d = r.MetaData.ChunkTimeInterval.Duration()
+		}
+		res += d
+	}
+	return res
+}
+
+// GameDuration returns the game time at the end of the last Chunk of
+// the Replay
+func (r *Replay) GameDuration() time.Duration {
+	if len(r.Chunks) == 0 {
+		return 0
+	}
+	return r.GameTime(r.Chunks[len(r.Chunks)-1].ID)
+}
+
+// KeyFrameAt returns the KeyFrame to start from to watch the game at
+// game time t, i.e. the last KeyFrame that starts before t.
+func (r *Replay) KeyFrameAt(t time.Duration) (KeyFrameID, error) {
+	if len(r.KeyFrames) == 0 {
+		return 0, fmt.Errorf("Replay has no KeyFrame")
+	}
+	if t < 0 {
+		return 0, fmt.Errorf("Invalid negative game time %s", t)
+	}
+
+	startingAt := make(map[ChunkID]KeyFrameID, len(r.KeyFrames))
+	for _, kf := range r.KeyFrames {
+		startingAt[kf.NextChunkID] = kf.ID
+	}
+
+	res := r.KeyFrames[0].ID
+	elapsed := time.Duration(0)
+	for _, c := range r.Chunks {
+		if int(c.ID) < r.MetaData.StartGameChunkID {
+			continue
+		}
+		if elapsed > t {
+			break
+		}
+		if id, ok := startingAt[c.ID]; ok == true {
+			res = id
+		}
+		d := c.Duration.Duration()
+		if d == 0 {
+			d = r.MetaData.ChunkTimeInterval.Duration()
+		}
+		elapsed += d
+	}
+
+	if t > elapsed {
+		return 0, fmt.Errorf("Game time %s is after the end of the game (%s)", t, elapsed)
+	}
+	return res, nil
+}
+
 // LoadData is loading in memory all binary data of Replay (KeyFrame,
 // Chunk and EndOfGameStats) through a ReplayDataLoader
 func (r *Replay) LoadData(loader ReplayDataLoader) error {
@@ -464,11 +652,13 @@ func (r *Replay) LoadData(loader ReplayDataLoader) error {
 		return err
 	}
 	for _, c := range r.Chunks {
-		if err := r.loadChunk(loader, c.ID); err != nil {
-			return err
+		if r.isMissingChunk(c.ID) == false {
+			if err := r.loadChunk(loader, c.ID); err != nil {
+				return err
+			}
 		}
 
-		if c.isAssociated() == false {
+		if c.isAssociated() == false || r.isMissingKeyFrame(c.KeyFrame) == true {
 			continue
 		}
 
@@ -494,9 +684,12 @@ func (r *Replay) saveChunk(writer ReplayDataWriter, c Chunk) error {
 	if err != nil {
 		return fmt.Errorf("Could not create Chunk %d: %s", c.ID, err)
 	}
-	defer w.Close()
 	_, err = io.Copy(w, bytes.NewBuffer(c.data))
 	if err != nil {
+		w.Close()
+		return fmt.Errorf("Could not write Chunk %d data: %s", c.ID, err)
+	}
+	if err := w.Close(); err != nil {
 		return fmt.Errorf("Could not write Chunk %d data: %s", c.ID, err)
 	}
 	return nil
@@ -507,9 +700,12 @@ func (r *Replay) saveKeyFrame(writer ReplayDataWriter, kf KeyFrame) error {
 	if err != nil {
 		return fmt.Errorf("Could not create KeyFrame %d: %s", kf.ID, err)
 	}
-	defer w.Close()
 	_, err = io.Copy(w, bytes.NewBuffer(kf.data))
 	if err != nil {
+		w.Close()
+		return fmt.Errorf("Could not write KeyFrame %d data: %s", kf.ID, err)
+	}
+	if err := w.Close(); err != nil {
 		return fmt.Errorf("Could not write KeyFrame %d data: %s", kf.ID, err)
 	}
 	return nil
@@ -522,11 +718,13 @@ func (r *Replay) SaveData(writer ReplayDataWriter) error {
 	}
 
 	for _, c := range r.Chunks {
-		if err := r.saveChunk(writer, c); err != nil {
-			return err
+		if r.isMissingChunk(c.ID) == false {
+			if err := r.saveChunk(writer, c); err != nil {
+				return err
+			}
 		}
 
-		if c.isAssociated() == false {
+		if c.isAssociated() == false || r.isMissingKeyFrame(c.KeyFrame) == true {
 			continue
 		}
 
@@ -540,13 +738,20 @@ func (r *Replay) SaveData(writer ReplayDataWriter) error {
 		}
 	}
 
+	return r.saveEndOfGameStats(writer)
+}
+
+func (r *Replay) saveEndOfGameStats(writer ReplayDataWriter) error {
 	w, err := writer.CreateEndOfGameStats()
 	if err != nil {
 		return fmt.Errorf("Could not create end of game stat data: %s", err)
 	}
-	defer w.Close()
 	_, err = io.Copy(w, bytes.NewBuffer(r.endOfGameStats))
 	if err != nil {
+		w.Close()
+		return fmt.Errorf("Could not write end of game stat data: %s", err)
+	}
+	if err := w.Close(); err != nil {
 		return fmt.Errorf("Could not write end of game stat data: %s", err)
 	}
 	return nil
@@ -566,9 +771,9 @@ func (r *Replay) rebuildKeyFramesMap() {
 	}
 }
 
-// LoadReplay is loading the Replay data (without loading binary data
-// like KeyFrame, Chunk and EndOfGameStats) from a ReplayDataLoader
-func LoadReplay(loader ReplayDataLoader) (*Replay, error) {
+// loadPartialReplay is loading the Replay data from a
+// ReplayDataLoader, without checking for its completeness.
+func loadPartialReplay(loader ReplayDataLoader) (*Replay, error) {
 	if loader == nil {
 		return nil, fmt.Errorf("Empty data loader")
 	}
@@ -585,6 +790,16 @@ func LoadReplay(loader ReplayDataLoader) (*Replay, error) {
 	}
 	res.rebuildChunksMap()
 	res.rebuildKeyFramesMap()
+	return res, nil
+}
+
+// LoadReplay is loading the Replay data (without loading binary data
+// like KeyFrame, Chunk and EndOfGameStats) from a ReplayDataLoader
+func LoadReplay(loader ReplayDataLoader) (*Replay, error) {
+	res, err := loadPartialReplay(loader)
+	if err != nil {
+		return nil, err
+	}
 
 	err = res.check(loader)
 	if err != nil {
@@ -604,9 +819,11 @@ func LoadReplayWithData(loader ReplayDataLoader) (*Replay, error) {
 }
 
 // Save is writing all Replay data (without binary data like KeyFrame,
-// Chunk and EndOfGameStats) through a ReplayDataWriter
+// Chunk and EndOfGameStats) through a ReplayDataWriter. The binary
+// data must be loaded, or already written through writer.
 func (r *Replay) Save(writer ReplayDataWriter) error {
-	if err := r.check(nil); err != nil {
+	loader, _ := writer.(ReplayDataLoader)
+	if err := r.check(loader); err != nil {
 		return fmt.Errorf("Could not save replay: %s", err)
 	}
 	return r.unsafeSave(writer)
@@ -618,9 +835,12 @@ func (r *Replay) unsafeSave(writer ReplayDataWriter) error {
 	if err != nil {
 		return err
 	}
-	defer w.Close()
 	enc := json.NewEncoder(w)
-	return enc.Encode(r)
+	if err := enc.Encode(r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
 }
 
 // SaveWithData is writing all of Replay data through a
@@ -0,0 +1,161 @@
+package xlol
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/atuleu/go-lol"
+)
+
+// A Bookmark marks a moment of a Replay. It is mapped to the Chunk
+// played at that moment, and to the KeyFrame a ReplayServer starts
+// from to show it.
+type Bookmark struct {
+	Name     string
+	GameTime DurationMs
+	Chunk    ChunkID
+	KeyFrame KeyFrameID
+}
+
+// ChunkAt returns the Chunk played at game time t
+func (r *Replay) ChunkAt(t time.Duration) (ChunkID, error) {
+	if t < 0 {
+		return 0, fmt.Errorf("Invalid negative game time %s", t)
+	}
+	elapsed := time.Duration(0)
+	var last ChunkID = -1
+	for _, c := range r.Chunks {
+		if int(c.ID) < r.MetaData.StartGameChunkID {
+			continue
+		}
+		d := c.Duration.Duration()
+		if d == 0 {
+			d = r.MetaData.ChunkTimeInterval.Duration()
+		}
+		elapsed += d
+		last = c.ID
+		if t < elapsed {
+			return c.ID, nil
+		}
+	}
+	if last >= 0 && t == elapsed {
+		return last, nil
+	}
+	return 0, fmt.Errorf("Game time %s is after the end of the game (%s)", t, elapsed)
+}
+
+// AddTag tags the Replay. Tags are unique.
+func (r *Replay) AddTag(tag string) {
+	for _, t := range r.Tags {
+		if t == tag {
+			return
+		}
+	}
+	r.Tags = append(r.Tags, tag)
+}
+
+// RemoveTag removes a tag from the Replay. It returns false if the
+// Replay was not tagged with it.
+func (r *Replay) RemoveTag(tag string) bool {
+	for i, t := range r.Tags {
+		if t == tag {
+			r.Tags = append(r.Tags[:i], r.Tags[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// HasTag returns true if the Replay is tagged with tag
+func (r *Replay) HasTag(tag string) bool {
+	for _, t := range r.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// AddBookmark bookmarks the game time t under name, which must be
+// unique.
+func (r *Replay) AddBookmark(name string, t time.Duration) (Bookmark, error) {
+	if len(name) == 0 {
+		return Bookmark{}, fmt.Errorf("Empty bookmark name")
+	}
+	if _, ok := r.BookmarkByName(name); ok == true {
+		return Bookmark{}, fmt.Errorf("Bookmark %s already exists", name)
+	}
+	chunk, err := r.ChunkAt(t)
+	if err != nil {
+		return Bookmark{}, err
+	}
+	kf, err := r.KeyFrameAt(t)
+	if err != nil {
+		return Bookmark{}, err
+	}
+	res := Bookmark{
+		Name:     name,
+		GameTime: toDurationMs(t),
+		Chunk:    chunk,
+		KeyFrame: kf,
+	}
+	r.Bookmarks = append(r.Bookmarks, res)
+	return res, nil
+}
+
+// RemoveBookmark removes the bookmark name. It returns false if there
+// is no such bookmark.
+func (r *Replay) RemoveBookmark(name string) bool {
+	for i, b := range r.Bookmarks {
+		if b.Name == name {
+			r.Bookmarks = append(r.Bookmarks[:i], r.Bookmarks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// BookmarkByName returns a Bookmark from its name
+func (r *Replay) BookmarkByName(name string) (*Bookmark, bool) {
+	for i := range r.Bookmarks {
+		if r.Bookmarks[i].Name == name {
+			return &(r.Bookmarks[i]), true
+		}
+	}
+	return nil, false
+}
+
+// a replayIndexer is a ReplayManager that indexes the information
+// of its replays
+type replayIndexer interface {
+	reindex(r *Replay) error
+}
+
+// UpdateReplay loads a complete Replay stored by m, modifies it with
+// update and saves it back. It is meant to edit the user defined data
+// of a Replay, like its Tags: its Chunks and KeyFrames are not loaded
+// nor written again.
+func UpdateReplay(m ReplayManager, region *lol.Region, id lol.GameID, update func(*Replay) error) error {
+	loader, err := m.Get(region, id)
+	if err != nil {
+		return err
+	}
+	w, ok := loader.(ReplayDataWriter)
+	if ok == false {
+		return fmt.Errorf("Replay of game %s/%d cannot be modified", region.PlatformID(), id)
+	}
+	r, err := LoadReplay(loader)
+	if err != nil {
+		return err
+	}
+	if err := update(r); err != nil {
+		return err
+	}
+	if err := r.Save(w); err != nil {
+		return err
+	}
+	if indexer, ok := m.(replayIndexer); ok == true {
+		return indexer.reindex(r)
+	}
+	return nil
+}
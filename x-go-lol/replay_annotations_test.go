@@ -0,0 +1,137 @@
+package xlol
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/atuleu/go-lol"
+	. "gopkg.in/check.v1"
+)
+
+type ReplayAnnotationsSuite struct{}
+
+var _ = Suite(&ReplayAnnotationsSuite{})
+
+func (s *ReplayAnnotationsSuite) TestTags(c *C) {
+	r := newTestReplay(20, 30000)
+	r.AddTag("scrim")
+	r.AddTag("vs TeamX")
+	r.AddTag("scrim")
+	c.Check(r.Tags, DeepEquals, []string{"scrim", "vs TeamX"})
+	c.Check(r.HasTag("vs TeamX"), Equals, true)
+
+	c.Check(r.RemoveTag("scrim"), Equals, true)
+	c.Check(r.RemoveTag("scrim"), Equals, false)
+	c.Check(r.Tags, DeepEquals, []string{"vs TeamX"})
+	c.Check(r.HasTag("scrim"), Equals, false)
+}
+
+func (s *ReplayAnnotationsSuite) TestMapsBookmarks(c *C) {
+	r := newTestReplay(20, 30000)
+
+	testData := []struct {
+		Time     time.Duration
+		Chunk    ChunkID
+		KeyFrame KeyFrameID
+	}{
+		{0, 6, 1},
+		{29 * time.Second, 6, 1},
+		{2*time.Minute + 15*time.Second, 10, 3},
+		{3 * time.Minute, 12, 4},
+		{7*time.Minute + 30*time.Second, 20, 8},
+	}
+
+	for i, d := range testData {
+		b, err := r.AddBookmark(fmt.Sprintf("bookmark %d", i), d.Time)
+		c.Assert(err, IsNil)
+		c.Check(b.GameTime.Duration(), Equals, d.Time)
+		c.Check(b.Chunk, Equals, d.Chunk, Commentf("at %s", d.Time))
+		c.Check(b.KeyFrame, Equals, d.KeyFrame, Commentf("at %s", d.Time))
+	}
+
+	_, err := r.AddBookmark("bookmark 0", time.Minute)
+	c.Check(err, ErrorMatches, "Bookmark bookmark 0 already exists")
+	_, err = r.AddBookmark("too late", time.Hour)
+	c.Check(err, ErrorMatches, "Game time 1h0m0s is after the end of the game \\(7m30s\\)")
+
+	b, ok := r.BookmarkByName("bookmark 2")
+	c.Assert(ok, Equals, true)
+	c.Check(b.Chunk, Equals, ChunkID(10))
+	c.Check(r.RemoveBookmark("bookmark 2"), Equals, true)
+	c.Check(r.RemoveBookmark("bookmark 2"), Equals, false)
+	c.Check(r.Bookmarks, HasLen, len(testData)-1)
+}
+
+func (s *ReplayAnnotationsSuite) TestUpdatesStoredReplay(c *C) {
+	region, err := lol.NewRegionByPlatformID("EUW1")
+	c.Assert(err, IsNil)
+	m := NewMemoryReplayManager()
+	original := newTestReplay(20, 30000)
+	c.Assert(m.Store(original), IsNil)
+
+	err = UpdateReplay(m, region, original.MetaData.GameKey.ID, func(r *Replay) error {
+		r.AddTag("scrim")
+		r.Notes = "lost the bot lane"
+		_, err := r.AddBookmark("baron", 3*time.Minute)
+		return err
+	})
+	c.Assert(err, IsNil)
+
+	loader, err := m.Get(region, original.MetaData.GameKey.ID)
+	c.Assert(err, IsNil)
+	loaded, err := LoadReplayWithData(loader)
+	c.Assert(err, IsNil)
+	c.Check(loaded.Tags, DeepEquals, []string{"scrim"})
+	c.Check(loaded.Notes, Equals, "lost the bot lane")
+	c.Check(loaded.Bookmarks, DeepEquals, []Bookmark{{Name: "baron", GameTime: 180000, Chunk: 12, KeyFrame: 4}})
+	c.Check(loaded.Chunks, DeepEquals, original.Chunks)
+
+	err = UpdateReplay(m, region, original.MetaData.GameKey.ID, func(r *Replay) error {
+		return fmt.Errorf("some error")
+	})
+	c.Check(err, ErrorMatches, "some error")
+}
+
+func (s *ReplayAnnotationsSuite) TestUpdatesOnlyReplayMetadata(c *C) {
+	region, err := lol.NewRegionByPlatformID("EUW1")
+	c.Assert(err, IsNil)
+	basedir := c.MkDir()
+	managed, err := NewDirReplayManager(path.Join(basedir, "replays"))
+	c.Assert(err, IsNil)
+	index, err := NewReplayIndex(path.Join(basedir, "index.db"))
+	c.Assert(err, IsNil)
+	m, err := NewIndexedReplayManager(managed, index)
+	c.Assert(err, IsNil)
+	original := newTestReplay(20, 30000)
+	c.Assert(m.Store(original), IsNil)
+
+	chunkPath := path.Join(basedir, "replays", "EUW1", original.MetaData.GameKey.ID.String(), "chunk.0006.bin")
+	before, err := os.Stat(chunkPath)
+	c.Assert(err, IsNil)
+
+	err = UpdateReplay(m, region, original.MetaData.GameKey.ID, func(r *Replay) error {
+		r.AddTag("scrim")
+		r.PlayerOfInterest = 42
+		return nil
+	})
+	c.Assert(err, IsNil)
+
+	// Chunks are not written again
+	after, err := os.Stat(chunkPath)
+	c.Assert(err, IsNil)
+	c.Check(os.SameFile(before, after), Equals, true)
+
+	loader, err := m.Get(region, original.MetaData.GameKey.ID)
+	c.Assert(err, IsNil)
+	loaded, err := LoadReplayWithData(loader)
+	c.Assert(err, IsNil)
+	c.Check(loaded.Tags, DeepEquals, []string{"scrim"})
+	c.Check(loaded.Chunks, DeepEquals, original.Chunks)
+
+	indexed, err := m.Query(ReplayQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(indexed, HasLen, 1)
+	c.Check(indexed[0].PlayerOfInterest, Equals, lol.SummonerID(42))
+}
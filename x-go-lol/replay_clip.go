@@ -0,0 +1,137 @@
+package xlol
+
+import (
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/atuleu/go-lol"
+)
+
+// clipGameIDBit is set in the game IDs of clips, so they do not
+// collide with the IDs of real games
+const clipGameIDBit lol.GameID = 1 << 62
+
+// clipGameID returns the game ID of the clip of a game between two
+// Chunks
+func clipGameID(id lol.GameID, first, last ChunkID) lol.GameID {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d/%d/%d", id, first, last)
+	return lol.GameID(h.Sum64())&(clipGameIDBit-1) | clipGameIDBit
+}
+
+// Clip returns a new Replay with the part of the game between the
+// game times from and to. It starts at the last KeyFrame before from,
+// so the client can bootstrap the game, and keeps the Chunks of the
+// loading screen and the end of game statistics, so the clip can be
+// watched on its own. All data of the Replay must be loaded. The
+// Chunks and KeyFrames of the clip that could not be recorded are
+// still missing in the clip, but the KeyFrame it starts from must be
+// available.
+//
+// The clip has its own game ID, derived from the game and the clip
+// window, so it can be stored next to the original Replay.
+func (r *Replay) Clip(from, to time.Duration) (*Replay, error) {
+	if from < 0 || to <= from {
+		return nil, fmt.Errorf("Invalid clip window %s-%s", from, to)
+	}
+	if err := r.check(nil); err != nil {
+		return nil, fmt.Errorf("Could not clip replay: %s", err)
+	}
+
+	firstKeyFrameID, err := r.KeyFrameAt(from)
+	if err != nil {
+		return nil, err
+	}
+	if r.isMissingKeyFrame(firstKeyFrameID) == true {
+		return nil, fmt.Errorf("Could not clip replay: KeyFrame %d to start from is missing", firstKeyFrameID)
+	}
+	firstKeyFrame, _ := r.KeyFrameByID(firstKeyFrameID)
+	first := firstKeyFrame.NextChunkID
+	if int(first) < r.MetaData.StartGameChunkID {
+		first = ChunkID(r.MetaData.StartGameChunkID)
+	}
+	last, err := r.ChunkAt(to)
+	if err != nil {
+		return nil, err
+	}
+	lastChunk, _ := r.ChunkByID(last)
+	lastKeyFrameID := lastChunk.KeyFrame
+
+	res := NewEmptyReplay()
+	res.Version = r.Version
+	res.EncryptionKey = r.EncryptionKey
+	res.GameInfo = r.GameInfo
+	res.PlayerOfInterest = r.PlayerOfInterest
+	res.Tags = append([]string{}, r.Tags...)
+	res.Notes = r.Notes
+	res.endOfGameStats = r.endOfGameStats
+
+	res.ClippedFrom = r.MetaData.GameKey.ID
+	if r.ClippedFrom != 0 {
+		res.ClippedFrom = r.ClippedFrom
+	}
+
+	res.MetaData = r.MetaData
+	res.MetaData.GameKey.ID = clipGameID(r.MetaData.GameKey.ID, first, last)
+	res.GameInfo.ID = res.MetaData.GameKey.ID
+	res.MetaData.StartGameChunkID = int(first)
+	res.MetaData.EndGameChunkID = int(last)
+	res.MetaData.LastChunkID = int(last)
+	res.MetaData.EndGameKeyFrameID = int(lastKeyFrameID)
+	res.MetaData.LastKeyFrameID = int(lastKeyFrameID)
+	res.MetaData.PendingAvailableChunkInfo = []ChunkInfo{}
+	res.MetaData.PendingAvailableKeyFrameInfo = []KeyFrameInfo{}
+
+	keepChunk := func(id ChunkID) bool {
+		return int(id) <= r.MetaData.EndStartupChunkID || (id >= first && id <= last)
+	}
+	kept := make(map[ChunkID]bool)
+	for _, c := range r.Chunks {
+		if keepChunk(c.ID) == false {
+			continue
+		}
+		kept[c.ID] = true
+		res.addChunk(c)
+	}
+	for _, id := range r.MissingChunks {
+		if keepChunk(id) == true {
+			res.MissingChunks = append(res.MissingChunks, id)
+		}
+	}
+	for _, id := range r.MissingKeyFrames {
+		if id >= firstKeyFrameID && id <= lastKeyFrameID {
+			res.MissingKeyFrames = append(res.MissingKeyFrames, id)
+		}
+	}
+
+	for _, kf := range r.KeyFrames {
+		if kf.ID < firstKeyFrameID || kf.ID > lastKeyFrameID {
+			continue
+		}
+		chunks := []ChunkID{}
+		for _, id := range kf.Chunks {
+			if kept[id] == true {
+				chunks = append(chunks, id)
+			}
+		}
+		kf.Chunks = chunks
+		res.addKeyFrame(kf)
+	}
+
+	// bookmarks of the clip are shifted to its game time
+	offset := r.GameTime(first - 1)
+	for _, b := range r.Bookmarks {
+		if b.Chunk < first || b.Chunk > last {
+			continue
+		}
+		if _, err := res.AddBookmark(b.Name, b.GameTime.Duration()-offset); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := res.check(nil); err != nil {
+		return nil, fmt.Errorf("Could not clip replay: %s", err)
+	}
+	return res, nil
+}
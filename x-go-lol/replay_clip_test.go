@@ -0,0 +1,188 @@
+package xlol
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/atuleu/go-lol"
+	. "gopkg.in/check.v1"
+)
+
+type ReplayClipSuite struct{}
+
+var _ = Suite(&ReplayClipSuite{})
+
+func chunkIDs(r *Replay) []ChunkID {
+	res := make([]ChunkID, 0, len(r.Chunks))
+	for _, c := range r.Chunks {
+		res = append(res, c.ID)
+	}
+	return res
+}
+
+func (s *ReplayClipSuite) TestClipsReplay(c *C) {
+	// a 17m30s game
+	original := newTestReplay(40, 30000)
+	original.AddTag("scrim")
+	_, err := original.AddBookmark("baron", 4*time.Minute)
+	c.Assert(err, IsNil)
+	_, err = original.AddBookmark("dragon", 10*time.Minute)
+	c.Assert(err, IsNil)
+
+	clip, err := original.Clip(3*time.Minute+10*time.Second, 6*time.Minute)
+	c.Assert(err, IsNil)
+
+	// starts at KeyFrame 4, i.e. at 3m, up to the chunk playing at 6m
+	c.Check(chunkIDs(clip), DeepEquals, []ChunkID{1, 2, 3, 4, 12, 13, 14, 15, 16, 17, 18})
+	c.Assert(clip.KeyFrames, HasLen, 4)
+	c.Check(clip.KeyFrames[0].ID, Equals, KeyFrameID(4))
+	c.Check(clip.KeyFrames[3].ID, Equals, KeyFrameID(7))
+	c.Check(clip.KeyFrames[3].Chunks, DeepEquals, []ChunkID{18})
+	c.Check(clip.MetaData.StartGameChunkID, Equals, 12)
+	c.Check(clip.MetaData.EndGameChunkID, Equals, 18)
+	c.Check(clip.MetaData.LastChunkID, Equals, 18)
+	c.Check(clip.MetaData.EndGameKeyFrameID, Equals, 7)
+	c.Check(clip.MetaData.LastKeyFrameID, Equals, 7)
+	c.Check(clip.MetaData.GameKey.PlatformID, Equals, original.MetaData.GameKey.PlatformID)
+	c.Check(clip.MetaData.GameKey.ID, Not(Equals), original.MetaData.GameKey.ID)
+	c.Check(clip.GameInfo.ID, Equals, clip.MetaData.GameKey.ID)
+	c.Check(clip.ClippedFrom, Equals, original.MetaData.GameKey.ID)
+	c.Check(clip.GameDuration(), Equals, 3*time.Minute+30*time.Second)
+	c.Check(clip.endOfGameStats, DeepEquals, original.endOfGameStats)
+	c.Check(clip.Tags, DeepEquals, []string{"scrim"})
+	c.Check(clip.Bookmarks, DeepEquals, []Bookmark{{Name: "baron", GameTime: 60000, Chunk: 14, KeyFrame: 5}})
+
+	// the clip is self-contained
+	formatter := newMemoryReplayFormatter()
+	c.Assert(clip.SaveWithData(formatter), IsNil)
+	loaded, err := LoadReplayWithData(formatter)
+	c.Assert(err, IsNil)
+	c.Check(loaded.Chunks, DeepEquals, clip.Chunks)
+	c.Check(loaded.MetaData, DeepEquals, clip.MetaData)
+
+	// the original is untouched
+	c.Check(original.Chunks, HasLen, 40)
+	c.Check(original.KeyFrames[6].Chunks, DeepEquals, []ChunkID{18, 19})
+
+	_, err = original.Clip(6*time.Minute, 3*time.Minute)
+	c.Check(err, ErrorMatches, "Invalid clip window 6m0s-3m0s")
+	_, err = original.Clip(3*time.Minute, time.Hour)
+	c.Check(err, ErrorMatches, "Game time 1h0m0s is after the end of the game .*")
+	_, err = NewEmptyReplay().Clip(0, time.Minute)
+	c.Check(err, NotNil)
+}
+
+func (s *ReplayClipSuite) TestClipsReplayWithMissingData(c *C) {
+	original := newTestReplay(40, 30000)
+	for _, id := range []ChunkID{14, 30} {
+		chunk, ok := original.ChunkByID(id)
+		c.Assert(ok, Equals, true)
+		chunk.data = nil
+	}
+	for _, id := range []KeyFrameID{6, 12} {
+		kf, ok := original.KeyFrameByID(id)
+		c.Assert(ok, Equals, true)
+		kf.data = nil
+	}
+	original.MissingChunks = []ChunkID{14, 30}
+	original.MissingKeyFrames = []KeyFrameID{6, 12}
+
+	clip, err := original.Clip(3*time.Minute+10*time.Second, 6*time.Minute)
+	c.Assert(err, IsNil)
+	c.Check(chunkIDs(clip), DeepEquals, []ChunkID{1, 2, 3, 4, 12, 13, 14, 15, 16, 17, 18})
+	c.Check(clip.MissingChunks, DeepEquals, []ChunkID{14})
+	c.Check(clip.MissingKeyFrames, DeepEquals, []KeyFrameID{6})
+
+	formatter := newMemoryReplayFormatter()
+	c.Assert(clip.SaveWithData(formatter), IsNil)
+	loaded, err := LoadReplayWithData(formatter)
+	c.Assert(err, IsNil)
+	c.Check(loaded.MissingChunks, DeepEquals, []ChunkID{14})
+
+	// the client cannot start without its KeyFrame
+	_, err = original.Clip(5*time.Minute+10*time.Second, 6*time.Minute)
+	c.Check(err, ErrorMatches, "Could not clip replay: KeyFrame 6 to start from is missing")
+}
+
+func (s *ReplayClipSuite) TestServesClip(c *C) {
+	original := newTestReplay(40, 30000)
+	clip, err := original.Clip(3*time.Minute+10*time.Second, 6*time.Minute)
+	c.Assert(err, IsNil)
+
+	clock := NewManualClock(time.Date(2015, 7, 7, 12, 0, 0, 0, time.UTC))
+	server, baseURL, closeServer := serveTestReplay(c, clip, 1, clock)
+	defer closeServer()
+	c.Check(server.startStreamChunk, Equals, ChunkID(12))
+
+	// a client joins the clip like a live game, from its first
+	// KeyFrame after the loading screen
+	api := newTestSpectateAPI(c, clip, baseURL, clock)
+	var cInfo LastChunkInfo
+	c.Assert(api.Get(GetLastChunkInfo, 1, &cInfo), IsNil)
+	c.Check(cInfo.ID, Equals, ChunkID(12))
+	c.Check(cInfo.AssociatedKeyFrameID, Equals, KeyFrameID(4))
+	c.Check(cInfo.EndGameChunkID, Equals, ChunkID(18))
+	var metadata GameMetadata
+	c.Assert(api.Get(GetGameMetaData, 1, &metadata), IsNil)
+	c.Check(metadata.StartGameChunkID, Equals, 12)
+	c.Check(metadata.EndStartupChunkID, Equals, 4)
+
+	testData := []struct {
+		Function SpectateFunction
+		ID       int
+		Status   int
+	}{
+		{GetGameDataChunk, 1, http.StatusOK},
+		{GetGameDataChunk, 4, http.StatusOK},
+		{GetGameDataChunk, 12, http.StatusOK},
+		{GetKeyFrame, 4, http.StatusOK},
+		{GetGameDataChunk, 11, http.StatusNotFound},
+		{GetKeyFrame, 3, http.StatusNotFound},
+	}
+	for _, d := range testData {
+		resp, err := http.Get(fmt.Sprintf("%s%s%s/EUW1/%d/%d/token", baseURL, Prefix, d.Function, clip.MetaData.GameKey.ID, d.ID))
+		c.Assert(err, IsNil)
+		resp.Body.Close()
+		c.Check(resp.StatusCode, Equals, d.Status, Commentf("%s %d", d.Function, d.ID))
+	}
+}
+
+func (s *ReplayClipSuite) TestStoresClipNextToOriginal(c *C) {
+	region, err := lol.NewRegionByPlatformID("EUW1")
+	c.Assert(err, IsNil)
+	m := NewMemoryReplayManager()
+	original := newTestReplay(40, 30000)
+	c.Assert(m.Store(original), IsNil)
+
+	clip, err := original.Clip(3*time.Minute+10*time.Second, 6*time.Minute)
+	c.Assert(err, IsNil)
+	again, err := original.Clip(3*time.Minute+10*time.Second, 6*time.Minute)
+	c.Assert(err, IsNil)
+	c.Check(again.MetaData.GameKey.ID, Equals, clip.MetaData.GameKey.ID)
+	other, err := original.Clip(3*time.Minute+10*time.Second, 8*time.Minute)
+	c.Assert(err, IsNil)
+	c.Check(other.MetaData.GameKey.ID, Not(Equals), clip.MetaData.GameKey.ID)
+
+	// imported through an archive, as shared clips are
+	archive, err := NewArchiveReplayFormatter(path.Join(c.MkDir(), "clip.glr"))
+	c.Assert(err, IsNil)
+	c.Assert(clip.SaveWithData(archive), IsNil)
+	imported, err := LoadReplayWithData(archive)
+	c.Assert(err, IsNil)
+	c.Assert(archive.Close(), IsNil)
+
+	_, err = m.Create(region, imported.MetaData.GameKey.ID)
+	c.Assert(err, IsNil)
+	c.Assert(m.Store(imported), IsNil)
+	c.Check(gameIDs(m.Replays()[region.Code()]), DeepEquals, []lol.GameID{clip.MetaData.GameKey.ID, original.MetaData.GameKey.ID})
+
+	for _, r := range []*Replay{original, clip} {
+		loader, err := m.Get(region, r.MetaData.GameKey.ID)
+		c.Assert(err, IsNil)
+		loaded, err := LoadReplayWithData(loader)
+		c.Assert(err, IsNil)
+		c.Check(chunkIDs(loaded), DeepEquals, chunkIDs(r))
+	}
+}
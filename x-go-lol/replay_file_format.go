@@ -0,0 +1,76 @@
+package xlol
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A ReplayFileOpener opens, or creates if it does not exist, a replay
+// stored in a single file.
+type ReplayFileOpener func(filename string) (ReplayDataFormatter, error)
+
+var replayFileFormats = struct {
+	sync.RWMutex
+	openers map[string]ReplayFileOpener
+}{
+	openers: make(map[string]ReplayFileOpener),
+}
+
+// RegisterReplayFileFormat registers the ReplayFileOpener used for
+// files with the given extension, i.e. ".glr". It replaces any
+// previously registered one.
+func RegisterReplayFileFormat(extension string, opener ReplayFileOpener) {
+	replayFileFormats.Lock()
+	defer replayFileFormats.Unlock()
+	replayFileFormats.openers[strings.ToLower(extension)] = opener
+}
+
+// ReplayFileExtensions returns the sorted list of registered replay
+// file extensions.
+func ReplayFileExtensions() []string {
+	replayFileFormats.RLock()
+	defer replayFileFormats.RUnlock()
+	res := make([]string, 0, len(replayFileFormats.openers))
+	for ext := range replayFileFormats.openers {
+		res = append(res, ext)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// OpenReplayFile opens, or creates, a replay file with the
+// ReplayFileOpener registered for its extension.
+func OpenReplayFile(filename string) (ReplayDataFormatter, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	replayFileFormats.RLock()
+	opener, ok := replayFileFormats.openers[ext]
+	replayFileFormats.RUnlock()
+	if ok == false {
+		return nil, fmt.Errorf("Unsupported replay file format '%s', supported: %s",
+			ext, strings.Join(ReplayFileExtensions(), ", "))
+	}
+	return opener(filename)
+}
+
+// CopyReplay copies a complete Replay and all its data from src to
+// dst. The integrity of the Replay is checked before anything is
+// written.
+func CopyReplay(dst ReplayDataWriter, src ReplayDataLoader) (*Replay, error) {
+	replay, err := LoadReplayWithData(src)
+	if err != nil {
+		return nil, err
+	}
+	if err := replay.SaveWithData(dst); err != nil {
+		return nil, err
+	}
+	return replay, nil
+}
+
+func init() {
+	RegisterReplayFileFormat(".glr", func(filename string) (ReplayDataFormatter, error) {
+		return NewArchiveReplayFormatter(filename)
+	})
+}
@@ -0,0 +1,63 @@
+package xlol
+
+import (
+	"path"
+
+	. "gopkg.in/check.v1"
+)
+
+type ReplayFileFormatSuite struct{}
+
+var _ = Suite(&ReplayFileFormatSuite{})
+
+func (s *ReplayFileFormatSuite) TestOpensByExtension(c *C) {
+	c.Check(ReplayFileExtensions(), DeepEquals, []string{".glr", ".rofl"})
+
+	f, err := OpenReplayFile(path.Join(c.MkDir(), "replay.GLR"))
+	c.Assert(err, IsNil)
+	_, ok := f.(*ArchiveReplayFormatter)
+	c.Check(ok, Equals, true)
+
+	_, err = OpenReplayFile(path.Join(c.MkDir(), "replay.zip"))
+	c.Check(err, ErrorMatches, "Unsupported replay file format '.zip', supported: .glr, .rofl")
+}
+
+func (s *ReplayFileFormatSuite) TestCopiesBetweenFormats(c *C) {
+	original := newTestReplay(20, 30000)
+	expanded, err := NewExpandedReplayFormatter(c.MkDir())
+	c.Assert(err, IsNil)
+	c.Assert(original.SaveWithData(expanded), IsNil)
+
+	archive, err := OpenReplayFile(path.Join(c.MkDir(), "replay.glr"))
+	c.Assert(err, IsNil)
+	_, err = CopyReplay(archive, expanded)
+	c.Assert(err, IsNil)
+
+	imported, err := NewExpandedReplayFormatter(c.MkDir())
+	c.Assert(err, IsNil)
+	replay, err := CopyReplay(imported, archive)
+	c.Assert(err, IsNil)
+	c.Check(replay.MetaData, DeepEquals, original.MetaData)
+
+	loaded, err := LoadReplayWithData(imported)
+	c.Assert(err, IsNil)
+	c.Check(loaded.Chunks, DeepEquals, original.Chunks)
+	c.Check(loaded.KeyFrames, DeepEquals, original.KeyFrames)
+	c.Check(loaded.endOfGameStats, DeepEquals, original.endOfGameStats)
+}
+
+func (s *ReplayFileFormatSuite) TestDoesNotCopyIncompleteReplay(c *C) {
+	original := newTestReplay(20, 30000)
+	expanded, err := NewExpandedReplayFormatter(c.MkDir())
+	c.Assert(err, IsNil)
+	c.Assert(original.SaveWithData(expanded), IsNil)
+	w, err := expanded.CreateKeyFrame(3)
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	archive, err := OpenReplayFile(path.Join(c.MkDir(), "replay.glr"))
+	c.Assert(err, IsNil)
+	_, err = CopyReplay(archive, expanded)
+	c.Check(err, ErrorMatches, "Incomplete replay: Missing data for KeyFrame 3")
+	c.Check(archive.HasChunk(1), Equals, false)
+}
@@ -0,0 +1,577 @@
+package xlol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/atuleu/go-lol"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	replayIndexFormatVersion = "2"
+)
+
+var (
+	replayIndexMetaBucket      = []byte("meta")
+	replayIndexReplaysBucket   = []byte("replays")
+	replayIndexSummonersBucket = []byte("summoners")
+	replayIndexChampionsBucket = []byte("champions")
+	replayIndexVersionKey      = []byte("version")
+	replayIndexBuckets         = [][]byte{
+		replayIndexMetaBucket,
+		replayIndexReplaysBucket,
+		replayIndexSummonersBucket,
+		replayIndexChampionsBucket,
+	}
+)
+
+// A ReplayIndex is a persistent index of the complete replays of a
+// ReplayManager, so they can be listed and searched without loading
+// them from their storage. The index database is only opened while
+// it is accessed, so several processes can share it.
+//
+// Only the information needed to search and list the replays is
+// indexed, as IndexedReplay. Games are also indexed by summoner and
+// champion, so they can be searched without reading all the index.
+type ReplayIndex struct {
+	path string
+}
+
+// An IndexedParticipant is a participant of an IndexedReplay
+type IndexedParticipant struct {
+	ID       lol.SummonerID `json:"summonerId"`
+	Name     string         `json:"summonerName"`
+	Champion lol.ChampionID `json:"championId"`
+	TeamID   int64          `json:"teamId"`
+}
+
+// An IndexedReplay is the information of a Replay stored in a
+// ReplayIndex. The Replay itself must be loaded from its
+// ReplayManager.
+type IndexedReplay struct {
+	PlatformID       string               `json:"platformId"`
+	GameID           lol.GameID           `json:"gameId"`
+	StartTime        time.Time            `json:"startTime"`
+	CreateTime       time.Time            `json:"createTime"`
+	Duration         time.Duration        `json:"duration"`
+	Queue            lol.QueueID          `json:"queue"`
+	Map              lol.MapID            `json:"map"`
+	Version          string               `json:"version"`
+	PlayerOfInterest lol.SummonerID       `json:"playerOfInterest"`
+	Participants     []IndexedParticipant `json:"participants"`
+}
+
+// NewIndexedReplay returns the indexed information of a Replay
+func NewIndexedReplay(r *Replay) *IndexedReplay {
+	res := &IndexedReplay{
+		PlatformID:       r.MetaData.GameKey.PlatformID,
+		GameID:           r.MetaData.GameKey.ID,
+		StartTime:        r.MetaData.StartTime.Time,
+		CreateTime:       r.MetaData.CreateTime.Time,
+		Duration:         r.GameDuration(),
+		Queue:            r.GameInfo.GameQueue,
+		Map:              r.GameInfo.Map,
+		Version:          r.Version,
+		PlayerOfInterest: r.PlayerOfInterest,
+		Participants:     make([]IndexedParticipant, 0, len(r.GameInfo.Participants)),
+	}
+	for _, p := range r.GameInfo.Participants {
+		res.Participants = append(res.Participants, IndexedParticipant{
+			ID:       p.ID,
+			Name:     p.Name,
+			Champion: p.Champion,
+			TeamID:   p.TeamID,
+		})
+	}
+	return res
+}
+
+// Replay returns a Replay holding only the indexed information, it
+// has no Chunk or KeyFrame.
+func (r *IndexedReplay) Replay() *Replay {
+	res := NewEmptyReplay()
+	res.MetaData.GameKey.PlatformID = r.PlatformID
+	res.MetaData.GameKey.ID = r.GameID
+	res.MetaData.StartTime = LolTime{r.StartTime}
+	res.MetaData.CreateTime = LolTime{r.CreateTime}
+	res.Version = r.Version
+	res.PlayerOfInterest = r.PlayerOfInterest
+	res.GameInfo.ID = r.GameID
+	res.GameInfo.Platform = r.PlatformID
+	res.GameInfo.GameQueue = r.Queue
+	res.GameInfo.Map = r.Map
+	// participants of lol.CurrentGameInfo have an unnamed type, with
+	// the same JSON fields as IndexedParticipant
+	data, err := json.Marshal(r.Participants)
+	if err != nil {
+		panic(err)
+	}
+	if err := json.Unmarshal(data, &res.GameInfo.Participants); err != nil {
+		panic(err)
+	}
+	return res
+}
+
+// NewReplayIndex returns a ReplayIndex stored in the file filepath,
+// which is created if needed.
+func NewReplayIndex(filepath string) (*ReplayIndex, error) {
+	if err := os.MkdirAll(path.Dir(filepath), 0755); err != nil {
+		return nil, fmt.Errorf("Could not create replay index directory: %s", err)
+	}
+	res := &ReplayIndex{path: filepath}
+	if err := res.update(func(tx *bolt.Tx) error { return nil }); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (i *ReplayIndex) open(readOnly bool) (*bolt.DB, error) {
+	db, err := bolt.Open(i.path, 0644, &bolt.Options{
+		Timeout:  10 * time.Second,
+		ReadOnly: readOnly,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not open replay index %s: %s", i.path, err)
+	}
+	return db, nil
+}
+
+func (i *ReplayIndex) update(fn func(*bolt.Tx) error) error {
+	db, err := i.open(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, name := range replayIndexBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return fn(tx)
+	})
+}
+
+func (i *ReplayIndex) view(fn func(*bolt.Tx) error) error {
+	db, err := i.open(true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.View(fn)
+}
+
+// upToDate returns true if the index was built with the current
+// format.
+func (i *ReplayIndex) upToDate() bool {
+	res := false
+	i.view(func(tx *bolt.Tx) error {
+		if meta := tx.Bucket(replayIndexMetaBucket); meta != nil {
+			res = string(meta.Get(replayIndexVersionKey)) == replayIndexFormatVersion
+		}
+		return nil
+	})
+	return res
+}
+
+// replayIndexKey returns the key of a game. Keys are sorted by
+// platform, then by game ID.
+func replayIndexKey(platformID string, id lol.GameID) []byte {
+	return []byte(fmt.Sprintf("%s/%020d", platformID, id))
+}
+
+// summonerIndexKey returns the key of a game in the summoners bucket
+func summonerIndexKey(name string, gameKey []byte) []byte {
+	return append([]byte(normalizeSummonerName(name)+"\x00"), gameKey...)
+}
+
+// championIndexKey returns the key of a game in the champions bucket
+func championIndexKey(champion lol.ChampionID, gameKey []byte) []byte {
+	return append([]byte(fmt.Sprintf("%010d\x00", champion)), gameKey...)
+}
+
+// secondaryKeys returns the keys of a game in the summoners and
+// champions buckets
+func (r *IndexedReplay) secondaryKeys() ([][]byte, [][]byte) {
+	key := replayIndexKey(r.PlatformID, r.GameID)
+	summoners := make([][]byte, 0, len(r.Participants))
+	champions := make([][]byte, 0, len(r.Participants))
+	for _, p := range r.Participants {
+		summoners = append(summoners, summonerIndexKey(p.Name, key))
+		champions = append(champions, championIndexKey(p.Champion, key))
+	}
+	return summoners, champions
+}
+
+func getIndexed(tx *bolt.Tx, key []byte) (*IndexedReplay, error) {
+	data := tx.Bucket(replayIndexReplaysBucket).Get(key)
+	if data == nil {
+		return nil, nil
+	}
+	r := &IndexedReplay{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("Could not decode indexed replay %s: %s", key, err)
+	}
+	return r, nil
+}
+
+func removeReplay(tx *bolt.Tx, key []byte) error {
+	r, err := getIndexed(tx, key)
+	if err != nil || r == nil {
+		return err
+	}
+	summoners, champions := r.secondaryKeys()
+	for _, k := range summoners {
+		if err := tx.Bucket(replayIndexSummonersBucket).Delete(k); err != nil {
+			return err
+		}
+	}
+	for _, k := range champions {
+		if err := tx.Bucket(replayIndexChampionsBucket).Delete(k); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(replayIndexReplaysBucket).Delete(key)
+}
+
+func putReplay(tx *bolt.Tx, replay *Replay) error {
+	r := NewIndexedReplay(replay)
+	key := replayIndexKey(r.PlatformID, r.GameID)
+	if err := removeReplay(tx, key); err != nil {
+		return err
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(replayIndexReplaysBucket).Put(key, data); err != nil {
+		return err
+	}
+	summoners, champions := r.secondaryKeys()
+	for _, k := range summoners {
+		if err := tx.Bucket(replayIndexSummonersBucket).Put(k, nil); err != nil {
+			return err
+		}
+	}
+	for _, k := range champions {
+		if err := tx.Bucket(replayIndexChampionsBucket).Put(k, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Put adds or updates a Replay in the index
+func (i *ReplayIndex) Put(r *Replay) error {
+	return i.update(func(tx *bolt.Tx) error {
+		return putReplay(tx, r)
+	})
+}
+
+// Remove removes a game from the index. It does nothing if the game
+// is not indexed.
+func (i *ReplayIndex) Remove(platformID string, id lol.GameID) error {
+	return i.update(func(tx *bolt.Tx) error {
+		return removeReplay(tx, replayIndexKey(platformID, id))
+	})
+}
+
+// Reset replaces the content of the index by replays
+func (i *ReplayIndex) Reset(replays []*Replay) error {
+	return i.update(func(tx *bolt.Tx) error {
+		// all buckets but the meta one
+		for _, name := range replayIndexBuckets[1:] {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		for _, r := range replays {
+			if err := putReplay(tx, r); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(replayIndexMetaBucket).Put(replayIndexVersionKey, []byte(replayIndexFormatVersion))
+	})
+}
+
+// A ReplayQuery selects replays in a ReplayIndex. Its zero value
+// matches all replays.
+type ReplayQuery struct {
+	// PlatformID of the games, any if empty
+	PlatformID string
+	// Summoner is the name of a summoner of the game, compared case
+	// and space insensitively
+	Summoner string
+	// Champion played in the game. If Summoner is also set, it must
+	// be the champion played by that summoner.
+	Champion lol.ChampionID
+	// Queues of the games, any if empty
+	Queues []lol.QueueID
+	// Since and Until bounds the start time of the games, when
+	// they are not zero
+	Since time.Time
+	Until time.Time
+	// MinDuration and MaxDuration bounds the duration of the
+	// games, when they are not zero
+	MinDuration time.Duration
+	MaxDuration time.Duration
+}
+
+func (q ReplayQuery) matchParticipants(r *IndexedReplay) bool {
+	if len(q.Summoner) == 0 && q.Champion == 0 {
+		return true
+	}
+	summoner := normalizeSummonerName(q.Summoner)
+	for _, p := range r.Participants {
+		if len(summoner) != 0 && normalizeSummonerName(p.Name) != summoner {
+			continue
+		}
+		if q.Champion != 0 && p.Champion != q.Champion {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// Match returns true if the indexed replay matches the query
+func (q ReplayQuery) Match(r *IndexedReplay) bool {
+	if len(q.PlatformID) != 0 && r.PlatformID != q.PlatformID {
+		return false
+	}
+
+	if len(q.Queues) != 0 {
+		found := false
+		for _, queue := range q.Queues {
+			if r.Queue == queue {
+				found = true
+				break
+			}
+		}
+		if found == false {
+			return false
+		}
+	}
+
+	if q.Since.IsZero() == false && r.StartTime.Before(q.Since) == true {
+		return false
+	}
+	if q.Until.IsZero() == false && r.StartTime.After(q.Until) == true {
+		return false
+	}
+
+	if q.MinDuration != 0 && r.Duration < q.MinDuration {
+		return false
+	}
+	if q.MaxDuration != 0 && r.Duration > q.MaxDuration {
+		return false
+	}
+
+	return q.matchParticipants(r)
+}
+
+// scanKeys returns the keys of a bucket starting with prefix, without
+// the prefix.
+func scanKeys(b *bolt.Bucket, prefix []byte) [][]byte {
+	var res [][]byte
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix) == true; k, _ = c.Next() {
+		res = append(res, append([]byte{}, k[len(prefix):]...))
+	}
+	return res
+}
+
+// candidates returns the keys of the games that may match q, sorted
+// in reverse order. Games are looked up by summoner or champion
+// when the query selects them.
+func (q ReplayQuery) candidates(tx *bolt.Tx) [][]byte {
+	var keys [][]byte
+	if len(q.Summoner) != 0 {
+		keys = scanKeys(tx.Bucket(replayIndexSummonersBucket), summonerIndexKey(q.Summoner, nil))
+	} else if q.Champion != 0 {
+		keys = scanKeys(tx.Bucket(replayIndexChampionsBucket), championIndexKey(q.Champion, nil))
+	} else {
+		prefix := []byte{}
+		if len(q.PlatformID) != 0 {
+			prefix = []byte(q.PlatformID + "/")
+		}
+		keys = scanKeys(tx.Bucket(replayIndexReplaysBucket), prefix)
+		for i := range keys {
+			keys[i] = append(append([]byte{}, prefix...), keys[i]...)
+		}
+	}
+	sort.Sort(sort.Reverse(byteSlices(keys)))
+	return keys
+}
+
+// byteSlices sorts byte slices
+type byteSlices [][]byte
+
+func (l byteSlices) Len() int {
+	return len(l)
+}
+
+func (l byteSlices) Less(i, j int) bool {
+	return bytes.Compare(l[i], l[j]) < 0
+}
+
+func (l byteSlices) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
+
+// Query returns the indexed replays that match q, sorted by platform
+// then by game ID, in reverse order.
+func (i *ReplayIndex) Query(q ReplayQuery) ([]*IndexedReplay, error) {
+	var res []*IndexedReplay
+	err := i.view(func(tx *bolt.Tx) error {
+		if tx.Bucket(replayIndexReplaysBucket) == nil {
+			return nil
+		}
+		var previous []byte
+		for _, k := range q.candidates(tx) {
+			// a summoner may have played several champions
+			if bytes.Equal(k, previous) == true {
+				continue
+			}
+			previous = k
+			r, err := getIndexed(tx, k)
+			if err != nil {
+				return err
+			}
+			if r == nil || q.Match(r) == false {
+				continue
+			}
+			res = append(res, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// A ReplayQuerier searches the replays of a ReplayManager
+type ReplayQuerier interface {
+	// Query returns the replays matching q
+	Query(q ReplayQuery) ([]*IndexedReplay, error)
+	// Rebuild indexes again all the stored replays
+	Rebuild() error
+}
+
+// a replayLister is a ReplayManager that can report the errors
+// happening while listing its replays
+type replayLister interface {
+	listReplays() (map[string][]*Replay, error)
+}
+
+// An IndexedReplayManager is a ReplayManager that keeps a ReplayIndex
+// of another ReplayManager up to date, and lists its replays from the
+// index. Replays recorded without using the IndexedReplayManager are
+// only listed once the index is rebuilt.
+type IndexedReplayManager struct {
+	ReplayManager
+	index *ReplayIndex
+}
+
+// NewIndexedReplayManager returns a ReplayManager listing the replays
+// of m from index. The index is rebuilt if it was built with an older
+// format.
+func NewIndexedReplayManager(m ReplayManager, index *ReplayIndex) (*IndexedReplayManager, error) {
+	res := &IndexedReplayManager{
+		ReplayManager: m,
+		index:         index,
+	}
+	if index.upToDate() == false {
+		log.Printf("Building replay index")
+		if err := res.Rebuild(); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Rebuild rebuilds the index from the replays stored in the managed
+// ReplayManager. The index is kept as is if they cannot be listed.
+func (m *IndexedReplayManager) Rebuild() error {
+	var all map[string][]*Replay
+	if lister, ok := m.ReplayManager.(replayLister); ok == true {
+		var err error
+		all, err = lister.listReplays()
+		if err != nil {
+			return fmt.Errorf("Could not list stored replays: %s", err)
+		}
+	} else {
+		all = m.ReplayManager.Replays()
+	}
+	var replays []*Replay
+	for _, list := range all {
+		replays = append(replays, list...)
+	}
+	return m.index.Reset(replays)
+}
+
+// Store saves all the Replay data, and indexes it
+func (m *IndexedReplayManager) Store(r *Replay) error {
+	if err := m.ReplayManager.Store(r); err != nil {
+		return err
+	}
+	return m.index.Put(r)
+}
+
+// reindex updates the indexed information of a stored Replay
+func (m *IndexedReplayManager) reindex(r *Replay) error {
+	return m.index.Put(r)
+}
+
+// Replays return all indexed Replay, by region code. They only hold
+// the indexed information, their data must be loaded with Get.
+func (m *IndexedReplayManager) Replays() map[string][]*Replay {
+	replays, err := m.index.Query(ReplayQuery{})
+	if err != nil {
+		log.Printf("Could not list indexed replays: %s", err)
+		return m.ReplayManager.Replays()
+	}
+	res := make(map[string][]*Replay)
+	for _, r := range replays {
+		region, err := lol.NewRegionByPlatformID(r.PlatformID)
+		if err != nil {
+			continue
+		}
+		res[region.Code()] = append(res[region.Code()], r.Replay())
+	}
+	return res
+}
+
+// Query returns the indexed replays matching q
+func (m *IndexedReplayManager) Query(q ReplayQuery) ([]*IndexedReplay, error) {
+	return m.index.Query(q)
+}
+
+// Delete ensure that the replay is deleted from the manager and the
+// index.
+func (m *IndexedReplayManager) Delete(region *lol.Region, id lol.GameID) error {
+	if err := m.ReplayManager.Delete(region, id); err != nil {
+		return err
+	}
+	return m.index.Remove(region.PlatformID(), id)
+}
+
+// CleanUp removes the invalid replays of the managed ReplayManager,
+// and rebuilds the index.
+func (m *IndexedReplayManager) CleanUp() error {
+	if err := m.ReplayManager.CleanUp(); err != nil {
+		return err
+	}
+	return m.Rebuild()
+}
@@ -0,0 +1,200 @@
+package xlol
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/atuleu/go-lol"
+	. "gopkg.in/check.v1"
+)
+
+type ReplayIndexSuite struct {
+	region *lol.Region
+}
+
+var _ = Suite(&ReplayIndexSuite{})
+
+func (s *ReplayIndexSuite) SetUpSuite(c *C) {
+	var err error
+	s.region, err = lol.NewRegionByPlatformID("EUW1")
+	c.Assert(err, IsNil)
+}
+
+// newIndexedTestReplay returns a test Replay for game id, starting
+// at start, where summoner plays champion in queue
+func newIndexedTestReplay(c *C, id lol.GameID, lastChunk ChunkID, start time.Time, queue lol.QueueID, summoner string, champion lol.ChampionID) *Replay {
+	r := newTestReplay(lastChunk, 30000)
+	r.MetaData.GameKey.ID = id
+	r.MetaData.StartTime = LolTime{start}
+	info := fmt.Sprintf(`{"gameId":%d,"gameQueueConfigId":%d,"platformId":"EUW1","participants":[
+{"summonerId":1,"summonerName":"%s","championId":%d,"teamId":100},
+{"summonerId":2,"summonerName":"Someone Else","championId":1,"teamId":200}]}`,
+		id, queue, summoner, champion)
+	c.Assert(json.Unmarshal([]byte(info), &r.GameInfo), IsNil)
+	return r
+}
+
+func gameIDs(replays []*Replay) []lol.GameID {
+	res := make([]lol.GameID, 0, len(replays))
+	for _, r := range replays {
+		res = append(res, r.MetaData.GameKey.ID)
+	}
+	return res
+}
+
+func indexedGameIDs(replays []*IndexedReplay) []lol.GameID {
+	res := make([]lol.GameID, 0, len(replays))
+	for _, r := range replays {
+		res = append(res, r.GameID)
+	}
+	return res
+}
+
+func (s *ReplayIndexSuite) TestQueriesReplays(c *C) {
+	index, err := NewReplayIndex(path.Join(c.MkDir(), "index.db"))
+	c.Assert(err, IsNil)
+	m, err := NewIndexedReplayManager(NewMemoryReplayManager(), index)
+	c.Assert(err, IsNil)
+
+	day := time.Date(2015, 7, 7, 12, 0, 0, 0, time.UTC)
+	c.Assert(m.Store(newIndexedTestReplay(c, 1, 20, day, lol.RANKEDSOLO5x5, "Player One", 103)), IsNil)
+	c.Assert(m.Store(newIndexedTestReplay(c, 2, 40, day.Add(24*time.Hour), lol.NORMAL5x5BLIND, "Player One", 22)), IsNil)
+	c.Assert(m.Store(newIndexedTestReplay(c, 3, 60, day.Add(48*time.Hour), lol.RANKEDSOLO5x5, "Player Two", 103)), IsNil)
+
+	testData := []struct {
+		Query    ReplayQuery
+		Expected []lol.GameID
+	}{
+		{ReplayQuery{}, []lol.GameID{3, 2, 1}},
+		{ReplayQuery{PlatformID: "NA1"}, []lol.GameID{}},
+		{ReplayQuery{Summoner: "playerone"}, []lol.GameID{2, 1}},
+		{ReplayQuery{Champion: 103}, []lol.GameID{3, 1}},
+		{ReplayQuery{Champion: 1}, []lol.GameID{3, 2, 1}},
+		{ReplayQuery{Summoner: "Player One", Champion: 103}, []lol.GameID{1}},
+		{ReplayQuery{Summoner: "Player One", Champion: 1}, []lol.GameID{}},
+		{ReplayQuery{Queues: []lol.QueueID{lol.RANKEDSOLO5x5}}, []lol.GameID{3, 1}},
+		{ReplayQuery{Since: day.Add(time.Hour)}, []lol.GameID{3, 2}},
+		{ReplayQuery{Until: day.Add(time.Hour)}, []lol.GameID{1}},
+		{ReplayQuery{MinDuration: 10 * time.Minute}, []lol.GameID{3, 2}},
+		{ReplayQuery{MinDuration: 10 * time.Minute, MaxDuration: 20 * time.Minute}, []lol.GameID{2}},
+	}
+
+	for _, d := range testData {
+		replays, err := m.Query(d.Query)
+		c.Assert(err, IsNil)
+		c.Check(indexedGameIDs(replays), DeepEquals, d.Expected, Commentf("query: %+v", d.Query))
+	}
+
+	// updated participants are not indexed anymore
+	c.Assert(m.Store(newIndexedTestReplay(c, 1, 20, day, lol.RANKEDSOLO5x5, "Player Three", 22)), IsNil)
+	replays, err := m.Query(ReplayQuery{Summoner: "Player One"})
+	c.Assert(err, IsNil)
+	c.Check(indexedGameIDs(replays), DeepEquals, []lol.GameID{2})
+	replays, err = m.Query(ReplayQuery{Champion: 103})
+	c.Assert(err, IsNil)
+	c.Check(indexedGameIDs(replays), DeepEquals, []lol.GameID{3})
+
+	c.Assert(m.Delete(s.region, 2), IsNil)
+	c.Check(gameIDs(m.Replays()[s.region.Code()]), DeepEquals, []lol.GameID{3, 1})
+}
+
+func (s *ReplayIndexSuite) TestIndexIsPersistent(c *C) {
+	indexPath := path.Join(c.MkDir(), "index.db")
+	index, err := NewReplayIndex(indexPath)
+	c.Assert(err, IsNil)
+	managed := NewMemoryReplayManager()
+	m, err := NewIndexedReplayManager(managed, index)
+	c.Assert(err, IsNil)
+	original := newTestReplay(20, 30000)
+	c.Assert(m.Store(original), IsNil)
+
+	index, err = NewReplayIndex(indexPath)
+	c.Assert(err, IsNil)
+	m, err = NewIndexedReplayManager(managed, index)
+	c.Assert(err, IsNil)
+	replays := m.Replays()[s.region.Code()]
+	c.Assert(len(replays), Equals, 1)
+	c.Check(replays[0].MetaData.GameKey, DeepEquals, original.MetaData.GameKey)
+	c.Check(replays[0].MetaData.StartTime.Equal(original.MetaData.StartTime.Time), Equals, true)
+	c.Check(replays[0].Version, Equals, original.Version)
+
+	indexed, err := m.Query(ReplayQuery{})
+	c.Assert(err, IsNil)
+	c.Assert(indexed, HasLen, 1)
+	c.Check(indexed[0].Duration, Equals, original.GameDuration())
+
+	// the replay data is loaded from the managed ReplayManager
+	loader, err := m.Get(s.region, original.MetaData.GameKey.ID)
+	c.Assert(err, IsNil)
+	loaded, err := LoadReplay(loader)
+	c.Assert(err, IsNil)
+	c.Check(loaded.Chunks, HasLen, len(original.Chunks))
+}
+
+func (s *ReplayIndexSuite) TestRebuildsIndex(c *C) {
+	managed := NewMemoryReplayManager()
+	day := time.Date(2015, 7, 7, 12, 0, 0, 0, time.UTC)
+	c.Assert(managed.Store(newIndexedTestReplay(c, 1, 20, day, lol.RANKEDSOLO5x5, "Player One", 103)), IsNil)
+
+	index, err := NewReplayIndex(path.Join(c.MkDir(), "index.db"))
+	c.Assert(err, IsNil)
+	m, err := NewIndexedReplayManager(managed, index)
+	c.Assert(err, IsNil)
+	c.Check(gameIDs(m.Replays()[s.region.Code()]), DeepEquals, []lol.GameID{1})
+
+	// replays stored behind the index's back are listed once rebuilt
+	c.Assert(managed.Store(newIndexedTestReplay(c, 2, 20, day, lol.RANKEDSOLO5x5, "Player One", 103)), IsNil)
+	c.Check(gameIDs(m.Replays()[s.region.Code()]), DeepEquals, []lol.GameID{1})
+	c.Assert(managed.Delete(s.region, 1), IsNil)
+	c.Assert(m.CleanUp(), IsNil)
+	c.Check(gameIDs(m.Replays()[s.region.Code()]), DeepEquals, []lol.GameID{2})
+}
+
+func (s *ReplayIndexSuite) TestKeepsIndexIfListingFails(c *C) {
+	bucket, _, stop := newTestS3Bucket(c)
+	managed, err := NewS3ReplayManager(bucket, "go-lol")
+	c.Assert(err, IsNil)
+	index, err := NewReplayIndex(path.Join(c.MkDir(), "index.db"))
+	c.Assert(err, IsNil)
+	m, err := NewIndexedReplayManager(managed, index)
+	c.Assert(err, IsNil)
+	original := newTestReplay(16, 300)
+	c.Assert(m.Store(original), IsNil)
+
+	// the storage is not reachable anymore
+	stop()
+	c.Check(m.Rebuild(), ErrorMatches, "Could not list stored replays: .*")
+	c.Check(gameIDs(m.Replays()[s.region.Code()]), DeepEquals, []lol.GameID{original.MetaData.GameKey.ID})
+}
+
+// listingReplayManager is a replayLister that counts the calls to
+// Replays
+type listingReplayManager struct {
+	*MemoryReplayManager
+	replaysCalls int
+}
+
+func (m *listingReplayManager) Replays() map[string][]*Replay {
+	m.replaysCalls++
+	return m.MemoryReplayManager.Replays()
+}
+
+func (m *listingReplayManager) listReplays() (map[string][]*Replay, error) {
+	return m.MemoryReplayManager.Replays(), nil
+}
+
+func (s *ReplayIndexSuite) TestRebuildListsReplaysOnce(c *C) {
+	managed := &listingReplayManager{MemoryReplayManager: NewMemoryReplayManager()}
+	original := newTestReplay(16, 300)
+	c.Assert(managed.Store(original), IsNil)
+	index, err := NewReplayIndex(path.Join(c.MkDir(), "index.db"))
+	c.Assert(err, IsNil)
+	m, err := NewIndexedReplayManager(managed, index)
+	c.Assert(err, IsNil)
+
+	c.Assert(m.Rebuild(), IsNil)
+	c.Check(managed.replaysCalls, Equals, 0)
+	c.Check(gameIDs(m.Replays()[s.region.Code()]), DeepEquals, []lol.GameID{original.MetaData.GameKey.ID})
+}
@@ -13,35 +13,52 @@ import (
 	"launchpad.net/go-xdg"
 )
 
-// A ReplayManager stores and retrieve replays
+// A ReplayManager stores and retrieve replays. Replays whose recording
+// was interrupted are incomplete, they are only reported by
+// IncompleteReplays, and can be resumed with Resume.
 type ReplayManager interface {
 	Store(*Replay) error
 	Get(*lol.Region, lol.GameID) (ReplayDataLoader, error)
 	Create(*lol.Region, lol.GameID) (ReplayDataWriter, error)
-	Replays() map[string]*Replay
+	Replays() map[string][]*Replay
+	IncompleteReplays() map[string][]*Replay
+	Resume(*lol.Region, lol.GameID) (ReplayDataFormatter, error)
 	Delete(*lol.Region, lol.GameID) error
+	CleanUp() error
 }
 
-// A XdgReplayManager is a ReplayManager that stores its data within
-// the XDG_CACHE_HOME directory
-type XdgReplayManager struct {
+// A DirReplayManager is a ReplayManager that stores its data within a
+// directory
+type DirReplayManager struct {
 	basedir string
 }
 
+// XdgReplayManager is the previous name of DirReplayManager.
+//
+// Deprecated: use DirReplayManager.
+type XdgReplayManager = DirReplayManager
+
 const (
-	xdgReplayManagerFormatVersion = "1~dev1"
+	dirReplayManagerFormatVersion = "1~dev1"
 )
 
 // NewXdgReplayManager creates a ReplayManager that stores its data in
 // XDG_CACHE_HOME
-func NewXdgReplayManager() (*XdgReplayManager, error) {
-	res := &XdgReplayManager{}
+func NewXdgReplayManager() (*DirReplayManager, error) {
+	return NewDirReplayManager(path.Join(xdg.Cache.Home(), "go-lol", "replays"))
+}
+
+// NewDirReplayManager creates a ReplayManager that stores its data in
+// basedir, which is created if needed
+func NewDirReplayManager(basedir string) (*DirReplayManager, error) {
+	res := &DirReplayManager{
+		basedir: basedir,
+	}
 
-	versionPath := path.Join(xdg.Cache.Home(), "go-lol", "replays", "version")
-	res.basedir = path.Dir(versionPath)
+	versionPath := path.Join(basedir, "version")
 	err := os.MkdirAll(res.basedir, 0755)
 	if err != nil {
-		return nil, fmt.Errorf("Could not create cache directory %s: %s",
+		return nil, fmt.Errorf("Could not create replay directory %s: %s",
 			res.basedir, err)
 	}
 
@@ -55,7 +72,7 @@ func NewXdgReplayManager() (*XdgReplayManager, error) {
 			return nil, err
 		}
 		defer f.Close()
-		fmt.Fprintf(f, "%s\n", xdgReplayManagerFormatVersion)
+		fmt.Fprintf(f, "%s\n", dirReplayManagerFormatVersion)
 		return res, nil
 	}
 
@@ -67,7 +84,7 @@ func NewXdgReplayManager() (*XdgReplayManager, error) {
 	var localVersion string
 	_, err = fmt.Fscanf(f, "%s\n", &localVersion)
 	if err != nil {
-		return nil, fmt.Errorf("Could not read cache directory version: %s", err)
+		return nil, fmt.Errorf("Could not read replay directory version: %s", err)
 	}
 
 	err = res.checkCompatible(localVersion)
@@ -78,19 +95,19 @@ func NewXdgReplayManager() (*XdgReplayManager, error) {
 	return res, nil
 }
 
-func (m *XdgReplayManager) checkCompatible(version string) error {
-	if version != xdgReplayManagerFormatVersion {
-		return fmt.Errorf("Invalid version format %s, expected %s", version, expandedFormatVersion)
+func (m *DirReplayManager) checkCompatible(version string) error {
+	if version != dirReplayManagerFormatVersion {
+		return fmt.Errorf("Invalid version format %s, expected %s", version, dirReplayManagerFormatVersion)
 	}
 	return nil
 }
 
-func (m *XdgReplayManager) replayBasePath(region *lol.Region, id lol.GameID) string {
+func (m *DirReplayManager) replayBasePath(region *lol.Region, id lol.GameID) string {
 	return path.Join(m.basedir, region.PlatformID(), fmt.Sprintf("%s", id))
 }
 
 // Store saves in the cache directory all the Replay data.
-func (m *XdgReplayManager) Store(r *Replay) error {
+func (m *DirReplayManager) Store(r *Replay) error {
 	path := path.Join(m.basedir, r.MetaData.GameKey.PlatformID,
 		fmt.Sprintf("%d", r.MetaData.GameKey.ID))
 
@@ -106,7 +123,7 @@ func (m *XdgReplayManager) Store(r *Replay) error {
 // lol.GameID that is fully stored in the Manager. It will return an
 // error if the replay data is missing or incomplete for LoL client to
 // spectate.
-func (m *XdgReplayManager) Get(region *lol.Region, id lol.GameID) (ReplayDataLoader, error) {
+func (m *DirReplayManager) Get(region *lol.Region, id lol.GameID) (ReplayDataLoader, error) {
 	basepath := m.replayBasePath(region, id)
 
 	_, err := os.Stat(basepath)
@@ -131,7 +148,7 @@ func (m *XdgReplayManager) Get(region *lol.Region, id lol.GameID) (ReplayDataLoa
 // Create returns a ReplayDataWriter for a replay identifieud by its
 // lol.Region and lol.GameID. It will fails if a replay already exists
 // for that Game.
-func (m *XdgReplayManager) Create(region *lol.Region, id lol.GameID) (ReplayDataWriter, error) {
+func (m *DirReplayManager) Create(region *lol.Region, id lol.GameID) (ReplayDataWriter, error) {
 	basepath := m.replayBasePath(region, id)
 
 	formatter, err := NewExpandedReplayFormatter(basepath)
@@ -170,16 +187,28 @@ func (l replayList) Swap(i, j int) {
 	l[i], l[j] = l[j], l[i]
 }
 
+// loadStoredReplay loads a stored Replay, and tells if it is
+// complete, i.e. if its recording was not interrupted.
+func loadStoredReplay(loader ReplayDataLoader) (*Replay, bool, error) {
+	if r, err := LoadReplay(loader); err == nil && loader.HasEndOfGameStats() == true {
+		return r, true, nil
+	}
+	r, err := loadPartialReplay(loader)
+	return r, false, err
+}
+
 // replaysOfRegion parses a directory of a region, and returns valid
-// replay and invalid files.
-func (m *XdgReplayManager) replaysOfRegion(platformID string) ([]*Replay, []string) {
+// replays, incomplete replays (i.e. recordings that were interrupted)
+// and invalid files.
+func (m *DirReplayManager) replaysOfRegion(platformID string) ([]*Replay, []*Replay, []string) {
 	platformBasePath := path.Join(m.basedir, platformID)
 	finfos, err := ioutil.ReadDir(platformBasePath)
 	if err != nil {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	invalid := make([]string, 0, len(finfos))
+	incomplete := make([]*Replay, 0, len(finfos))
 	res := make([]*Replay, 0, len(finfos))
 	for _, inf := range finfos {
 		replayBasePath := path.Join(platformBasePath, inf.Name())
@@ -197,26 +226,27 @@ func (m *XdgReplayManager) replaysOfRegion(platformID string) ([]*Replay, []stri
 			invalid = append(invalid, replayBasePath)
 			continue
 		}
-		if formatter.HasEndOfGameStats() == false {
-			invalid = append(invalid, replayBasePath)
-			continue
-		}
 
-		r, err := LoadReplay(formatter)
+		r, complete, err := loadStoredReplay(formatter)
 		if err != nil {
 			invalid = append(invalid, replayBasePath)
 			continue
 		}
-		res = append(res, r)
+		if complete == true {
+			res = append(res, r)
+		} else {
+			incomplete = append(incomplete, r)
+		}
 	}
 
 	sort.Sort(sort.Reverse(replayList(res)))
+	sort.Sort(sort.Reverse(replayList(incomplete)))
 
-	return res, invalid
+	return res, incomplete, invalid
 }
 
-// Replays return all Replay stored in the XdgReplayManager
-func (m *XdgReplayManager) Replays() map[string][]*Replay {
+// Replays return all Replay stored in the DirReplayManager
+func (m *DirReplayManager) Replays() map[string][]*Replay {
 	res := make(map[string][]*Replay)
 	for _, r := range lol.AllDynamicRegion() {
 		pinfo, err := os.Stat(path.Join(m.basedir, r.PlatformID()))
@@ -227,22 +257,67 @@ func (m *XdgReplayManager) Replays() map[string][]*Replay {
 			continue
 		}
 
-		res[r.Code()], _ = m.replaysOfRegion(r.PlatformID())
+		res[r.Code()], _, _ = m.replaysOfRegion(r.PlatformID())
 	}
 
 	return res
 }
 
+// IncompleteReplays returns all the replays whose recording was
+// interrupted. They can be resumed with Resume, or discarded with
+// Delete. Their Chunks and KeyFrames may miss some data.
+func (m *DirReplayManager) IncompleteReplays() map[string][]*Replay {
+	res := make(map[string][]*Replay)
+	for _, r := range lol.AllDynamicRegion() {
+		pinfo, err := os.Stat(path.Join(m.basedir, r.PlatformID()))
+		if err != nil {
+			continue
+		}
+		if pinfo.IsDir() == false {
+			continue
+		}
+
+		_, res[r.Code()], _ = m.replaysOfRegion(r.PlatformID())
+	}
+
+	return res
+}
+
+// Resume returns a ReplayDataFormatter for a replay whose recording
+// was interrupted, so its recording can be resumed. It will fail if
+// there is no such replay, or if the replay is complete.
+func (m *DirReplayManager) Resume(region *lol.Region, id lol.GameID) (ReplayDataFormatter, error) {
+	basepath := m.replayBasePath(region, id)
+
+	if _, err := os.Stat(basepath); err != nil {
+		return nil, err
+	}
+
+	formatter, err := NewExpandedReplayFormatter(basepath)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, complete, err := loadStoredReplay(formatter); err != nil {
+		return nil, fmt.Errorf("Could not resume replay for game %s/%d: %s", region.PlatformID(), id, err)
+	} else if complete == true {
+		return nil, fmt.Errorf("Replay for game %s/%d is complete", region.PlatformID(), id)
+	}
+
+	return formatter, nil
+}
+
 // Delete ensure that the replay is deleted from the manager. It only
 // returns an error if it cannot delete it. If the replay does not
 // exist it will silently ignores the error.
-func (m *XdgReplayManager) Delete(region *lol.Region, id lol.GameID) error {
+func (m *DirReplayManager) Delete(region *lol.Region, id lol.GameID) error {
 	return os.RemoveAll(m.replayBasePath(region, id))
 }
 
 // CleanUp is locating for all invalid files / replay in the
-// XdgReplayManager and removes them.
-func (m *XdgReplayManager) CleanUp() error {
+// DirReplayManager and removes them. Incomplete replays are kept, as
+// their recording may be resumed, use Delete to discard them.
+func (m *DirReplayManager) CleanUp() error {
 	toDelete := []string{}
 	for _, r := range lol.AllDynamicRegion() {
 		pinfo, err := os.Stat(path.Join(m.basedir, r.PlatformID()))
@@ -253,7 +328,7 @@ func (m *XdgReplayManager) CleanUp() error {
 			continue
 		}
 
-		_, invalid := m.replaysOfRegion(r.PlatformID())
+		_, _, invalid := m.replaysOfRegion(r.PlatformID())
 		toDelete = append(toDelete, invalid...)
 	}
 
@@ -0,0 +1,89 @@
+package xlol
+
+import (
+	"github.com/atuleu/go-lol"
+	. "gopkg.in/check.v1"
+)
+
+type ReplayManagerSuite struct{}
+
+var _ = Suite(&ReplayManagerSuite{})
+
+// managers returns a ReplayManager of each kind, and a function to
+// stop them
+func (s *ReplayManagerSuite) managers(c *C) (map[string]ReplayManager, func()) {
+	dir, err := NewDirReplayManager(c.MkDir())
+	c.Assert(err, IsNil)
+	bucket, _, stop := newTestS3Bucket(c)
+	s3, err := NewS3ReplayManager(bucket, "go-lol")
+	c.Assert(err, IsNil)
+	return map[string]ReplayManager{
+		"directory": dir,
+		"memory":    NewMemoryReplayManager(),
+		"s3":        s3,
+	}, stop
+}
+
+func (s *ReplayManagerSuite) TestStoresReplays(c *C) {
+	region, err := lol.NewRegionByPlatformID("EUW1")
+	c.Assert(err, IsNil)
+	original := newTestReplay(20, 30000)
+
+	managers, stop := s.managers(c)
+	defer stop()
+	for name, m := range managers {
+		comment := Commentf("%s manager", name)
+		c.Assert(m.Store(original), IsNil, comment)
+
+		replays := m.Replays()
+		c.Assert(len(replays[region.Code()]), Equals, 1, comment)
+		c.Check(replays[region.Code()][0].MetaData, DeepEquals, original.MetaData, comment)
+		c.Check(len(m.IncompleteReplays()[region.Code()]), Equals, 0, comment)
+
+		loader, err := m.Get(region, original.MetaData.GameKey.ID)
+		c.Assert(err, IsNil, comment)
+		loaded, err := LoadReplayWithData(loader)
+		c.Assert(err, IsNil, comment)
+		c.Check(loaded.Chunks, DeepEquals, original.Chunks, comment)
+
+		_, err = m.Create(region, original.MetaData.GameKey.ID)
+		c.Check(err, ErrorMatches, "Cannot create a replay for game EUW1/2190090792: some replay data already exists", comment)
+		_, err = m.Resume(region, original.MetaData.GameKey.ID)
+		c.Check(err, ErrorMatches, "Replay for game EUW1/2190090792 is complete", comment)
+
+		c.Check(m.Delete(region, original.MetaData.GameKey.ID), IsNil, comment)
+		c.Check(len(m.Replays()[region.Code()]), Equals, 0, comment)
+		_, err = m.Get(region, original.MetaData.GameKey.ID)
+		c.Check(err, NotNil, comment)
+	}
+}
+
+func (s *ReplayManagerSuite) TestResumesIncompleteReplays(c *C) {
+	region, err := lol.NewRegionByPlatformID("EUW1")
+	c.Assert(err, IsNil)
+	original := newTestReplay(20, 30000)
+
+	managers, stop := s.managers(c)
+	defer stop()
+	for name, m := range managers {
+		comment := Commentf("%s manager", name)
+		w, err := m.Create(region, original.MetaData.GameKey.ID)
+		c.Assert(err, IsNil, comment)
+		c.Assert(original.unsafeSave(w), IsNil, comment)
+
+		c.Check(len(m.Replays()[region.Code()]), Equals, 0, comment)
+		incomplete := m.IncompleteReplays()[region.Code()]
+		c.Assert(len(incomplete), Equals, 1, comment)
+		c.Check(incomplete[0].MetaData.GameKey.ID, Equals, original.MetaData.GameKey.ID, comment)
+
+		_, err = m.Get(region, original.MetaData.GameKey.ID)
+		c.Check(err, ErrorMatches, "Requested game EUW1/2190090792 is not finished, missing EndOfGameStats", comment)
+
+		formatter, err := m.Resume(region, original.MetaData.GameKey.ID)
+		c.Assert(err, IsNil, comment)
+		c.Assert(original.SaveData(formatter), IsNil, comment)
+
+		c.Check(len(m.Replays()[region.Code()]), Equals, 1, comment)
+		c.Check(len(m.IncompleteReplays()[region.Code()]), Equals, 0, comment)
+	}
+}
@@ -32,6 +32,16 @@ type playerSelection struct {
 	champion string
 }
 
+// ChampionName returns the name of a champion, or a placeholder if
+// it cannot be fetched
+func (p *ReplayPrinter) ChampionName(id lol.ChampionID) string {
+	champ, err := p.api.GetChampion(id)
+	if err != nil {
+		return fmt.Sprintf("Unknown ChampionID:%d", id)
+	}
+	return champ.Name
+}
+
 // Display nicely display on stdout the replay information
 func (p *ReplayPrinter) Display(r *Replay) {
 	ansi.ResetColor()
@@ -55,12 +65,7 @@ func (p *ReplayPrinter) Display(r *Replay) {
 			name: part.Name,
 		}
 
-		champ, err := p.api.GetChampion(part.Champion)
-		if err != nil {
-			res.champion = fmt.Sprintf("Unknown ChampionID:%d", part.Champion)
-		} else {
-			res.champion = champ.Name
-		}
+		res.champion = p.ChampionName(part.Champion)
 
 		if part.TeamID == 100 {
 			blueTeam = append(blueTeam, res)
@@ -0,0 +1,201 @@
+package xlol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/atuleu/go-lol"
+)
+
+var (
+	// ErrAlreadyRecording is returned by ReplayRecorder.Record when
+	// the game is already being recorded
+	ErrAlreadyRecording = errors.New("Game is already being recorded")
+	// ErrTooManyRecordings is returned by ReplayRecorder.Record when
+	// the maximal number of parallel recordings is reached
+	ErrTooManyRecordings = errors.New("Too many parallel recordings")
+)
+
+type gameKey struct {
+	platformID string
+	id         lol.GameID
+}
+
+// A ReplayRecorder records games in the background through a
+// ReplayManager. It limits the number of games that are downloaded
+// in parallel, and ensures that a game is never recorded twice at the
+// same time.
+type ReplayRecorder struct {
+	manager ReplayManager
+	tokens  chan bool
+
+	mx         sync.Mutex
+	inProgress map[gameKey]bool
+	wg         sync.WaitGroup
+
+	// SpectateOptions are passed to the SpectateAPI of each
+	// recording
+	SpectateOptions []SpectateOption
+}
+
+// NewReplayRecorder creates a new ReplayRecorder that stores its
+// replays in manager, and that records at most maxParallel games at
+// the same time.
+func NewReplayRecorder(manager ReplayManager, maxParallel int) (*ReplayRecorder, error) {
+	if manager == nil {
+		return nil, fmt.Errorf("Empty replay manager")
+	}
+	if maxParallel <= 0 {
+		return nil, fmt.Errorf("Invalid number of parallel recordings %d", maxParallel)
+	}
+	return &ReplayRecorder{
+		manager:    manager,
+		tokens:     make(chan bool, maxParallel),
+		inProgress: make(map[gameKey]bool),
+	}, nil
+}
+
+// IsRecording returns true if the game is currently being recorded
+func (r *ReplayRecorder) IsRecording(region *lol.Region, id lol.GameID) bool {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.inProgress[gameKey{platformID: region.PlatformID(), id: id}]
+}
+
+// reserve marks a game as being recorded, if it is not already and
+// if the maximal number of parallel recordings is not reached.
+func (r *ReplayRecorder) reserve(key gameKey) error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if r.inProgress[key] == true {
+		return ErrAlreadyRecording
+	}
+
+	select {
+	case r.tokens <- true:
+	default:
+		return ErrTooManyRecordings
+	}
+
+	r.inProgress[key] = true
+	r.wg.Add(1)
+	return nil
+}
+
+// release marks a game reserved with reserve as not being recorded
+// anymore
+func (r *ReplayRecorder) release(key gameKey) {
+	r.mx.Lock()
+	delete(r.inProgress, key)
+	r.mx.Unlock()
+	<-r.tokens
+	r.wg.Done()
+}
+
+// Record starts to record in the background the game described by
+// info. If highlight is not zero, the corresponding Summoner will be
+// highlighted in the Replay. It returns ErrAlreadyRecording or
+// ErrTooManyRecordings if the recording could not be started. The
+// recording is interrupted when ctx is cancelled, and can be resumed
+// later.
+func (r *ReplayRecorder) Record(ctx context.Context, region *lol.Region, info lol.CurrentGameInfo, highlight lol.SummonerID) error {
+	key := gameKey{platformID: region.PlatformID(), id: info.ID}
+
+	if err := r.reserve(key); err != nil {
+		if err == ErrTooManyRecordings {
+			log.Printf("Skipping game %s/%d: already recording %d games", key.platformID, key.id, cap(r.tokens))
+		}
+		return err
+	}
+
+	w, err := r.writer(region, info, highlight)
+	if err != nil {
+		r.release(key)
+		return err
+	}
+
+	go func() {
+		defer r.release(key)
+		err := r.record(ctx, region, info, highlight, w)
+		switch {
+		case err == nil:
+		case err == ctx.Err():
+			log.Printf("Recording of game %s/%d interrupted, it can be resumed later", key.platformID, key.id)
+		default:
+			log.Printf("Could not record game %s/%d: %s", key.platformID, key.id, err)
+		}
+	}()
+
+	return nil
+}
+
+// writer returns the ReplayDataWriter to use to record the game. If
+// a previous recording of the game was interrupted, it is resumed.
+// Otherwise a new replay is created, and the game information is
+// immediately saved so it will not be lost if this recording is
+// interrupted too.
+func (r *ReplayRecorder) writer(region *lol.Region, info lol.CurrentGameInfo, highlight lol.SummonerID) (ReplayDataWriter, error) {
+	if w, err := r.manager.Resume(region, info.ID); err == nil {
+		log.Printf("Resuming interrupted recording of game %s/%d", region.PlatformID(), info.ID)
+		return w, nil
+	}
+
+	w, err := r.manager.Create(region, info.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	replay := NewEmptyReplay()
+	replay.EncryptionKey = info.Observer.EncryptionKey
+	replay.AddGameInfo(info)
+	if highlight != 0 {
+		if err := replay.HighlightSummoner(highlight); err != nil {
+			return nil, err
+		}
+	}
+	if err := replay.unsafeSave(w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (r *ReplayRecorder) record(ctx context.Context, region *lol.Region, info lol.CurrentGameInfo, highlight lol.SummonerID, w ReplayDataWriter) error {
+	api, err := NewSpectateAPI(region, info.ID, r.SpectateOptions...)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Starting to record game %s/%d", region.PlatformID(), info.ID)
+	// a Replay that misses some data is stored anyway, the lost
+	// Chunks and KeyFrames are listed in its metadata
+	replay, err := api.SpectateGame(ctx, info.Observer.EncryptionKey, w)
+	missing, incomplete := err.(MissingDataError)
+	if err != nil && incomplete == false {
+		return err
+	}
+
+	replay.AddGameInfo(info)
+	if highlight != 0 {
+		if err := replay.HighlightSummoner(highlight); err != nil {
+			return err
+		}
+	}
+
+	if err := r.manager.Store(replay); err != nil {
+		return err
+	}
+	if incomplete == true {
+		log.Printf("Game %s/%d recorded, but some data is lost: %s", region.PlatformID(), info.ID, missing)
+		return nil
+	}
+	log.Printf("Game %s/%d recorded", region.PlatformID(), info.ID)
+	return nil
+}
+
+// Wait waits for all current recordings to finish
+func (r *ReplayRecorder) Wait() {
+	r.wg.Wait()
+}
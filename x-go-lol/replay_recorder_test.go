@@ -0,0 +1,139 @@
+package xlol
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/atuleu/go-lol"
+	. "gopkg.in/check.v1"
+)
+
+type ReplayRecorderSuite struct {
+	region *lol.Region
+}
+
+var _ = Suite(&ReplayRecorderSuite{})
+
+func (s *ReplayRecorderSuite) SetUpSuite(c *C) {
+	var err error
+	s.region, err = lol.NewRegionByCode("euw")
+	c.Assert(err, IsNil)
+}
+
+func testGameInfo(id lol.GameID, encryptionKey string) lol.CurrentGameInfo {
+	info := lol.CurrentGameInfo{ID: id}
+	info.Observer.EncryptionKey = encryptionKey
+	return info
+}
+
+func (s *ReplayRecorderSuite) TestRecordsGame(c *C) {
+	original := newTestReplay(16, 300)
+	server, baseURL, closeServer := serveTestReplay(c, original, 10, SystemClock)
+	defer closeServer()
+
+	m := NewMemoryReplayManager()
+	recorder, err := NewReplayRecorder(m, 2)
+	c.Assert(err, IsNil)
+	recorder.SpectateOptions = []SpectateOption{
+		WithBaseURL(baseURL),
+		WithTimeout(5 * time.Second),
+		WithMinPollInterval(10 * time.Millisecond),
+	}
+
+	id := original.MetaData.GameKey.ID
+	info := testGameInfo(id, server.EncryptionKey())
+	c.Assert(recorder.Record(context.Background(), s.region, info, 0), IsNil)
+	c.Check(recorder.IsRecording(s.region, id), Equals, true)
+	c.Check(recorder.Record(context.Background(), s.region, info, 0), Equals, ErrAlreadyRecording)
+	recorder.Wait()
+	c.Check(recorder.IsRecording(s.region, id), Equals, false)
+
+	loader, err := m.Get(s.region, id)
+	c.Assert(err, IsNil)
+	replay, err := LoadReplayWithData(loader)
+	c.Assert(err, IsNil)
+	c.Check(replay.GameInfo.ID, Equals, id)
+	c.Check(replay.Chunks, HasLen, len(original.Chunks))
+	c.Check(replay.KeyFrames, HasLen, len(original.KeyFrames))
+}
+
+func (s *ReplayRecorderSuite) TestLimitsParallelRecordings(c *C) {
+	// the spectator server does not answer until released
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	m := NewMemoryReplayManager()
+	recorder, err := NewReplayRecorder(m, 1)
+	c.Assert(err, IsNil)
+	recorder.SpectateOptions = []SpectateOption{WithBaseURL(server.URL)}
+
+	c.Assert(recorder.Record(context.Background(), s.region, testGameInfo(1, "key"), 0), IsNil)
+	c.Check(recorder.Record(context.Background(), s.region, testGameInfo(2, "key"), 0), Equals, ErrTooManyRecordings)
+	c.Check(recorder.IsRecording(s.region, 1), Equals, true)
+	c.Check(recorder.IsRecording(s.region, 2), Equals, false)
+
+	// the game information is saved before the recording starts
+	c.Check(m.IncompleteReplays()[s.region.Code()], HasLen, 1)
+
+	close(release)
+	recorder.Wait()
+	c.Check(recorder.IsRecording(s.region, 1), Equals, false)
+
+	// a slot is available again, a failed recording is resumed
+	c.Assert(recorder.Record(context.Background(), s.region, testGameInfo(1, "key"), 0), IsNil)
+	recorder.Wait()
+	c.Check(m.IncompleteReplays()[s.region.Code()], HasLen, 1)
+}
+
+func (s *ReplayRecorderSuite) TestStoresGameWithMissingData(c *C) {
+	original := newTestReplay(16, 300)
+	server, baseURL, closeServer := serveTestReplay(c, original, 10, SystemClock)
+	defer closeServer()
+
+	// Chunk 2 is never available
+	u, err := url.Parse(baseURL)
+	c.Assert(err, IsNil)
+	served := httputil.NewSingleHostReverseProxy(u)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, Prefix+string(GetGameDataChunk)+"/EUW1/2190090792/2/") == true {
+			http.NotFound(w, r)
+			return
+		}
+		served.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+
+	m := NewMemoryReplayManager()
+	recorder, err := NewReplayRecorder(m, 1)
+	c.Assert(err, IsNil)
+	recorder.SpectateOptions = []SpectateOption{
+		WithBaseURL(proxy.URL),
+		WithTimeout(5 * time.Second),
+		WithMinPollInterval(10 * time.Millisecond),
+	}
+
+	id := original.MetaData.GameKey.ID
+	c.Assert(recorder.Record(context.Background(), s.region, testGameInfo(id, server.EncryptionKey()), 0), IsNil)
+	recorder.Wait()
+
+	c.Check(m.IncompleteReplays()[s.region.Code()], HasLen, 0)
+	c.Check(m.Replays()[s.region.Code()], HasLen, 1)
+	loader, err := m.Get(s.region, id)
+	c.Assert(err, IsNil)
+	replay, err := LoadReplayWithData(loader)
+	c.Assert(err, IsNil)
+	c.Check(replay.MissingChunks, DeepEquals, []ChunkID{2})
+	c.Check(replay.MissingKeyFrames, HasLen, 0)
+	c.Check(loader.HasChunk(2), Equals, false)
+	c.Check(loader.HasChunk(3), Equals, true)
+	c.Check(replay.endOfGameStats, DeepEquals, original.endOfGameStats)
+}
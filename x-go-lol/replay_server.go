@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -19,18 +20,31 @@ type lastChunkInfoGenerator func() LastChunkInfo
 type ReplayServer struct {
 	loader             ReplayDataLoader
 	r                  *Replay
+	firstGameChunk     ChunkID
 	startStreamChunk   ChunkID
 	metadataRequester  chan GameMetadata
 	chunkInfoRequester chan lastChunkInfoGenerator
+	controlRequester   chan controlRequest
+	started            chan struct{}
 	finish             chan struct{}
+	startOnce          sync.Once
+	stopOnce           sync.Once
 	listener           net.Listener
 	TimeDivisor        DurationMs
+	// Clock is used to stream the replay, it is SystemClock by
+	// default
+	Clock Clock
 }
 
 // NewReplayServer initializes a ReplayServer from data located somewhere
 func NewReplayServer(loader ReplayDataLoader) (*ReplayServer, error) {
 	res := &ReplayServer{
-		loader: loader,
+		loader:             loader,
+		metadataRequester:  make(chan GameMetadata),
+		chunkInfoRequester: make(chan lastChunkInfoGenerator),
+		controlRequester:   make(chan controlRequest),
+		started:            make(chan struct{}),
+		finish:             make(chan struct{}),
 	}
 	if loader == nil {
 		return nil, fmt.Errorf("Empty loader")
@@ -48,11 +62,13 @@ func NewReplayServer(loader ReplayDataLoader) (*ReplayServer, error) {
 		if c.isAssociated() == false {
 			continue
 		}
-		res.startStreamChunk = c.ID
+		res.firstGameChunk = c.ID
 		break
 	}
+	res.startStreamChunk = res.firstGameChunk
 
 	res.TimeDivisor = 4
+	res.Clock = SystemClock
 	return res, nil
 }
 
@@ -95,11 +111,11 @@ func handleVersion(h *ReplayServer, parts []string, w http.ResponseWriter, req *
 	}
 }
 
-func (h *ReplayServer) generateMetadata(currentChunk ChunkID) GameMetadata {
+func (h *ReplayServer) generateMetadata(st streamState) GameMetadata {
 	res := h.r.MetaData
 	res.ClientBackFetchingEnabled = true
 	var kfid KeyFrameID = -1
-	for cid := h.startStreamChunk; cid <= currentChunk; cid++ {
+	for cid := st.first; cid <= st.current; cid++ {
 		c := h.r.Chunks[h.r.chunksByID[cid]]
 		res.PendingAvailableChunkInfo = append(res.PendingAvailableChunkInfo, c.ChunkInfo)
 		if c.KeyFrame != kfid {
@@ -115,10 +131,10 @@ func toDurationMs(d time.Duration) DurationMs {
 	return DurationMs(d / time.Millisecond)
 }
 
-func (h *ReplayServer) generateLastChunkInfo(currentChunk ChunkID, emitDate time.Time) (time.Time, lastChunkInfoGenerator) {
-	c, ok := h.r.ChunkByID(currentChunk)
+func (h *ReplayServer) generateLastChunkInfo(st streamState) lastChunkInfoGenerator {
+	c, ok := h.r.ChunkByID(st.current)
 	if ok == false {
-		panic(fmt.Sprintf("Missing chunk %d", currentChunk))
+		panic(fmt.Sprintf("Missing chunk %d", st.current))
 	}
 
 	kf, ok := h.r.KeyFrameByID(c.KeyFrame)
@@ -127,7 +143,7 @@ func (h *ReplayServer) generateLastChunkInfo(currentChunk ChunkID, emitDate time
 	}
 
 	res := LastChunkInfo{
-		ID:                   currentChunk,
+		ID:                   st.current,
 		AssociatedKeyFrameID: c.KeyFrame,
 		NextChunkID:          kf.NextChunkID,
 		EndStartupChunkID:    ChunkID(h.r.MetaData.EndStartupChunkID),
@@ -136,12 +152,17 @@ func (h *ReplayServer) generateLastChunkInfo(currentChunk ChunkID, emitDate time
 		Duration:             c.Duration,
 	}
 
-	nextDate := emitDate.Add((res.Duration / h.TimeDivisor).Duration())
-	return nextDate, func() LastChunkInfo {
-		now := time.Now()
-		res.AvailableSince = toDurationMs(now.Sub(emitDate))
-		if now.Before(nextDate) {
-			res.NextAvailableChunk = toDurationMs(nextDate.Sub(now))
+	return func() LastChunkInfo {
+		if st.started == false {
+			res.NextAvailableChunk = c.Duration / st.timeDivisor
+			return res
+		}
+		now := h.Clock.Now()
+		res.AvailableSince = toDurationMs(now.Sub(st.emitDate))
+		if st.paused == true {
+			res.NextAvailableChunk = toDurationMs(st.remaining)
+		} else if now.Before(st.nextDate) {
+			res.NextAvailableChunk = toDurationMs(st.nextDate.Sub(now))
 		} else {
 			res.NextAvailableChunk = 0
 		}
@@ -277,6 +298,10 @@ func (h *ReplayServer) handle(w http.ResponseWriter, req *http.Request) {
 	log.Printf("Got request %s %s %s from %s", req.Proto, req.Method, req.URL.Path, req.RemoteAddr)
 
 	URL := req.URL.Path
+	if strings.HasPrefix(URL, ControlPrefix) == true {
+		h.handleControl(strings.TrimPrefix(URL, ControlPrefix), w, req)
+		return
+	}
 	if strings.HasPrefix(URL, Prefix) == false {
 		w.WriteHeader(http.StatusNotFound)
 		return
@@ -285,12 +310,14 @@ func (h *ReplayServer) handle(w http.ResponseWriter, req *http.Request) {
 	parts := strings.Split(strings.TrimPrefix(URL, Prefix), "/")
 	if len(parts) == 0 {
 		w.WriteHeader(http.StatusNotFound)
+		return
 	}
 	function := SpectateFunction(parts[0])
 
 	handler, ok := restMapping[function]
 	if ok == false {
 		w.WriteHeader(http.StatusNotFound)
+		return
 	}
 
 	handler(h, parts, w, req)
@@ -304,55 +331,92 @@ func (h *ReplayServer) Close() error {
 	// this will close the intern loop, making new dynamic request
 	// returnning 404 and exiting, we defer it because we want it to
 	// happen after listener is closed.
-	defer close(h.finish)
+	defer h.stop()
 	// This will close the listening for new connection
 	return h.listener.Close()
 }
 
-func (h *ReplayServer) internLoop() {
-	shouldContinue := true
-	currentChunkID := h.startStreamChunk
-	currentMetadata := h.generateMetadata(currentChunkID)
-	c, ok := h.r.ChunkByID(currentChunkID)
-	if ok == false {
-		panic(fmt.Sprintf("Missing chunk %d", currentChunkID))
-	}
-	kf, ok := h.r.KeyFrameByID(c.KeyFrame)
+// start starts streaming the replay, if it is not already started
+func (h *ReplayServer) start() {
+	h.startOnce.Do(func() {
+		go h.internLoop()
+		close(h.started)
+	})
+}
+
+// stop stops streaming the replay
+func (h *ReplayServer) stop() {
+	h.stopOnce.Do(func() {
+		close(h.finish)
+	})
+}
+
+// streamState is the state of the stream of the replay. It is owned
+// by internLoop.
+type streamState struct {
+	// first Chunk listed in the metadata
+	first ChunkID
+	// last Chunk available to the client
+	current     ChunkID
+	timeDivisor DurationMs
+	// the stream starts with the first request of the client
+	started bool
+	paused  bool
+	// when current was made available
+	emitDate time.Time
+	// when the next Chunk will be available, if not paused
+	nextDate time.Time
+	// time left before the next Chunk, when paused
+	remaining time.Duration
+}
+
+// chunkInterval returns the time the Chunk id is streamed for
+func (h *ReplayServer) chunkInterval(id ChunkID, st streamState) time.Duration {
+	c, ok := h.r.ChunkByID(id)
 	if ok == false {
-		panic(fmt.Sprintf("Missing kf %d", c.KeyFrame))
+		panic(fmt.Sprintf("Missing chunk %d", id))
 	}
+	return (c.Duration / st.timeDivisor).Duration()
+}
 
-	startChunkInfo := LastChunkInfo{
-		ID:                   c.ID,
-		AvailableSince:       0,
-		NextAvailableChunk:   c.Duration / h.TimeDivisor,
-		AssociatedKeyFrameID: kf.ID,
-		NextChunkID:          kf.NextChunkID,
-		EndStartupChunkID:    ChunkID(h.r.MetaData.EndStartupChunkID),
-		StartGameChunkID:     ChunkID(h.r.MetaData.StartGameChunkID),
-		EndGameChunkID:       ChunkID(h.r.MetaData.EndGameChunkID),
-		Duration:             c.Duration,
-	}
-	currentGenerator := func() LastChunkInfo {
-		return startChunkInfo
+func (h *ReplayServer) internLoop() {
+	st := streamState{
+		first:       h.startStreamChunk,
+		current:     h.startStreamChunk,
+		timeDivisor: h.TimeDivisor,
+	}
+	var currentMetadata GameMetadata
+	var currentGenerator lastChunkInfoGenerator
+	// fires when the next Chunk is available, nil if it will not
+	// be. Timers that are not current anymore are simply ignored.
+	var tick <-chan time.Time
+
+	update := func() {
+		currentMetadata = h.generateMetadata(st)
+		currentGenerator = h.generateLastChunkInfo(st)
+		tick = nil
+		if st.started == true && st.paused == false && st.current < ChunkID(h.r.MetaData.EndGameChunkID) {
+			tick = h.Clock.After(st.nextDate.Sub(h.Clock.Now()))
+		}
 	}
+	update()
 
-	//internal channel
-	tick := make(chan bool)
-	defer close(tick)
-
-	bootstrapped := false
 	bootstrap := func() {
-		if bootstrapped == false {
-			bootstrapped = true
-			log.Printf("Started data increment loop")
-			go func() {
-				<-time.After(c.Duration.Duration() / 10)
-				tick <- true
-			}()
+		if st.started == true {
+			return
+		}
+		log.Printf("Started data increment loop")
+		c, _ := h.r.ChunkByID(st.current)
+		st.started = true
+		st.emitDate = h.Clock.Now()
+		st.nextDate = st.emitDate.Add(c.Duration.Duration() / 10)
+		if st.paused == true {
+			st.remaining = st.nextDate.Sub(st.emitDate)
 		}
+		update()
 	}
 
+	shouldContinue := true
 	for shouldContinue {
 		select {
 		case <-h.finish:
@@ -363,24 +427,18 @@ func (h *ReplayServer) internLoop() {
 			bootstrap()
 		case h.chunkInfoRequester <- currentGenerator:
 			bootstrap()
-		case <-tick:
-			if currentChunkID >= ChunkID(h.r.MetaData.EndGameChunkID) {
-				// internal error catchup
-				continue
-			}
-			currentChunkID++
-			emitDate := time.Now()
-			log.Printf("Incrementing to chunk %d", currentChunkID)
-			currentMetadata = h.generateMetadata(currentChunkID)
-			var nextDate time.Time
-			nextDate, currentGenerator = h.generateLastChunkInfo(currentChunkID, emitDate)
-			if currentChunkID < ChunkID(h.r.MetaData.EndGameChunkID) {
-				//not at the end, we will increment the counter in the future
-				go func() {
-					<-time.After(nextDate.Sub(emitDate))
-					tick <- true
-				}()
+		case req := <-h.controlRequester:
+			err := req.apply(&st, h.Clock.Now())
+			if err == nil {
+				update()
 			}
+			req.result <- err
+		case <-tick:
+			st.current++
+			log.Printf("Incrementing to chunk %d", st.current)
+			st.emitDate = h.Clock.Now()
+			st.nextDate = st.emitDate.Add(h.chunkInterval(st.current, st))
+			update()
 		}
 	}
 
@@ -393,21 +451,26 @@ func (h *ReplayServer) internLoop() {
 // ListenAndServe starts an http Server on the given address to show
 // the replay
 func (h *ReplayServer) ListenAndServe(addr string) error {
-	//we must start intern loop for serving data over time
-	var err error
-	h.listener, err = net.Listen("tcp", addr)
+	l, err := net.Listen("tcp", addr)
 	if err != nil {
 		return err
 	}
+	return h.Serve(l)
+}
 
-	h.metadataRequester = make(chan GameMetadata)
-	h.chunkInfoRequester = make(chan lastChunkInfoGenerator)
-	h.finish = make(chan struct{})
-	go h.internLoop()
+// Serve shows the replay over http to the connections accepted by
+// l. It returns once the ReplayServer is closed.
+func (h *ReplayServer) Serve(l net.Listener) error {
+	//we must start intern loop for serving data over time
+	h.listener = l
+	h.start()
+	return serveHTTP(l, h.handle)
+}
 
-	err = http.Serve(h.listener, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		h.handle(w, req)
-	}))
+// serveHTTP serves over http the connections accepted by l, until l
+// is closed.
+func serveHTTP(l net.Listener, handler http.HandlerFunc) error {
+	err := http.Serve(l, handler)
 
 	// Closing the connection will lead to this kind of nasty thing. We
 	// should maybe use some kind of framework or implement a closable
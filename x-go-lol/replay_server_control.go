@@ -0,0 +1,296 @@
+package xlol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ControlPrefix is the prefix of the control API of a ReplayServer.
+// It accepts the following requests:
+//
+//	GET  /control/status
+//	POST /control/pause
+//	POST /control/resume
+//	POST /control/speed?factor=8
+//	POST /control/seek?time=12m30s
+//	POST /control/seek?keyframe=12
+//	POST /control/seek?bookmark=baron
+const ControlPrefix = "/control/"
+
+// ErrServerClosed is returned by the control methods of a closed
+// ReplayServer
+var ErrServerClosed = errors.New("Replay server is closed")
+
+// ErrServerNotStarted is returned by the control methods of a
+// ReplayServer that is not serving yet
+var ErrServerNotStarted = errors.New("Replay server is not serving")
+
+// A ReplayStatus describes the current state of the stream of a
+// ReplayServer
+type ReplayStatus struct {
+	Chunk       ChunkID    `json:"chunkId"`
+	KeyFrame    KeyFrameID `json:"keyFrameId"`
+	GameTime    DurationMs `json:"gameTime"`
+	Paused      bool       `json:"paused"`
+	TimeDivisor DurationMs `json:"timeDivisor"`
+}
+
+// a controlRequest modifies the streamState of internLoop
+type controlRequest struct {
+	apply  func(st *streamState, now time.Time) error
+	result chan error
+}
+
+// control applies a modification to the stream. It fails if the
+// server is not serving.
+func (h *ReplayServer) control(apply func(st *streamState, now time.Time) error) error {
+	req := controlRequest{
+		apply:  apply,
+		result: make(chan error, 1),
+	}
+	select {
+	case <-h.started:
+	case <-h.finish:
+		return ErrServerClosed
+	default:
+		return ErrServerNotStarted
+	}
+	select {
+	case h.controlRequester <- req:
+	case <-h.finish:
+		return ErrServerClosed
+	}
+	return <-req.result
+}
+
+// Pause stops the stream on the current Chunk
+func (h *ReplayServer) Pause() error {
+	return h.control(func(st *streamState, now time.Time) error {
+		if st.paused == true {
+			return nil
+		}
+		st.paused = true
+		if st.started == true {
+			st.remaining = st.nextDate.Sub(now)
+			if st.remaining < 0 {
+				st.remaining = 0
+			}
+		}
+		return nil
+	})
+}
+
+// Resume resumes a paused stream
+func (h *ReplayServer) Resume() error {
+	return h.control(func(st *streamState, now time.Time) error {
+		if st.paused == false {
+			return nil
+		}
+		st.paused = false
+		if st.started == true {
+			st.nextDate = now.Add(st.remaining)
+		}
+		return nil
+	})
+}
+
+// SetTimeDivisor changes the speed of the stream. The time left
+// before the next Chunk is scaled accordingly.
+func (h *ReplayServer) SetTimeDivisor(divisor DurationMs) error {
+	if divisor <= 0 {
+		return fmt.Errorf("Invalid time divisor %d", divisor)
+	}
+	return h.control(func(st *streamState, now time.Time) error {
+		scale := func(d time.Duration) time.Duration {
+			return d * time.Duration(st.timeDivisor) / time.Duration(divisor)
+		}
+		if st.paused == true {
+			st.remaining = scale(st.remaining)
+		} else if st.started == true && now.Before(st.nextDate) {
+			st.nextDate = now.Add(scale(st.nextDate.Sub(now)))
+		}
+		st.timeDivisor = divisor
+		return nil
+	})
+}
+
+// keyFrameStart returns the first Chunk streamed when starting from
+// the KeyFrame id
+func (h *ReplayServer) keyFrameStart(id KeyFrameID) (ChunkID, error) {
+	kf, ok := h.r.KeyFrameByID(id)
+	if ok == false {
+		return 0, fmt.Errorf("Unknown KeyFrame %d", id)
+	}
+	start := kf.NextChunkID
+	if start < h.firstGameChunk {
+		start = h.firstGameChunk
+	}
+	if _, ok := h.r.ChunkByID(start); ok == false {
+		return 0, fmt.Errorf("Missing Chunk %d of KeyFrame %d", start, id)
+	}
+	return start, nil
+}
+
+// StartAtKeyFrame makes the stream start from the KeyFrame id instead
+// of the beginning of the game. It must be called before Serve.
+func (h *ReplayServer) StartAtKeyFrame(id KeyFrameID) error {
+	start, err := h.keyFrameStart(id)
+	if err != nil {
+		return err
+	}
+	h.startStreamChunk = start
+	return nil
+}
+
+// StartAtGameTime makes the stream start from the last KeyFrame before
+// the game time t. It must be called before Serve.
+func (h *ReplayServer) StartAtGameTime(t time.Duration) error {
+	id, err := h.r.KeyFrameAt(t)
+	if err != nil {
+		return err
+	}
+	return h.StartAtKeyFrame(id)
+}
+
+// StartAtBookmark makes the stream start from the KeyFrame of the
+// Bookmark name. It must be called before Serve.
+func (h *ReplayServer) StartAtBookmark(name string) error {
+	b, ok := h.r.BookmarkByName(name)
+	if ok == false {
+		return fmt.Errorf("Unknown bookmark %s", name)
+	}
+	return h.StartAtKeyFrame(b.KeyFrame)
+}
+
+// SeekKeyFrame restarts the stream from the KeyFrame id. The client
+// is given the KeyFrame and its first Chunk, as if the game was
+// streamed live from there.
+func (h *ReplayServer) SeekKeyFrame(id KeyFrameID) error {
+	start, err := h.keyFrameStart(id)
+	if err != nil {
+		return err
+	}
+
+	return h.control(func(st *streamState, now time.Time) error {
+		st.first = start
+		st.current = start
+		if st.started == true {
+			st.emitDate = now
+			st.nextDate = now.Add(h.chunkInterval(start, *st))
+			st.remaining = st.nextDate.Sub(now)
+		}
+		return nil
+	})
+}
+
+// SeekGameTime restarts the stream from the last KeyFrame before the
+// game time t.
+func (h *ReplayServer) SeekGameTime(t time.Duration) error {
+	id, err := h.r.KeyFrameAt(t)
+	if err != nil {
+		return err
+	}
+	return h.SeekKeyFrame(id)
+}
+
+// SeekBookmark restarts the stream from the KeyFrame of the Bookmark
+// name
+func (h *ReplayServer) SeekBookmark(name string) error {
+	b, ok := h.r.BookmarkByName(name)
+	if ok == false {
+		return fmt.Errorf("Unknown bookmark %s", name)
+	}
+	return h.SeekKeyFrame(b.KeyFrame)
+}
+
+// Status returns the current state of the stream
+func (h *ReplayServer) Status() (ReplayStatus, error) {
+	var res ReplayStatus
+	err := h.control(func(st *streamState, now time.Time) error {
+		c, _ := h.r.ChunkByID(st.current)
+		res = ReplayStatus{
+			Chunk:       st.current,
+			KeyFrame:    c.KeyFrame,
+			GameTime:    toDurationMs(h.r.GameTime(st.current)),
+			Paused:      st.paused,
+			TimeDivisor: st.timeDivisor,
+		}
+		return nil
+	})
+	return res, err
+}
+
+func (h *ReplayServer) handleControl(command string, w http.ResponseWriter, req *http.Request) {
+	if command == "status" {
+		if req.Method != "GET" {
+			http.Error(w, "status only accepts GET", http.StatusMethodNotAllowed)
+			return
+		}
+	} else if req.Method != "POST" {
+		http.Error(w, fmt.Sprintf("%s only accepts POST", command), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var err error
+	switch command {
+	case "status":
+	case "pause":
+		err = h.Pause()
+	case "resume":
+		err = h.Resume()
+	case "speed":
+		var factor int64
+		factor, err = strconv.ParseInt(req.FormValue("factor"), 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid speed factor: %s", err), http.StatusBadRequest)
+			return
+		}
+		err = h.SetTimeDivisor(DurationMs(factor))
+	case "seek":
+		if len(req.FormValue("bookmark")) != 0 {
+			err = h.SeekBookmark(req.FormValue("bookmark"))
+		} else if len(req.FormValue("keyframe")) != 0 {
+			var id int64
+			id, err = strconv.ParseInt(req.FormValue("keyframe"), 10, 64)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid KeyFrame: %s", err), http.StatusBadRequest)
+				return
+			}
+			err = h.SeekKeyFrame(KeyFrameID(id))
+		} else {
+			var t time.Duration
+			t, err = time.ParseDuration(req.FormValue("time"))
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid game time: %s", err), http.StatusBadRequest)
+				return
+			}
+			err = h.SeekGameTime(t)
+		}
+	default:
+		http.NotFound(w, req)
+		return
+	}
+
+	if err == ErrServerClosed || err == ErrServerNotStarted {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status, err := h.Status()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header()["Content-Type"] = []string{"application/json"}
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,178 @@
+package xlol
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/atuleu/go-lol"
+	. "gopkg.in/check.v1"
+)
+
+type ReplayServerControlSuite struct {
+	clock   *ManualClock
+	server  *ReplayServer
+	api     *SpectateAPI
+	baseURL string
+	errors  chan error
+}
+
+var _ = Suite(&ReplayServerControlSuite{})
+
+func (s *ReplayServerControlSuite) SetUpTest(c *C) {
+	formatter, err := NewExpandedReplayFormatter(c.MkDir())
+	c.Assert(err, IsNil)
+	original := newTestReplay(16, 30000)
+	_, err = original.AddBookmark("baron", 3*time.Minute)
+	c.Assert(err, IsNil)
+	c.Assert(original.SaveWithData(formatter), IsNil)
+
+	s.server, err = NewReplayServer(formatter)
+	c.Assert(err, IsNil)
+	s.server.TimeDivisor = 1
+	s.clock = NewManualClock(time.Date(2015, 7, 7, 12, 0, 0, 0, time.UTC))
+	s.server.Clock = s.clock
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	s.baseURL = "http://" + l.Addr().String()
+	s.errors = make(chan error, 1)
+	go func() {
+		s.errors <- s.server.Serve(l)
+	}()
+	<-s.server.started
+
+	region, err := lol.NewRegionByCode("euw")
+	c.Assert(err, IsNil)
+	s.api, err = NewSpectateAPI(region, original.MetaData.GameKey.ID, WithBaseURL(s.baseURL))
+	c.Assert(err, IsNil)
+}
+
+func (s *ReplayServerControlSuite) TearDownTest(c *C) {
+	c.Check(s.server.Close(), IsNil)
+	c.Check(<-s.errors, IsNil)
+}
+
+func (s *ReplayServerControlSuite) post(c *C, command string, values url.Values) (ReplayStatus, int) {
+	resp, err := http.PostForm(s.baseURL+ControlPrefix+command, values)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	var status ReplayStatus
+	if resp.StatusCode == http.StatusOK {
+		c.Assert(json.NewDecoder(resp.Body).Decode(&status), IsNil)
+	}
+	return status, resp.StatusCode
+}
+
+// waitChunk waits for the stream to reach id, as the clock timers
+// are processed asynchronously.
+func (s *ReplayServerControlSuite) waitChunk(c *C, id ChunkID) {
+	for i := 0; i < 100; i++ {
+		status, err := s.server.Status()
+		c.Assert(err, IsNil)
+		if status.Chunk == id {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	c.Fatalf("Stream did not reach Chunk %d", id)
+}
+
+func (s *ReplayServerControlSuite) TestPauseAndSpeed(c *C) {
+	var cInfo LastChunkInfo
+	c.Assert(s.api.Get(GetLastChunkInfo, 1, &cInfo), IsNil)
+	c.Check(cInfo.ID, Equals, ChunkID(6))
+
+	status, code := s.post(c, "pause", nil)
+	c.Assert(code, Equals, http.StatusOK)
+	c.Check(status.Paused, Equals, true)
+
+	s.clock.Advance(10 * time.Minute)
+	status, err := s.server.Status()
+	c.Assert(err, IsNil)
+	c.Check(status.Chunk, Equals, ChunkID(6))
+	c.Assert(s.api.Get(GetLastChunkInfo, 1, &cInfo), IsNil)
+	c.Check(cInfo.NextAvailableChunk, Equals, DurationMs(3000))
+
+	status, code = s.post(c, "speed", url.Values{"factor": {"3"}})
+	c.Assert(code, Equals, http.StatusOK)
+	c.Check(status.TimeDivisor, Equals, DurationMs(3))
+	c.Assert(s.api.Get(GetLastChunkInfo, 1, &cInfo), IsNil)
+	c.Check(cInfo.NextAvailableChunk, Equals, DurationMs(1000))
+
+	_, code = s.post(c, "resume", nil)
+	c.Assert(code, Equals, http.StatusOK)
+	s.clock.Advance(time.Second)
+	s.waitChunk(c, 7)
+	s.clock.Advance(10 * time.Second)
+	s.waitChunk(c, 8)
+}
+
+func (s *ReplayServerControlSuite) TestSeek(c *C) {
+	// starts the stream
+	var cInfo LastChunkInfo
+	c.Assert(s.api.Get(GetLastChunkInfo, 1, &cInfo), IsNil)
+
+	status, code := s.post(c, "seek", url.Values{"time": {"2m15s"}})
+	c.Assert(code, Equals, http.StatusOK)
+	c.Check(status.Chunk, Equals, ChunkID(10))
+	c.Check(status.KeyFrame, Equals, KeyFrameID(3))
+
+	var metadata GameMetadata
+	c.Assert(s.api.Get(GetGameMetaData, 1, &metadata), IsNil)
+	c.Check(metadata.PendingAvailableChunkInfo, HasLen, 1)
+	c.Check(metadata.PendingAvailableChunkInfo[0].ID, Equals, ChunkID(10))
+	c.Check(metadata.PendingAvailableKeyFrameInfo, HasLen, 1)
+	c.Check(metadata.PendingAvailableKeyFrameInfo[0].ID, Equals, KeyFrameID(3))
+	c.Assert(s.api.Get(GetLastChunkInfo, 1, &cInfo), IsNil)
+	c.Check(cInfo.ID, Equals, ChunkID(10))
+	c.Check(cInfo.AssociatedKeyFrameID, Equals, KeyFrameID(3))
+
+	s.clock.Advance(30 * time.Second)
+	s.waitChunk(c, 11)
+
+	status, code = s.post(c, "seek", url.Values{"keyframe": {"2"}})
+	c.Assert(code, Equals, http.StatusOK)
+	c.Check(status.Chunk, Equals, ChunkID(8))
+
+	_, code = s.post(c, "seek", url.Values{"time": {"1h"}})
+	c.Check(code, Equals, http.StatusBadRequest)
+	_, code = s.post(c, "seek", url.Values{"keyframe": {"42"}})
+	c.Check(code, Equals, http.StatusBadRequest)
+
+	resp, err := http.Get(s.baseURL + ControlPrefix + "pause")
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, Equals, http.StatusMethodNotAllowed)
+}
+
+func (s *ReplayServerControlSuite) TestSeekBookmark(c *C) {
+	var cInfo LastChunkInfo
+	c.Assert(s.api.Get(GetLastChunkInfo, 1, &cInfo), IsNil)
+
+	status, code := s.post(c, "seek", url.Values{"bookmark": {"baron"}})
+	c.Assert(code, Equals, http.StatusOK)
+	c.Check(status.Chunk, Equals, ChunkID(12))
+	c.Check(status.KeyFrame, Equals, KeyFrameID(4))
+
+	_, code = s.post(c, "seek", url.Values{"bookmark": {"dragon"}})
+	c.Check(code, Equals, http.StatusBadRequest)
+}
+
+func (s *ReplayServerControlSuite) TestFailsIfNotServing(c *C) {
+	server, err := NewReplayServer(s.server.loader)
+	c.Assert(err, IsNil)
+
+	c.Check(server.Pause(), Equals, ErrServerNotStarted)
+	_, err = server.Status()
+	c.Check(err, Equals, ErrServerNotStarted)
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", ControlPrefix+"pause", nil)
+	c.Assert(err, IsNil)
+	server.handle(w, req)
+	c.Check(w.Code, Equals, http.StatusServiceUnavailable)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"sort"
+	"time"
 
 	. "gopkg.in/check.v1"
 )
@@ -100,3 +101,85 @@ func (s *ReplaySuite) TestMergeDataShouldNotPanic(c *C) {
 	c.Check(string(JSON), Equals, string(expectedJSON))
 
 }
+
+func (s *ReplaySuite) TestResumeLoadsAvailableData(c *C) {
+	formatter, err := NewExpandedReplayFormatter(c.MkDir())
+	c.Assert(err, IsNil)
+
+	// nothing was recorded so far
+	replay, err := resumeReplay(formatter)
+	c.Assert(err, IsNil)
+	c.Check(len(replay.Chunks), Equals, 0)
+
+	partial := NewEmptyReplay()
+	partial.EncryptionKey = "some-key"
+	partial.MergeFromLastChunkInfo(LastChunkInfo{ID: 2, AssociatedKeyFrameID: 1, NextChunkID: 2, Duration: 30000})
+	c.Assert(partial.unsafeSave(formatter), IsNil)
+
+	// data for chunk 3 was saved, but not the replay data
+	for _, id := range []ChunkID{1, 2, 3} {
+		w, err := formatter.CreateChunk(id)
+		c.Assert(err, IsNil)
+		_, err = w.Write([]byte{byte(id)})
+		c.Assert(err, IsNil)
+		c.Assert(w.Close(), IsNil)
+	}
+	w, err := formatter.CreateKeyFrame(1)
+	c.Assert(err, IsNil)
+	_, err = w.Write([]byte{42})
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	replay, err = resumeReplay(formatter)
+	c.Assert(err, IsNil)
+	c.Check(replay.EncryptionKey, Equals, "some-key")
+	for _, id := range []ChunkID{1, 2, 3} {
+		c.Check(replay.hasChunkData(id), Equals, true, Commentf("chunk %d", id))
+	}
+	c.Check(replay.hasChunkData(4), Equals, false)
+	c.Check(replay.hasKeyFrameData(1), Equals, true)
+	c.Check(replay.hasKeyFrameData(2), Equals, false)
+	cData, ok := replay.ChunkByID(2)
+	c.Assert(ok, Equals, true)
+	c.Check(cData.Duration, Equals, DurationMs(30000))
+}
+
+func (s *ReplaySuite) TestGameTimeSkipsLoadingScreen(c *C) {
+	r := NewEmptyReplay()
+	r.MetaData.StartGameChunkID = 3
+	r.MetaData.ChunkTimeInterval = 30000
+	for _, ci := range []ChunkInfo{{ID: 1, Duration: 30000}, {ID: 2, Duration: 30000}, {ID: 3, Duration: 10000}, {ID: 4}, {ID: 5, Duration: 29000}} {
+		r.addChunk(Chunk{ChunkInfo: ci})
+	}
+
+	c.Check(r.GameTime(2), Equals, time.Duration(0))
+	c.Check(r.GameTime(3), Equals, 10*time.Second)
+	c.Check(r.GameTime(4), Equals, 40*time.Second)
+	c.Check(r.GameTime(5), Equals, 69*time.Second)
+}
+
+func (s *ReplaySuite) TestKeyFrameAtGameTime(c *C) {
+	r := newTestReplay(16, 30000)
+
+	testdata := []struct {
+		t        time.Duration
+		expected KeyFrameID
+	}{
+		{0, 1},
+		{59 * time.Second, 1},
+		{time.Minute, 2},
+		{2*time.Minute + 15*time.Second, 3},
+		{5*time.Minute + 30*time.Second, 6},
+	}
+
+	for _, d := range testdata {
+		id, err := r.KeyFrameAt(d.t)
+		if c.Check(err, IsNil) == false {
+			continue
+		}
+		c.Check(id, Equals, d.expected, Commentf("at %s", d.t))
+	}
+
+	_, err := r.KeyFrameAt(6 * time.Minute)
+	c.Check(err, ErrorMatches, "Game time 6m0s is after the end of the game \\(5m30s\\)")
+}
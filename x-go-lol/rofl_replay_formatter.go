@@ -0,0 +1,496 @@
+package xlol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/atuleu/go-lol"
+)
+
+// RoflReplayFormatter is a ReplayDataFormatter for the .rofl replay
+// files saved by the LoL client. Their Chunks and KeyFrames are
+// stored as sent by the spectator servers, so they can be served by
+// a ReplayServer.
+//
+// A .rofl file does not hold all the information of a Replay: when
+// it was not written by go-lol, Chunk durations and receive times are
+// unknown, the game platform is empty, and only the JSON summary of
+// the end of game statistics is available, which is used instead of
+// the data sent by the spectator servers. Files written by go-lol
+// embed the Replay data in their metadata, and are not signed, so
+// the LoL client may refuse them.
+//
+// A RoflReplayFormatter on an existing file is read-only. On a new
+// file, the data is kept in memory, and the file is only written when
+// the formatter is closed.
+//
+// The LoLReplay .lpr format is undocumented, and is not supported.
+type RoflReplayFormatter struct {
+	mx       sync.Mutex
+	filename string
+	file     *os.File
+
+	replayData     []byte
+	endOfGameStats []byte
+	chunks         map[ChunkID]roflEntry
+	keyFrames      map[KeyFrameID]roflEntry
+	modified       bool
+}
+
+// roflEntry is either a section of the file, or in memory data
+type roflEntry struct {
+	offset int64
+	size   int64
+	data   []byte
+}
+
+const (
+	roflMagic         string     = "RIOT\x00\x00"
+	roflChunkType     uint8      = 1
+	roflKeyFrameType  uint8      = 2
+	roflChunkInterval DurationMs = 30000
+)
+
+type roflHeader struct {
+	Magic               [6]byte
+	Signature           [256]byte
+	HeaderLength        uint16
+	FileLength          uint32
+	MetadataOffset      uint32
+	MetadataLength      uint32
+	PayloadHeaderOffset uint32
+	PayloadHeaderLength uint32
+	PayloadOffset       uint32
+}
+
+type roflPayloadHeader struct {
+	GameID              uint64
+	GameLength          uint32
+	KeyFrameCount       uint32
+	ChunkCount          uint32
+	EndStartupChunkID   uint32
+	StartGameChunkID    uint32
+	KeyFrameInterval    uint32
+	EncryptionKeyLength uint16
+}
+
+type roflEntryHeader struct {
+	ID          uint32
+	Type        uint8
+	Length      uint32
+	NextChunkID uint32
+	Offset      uint32
+}
+
+type roflMetadata struct {
+	GameLength      DurationMs `json:"gameLength"`
+	GameVersion     string     `json:"gameVersion"`
+	LastGameChunkID int        `json:"lastGameChunkId"`
+	LastKeyFrameID  int        `json:"lastKeyFrameId"`
+	StatsJSON       string     `json:"statsJson"`
+
+	GoLolReplay         json.RawMessage `json:"goLolReplay,omitempty"`
+	GoLolEndOfGameStats []byte          `json:"goLolEndOfGameStats,omitempty"`
+}
+
+// NewRoflReplayFormatter returns a ReplayDataFormatter that loads data
+// from the .rofl file filename if it exists, or that will write it
+// when closed otherwise.
+func NewRoflReplayFormatter(filename string) (*RoflReplayFormatter, error) {
+	res := &RoflReplayFormatter{
+		filename:  filename,
+		chunks:    make(map[ChunkID]roflEntry),
+		keyFrames: make(map[KeyFrameID]roflEntry),
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) == true {
+			return res, nil
+		}
+		return nil, err
+	}
+	res.file = f
+	if err := res.load(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Could not load ROFL file %s: %s", filename, err)
+	}
+	return res, nil
+}
+
+func (l *RoflReplayFormatter) load() error {
+	info, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	var header roflHeader
+	if err := binary.Read(io.NewSectionReader(l.file, 0, size), binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("Invalid header: %s", err)
+	}
+	if string(header.Magic[:]) != roflMagic {
+		return fmt.Errorf("Not a ROFL file")
+	}
+
+	// sizes are checked before any allocation, as the file may be
+	// truncated or corrupted
+	if int64(header.MetadataOffset)+int64(header.MetadataLength) > size {
+		return fmt.Errorf("Truncated metadata")
+	}
+	metadataData := make([]byte, header.MetadataLength)
+	if _, err := l.file.ReadAt(metadataData, int64(header.MetadataOffset)); err != nil {
+		return fmt.Errorf("Could not read metadata: %s", err)
+	}
+	var metadata roflMetadata
+	if err := json.Unmarshal(metadataData, &metadata); err != nil {
+		return fmt.Errorf("Invalid metadata: %s", err)
+	}
+
+	if int64(header.PayloadHeaderOffset)+int64(header.PayloadHeaderLength) > size {
+		return fmt.Errorf("Truncated payload header")
+	}
+	payloadHeader := io.NewSectionReader(l.file, int64(header.PayloadHeaderOffset), int64(header.PayloadHeaderLength))
+	var ph roflPayloadHeader
+	if err := binary.Read(payloadHeader, binary.LittleEndian, &ph); err != nil {
+		return fmt.Errorf("Invalid payload header: %s", err)
+	}
+	if int64(binary.Size(ph))+int64(ph.EncryptionKeyLength) > int64(header.PayloadHeaderLength) {
+		return fmt.Errorf("Invalid payload header: encryption key is truncated")
+	}
+	encryptionKey := make([]byte, ph.EncryptionKeyLength)
+	if _, err := io.ReadFull(payloadHeader, encryptionKey); err != nil {
+		return fmt.Errorf("Invalid payload header: %s", err)
+	}
+
+	count := int64(ph.ChunkCount) + int64(ph.KeyFrameCount)
+	entrySize := int64(binary.Size(roflEntryHeader{}))
+	dataOffset := int64(header.PayloadOffset) + count*entrySize
+	if dataOffset > size {
+		return fmt.Errorf("Truncated payload entries")
+	}
+	entries := make([]roflEntryHeader, count)
+	if err := binary.Read(io.NewSectionReader(l.file, int64(header.PayloadOffset), count*entrySize), binary.LittleEndian, entries); err != nil {
+		return fmt.Errorf("Invalid payload entries: %s", err)
+	}
+	for _, e := range entries {
+		entry := roflEntry{
+			offset: dataOffset + int64(e.Offset),
+			size:   int64(e.Length),
+		}
+		if entry.offset+entry.size > size {
+			return fmt.Errorf("Payload entry %d is truncated", e.ID)
+		}
+		switch e.Type {
+		case roflChunkType:
+			l.chunks[ChunkID(e.ID)] = entry
+		case roflKeyFrameType:
+			l.keyFrames[KeyFrameID(e.ID)] = entry
+		default:
+			return fmt.Errorf("Invalid payload entry type %d", e.Type)
+		}
+	}
+
+	if len(metadata.GoLolReplay) != 0 {
+		l.replayData = metadata.GoLolReplay
+		l.endOfGameStats = metadata.GoLolEndOfGameStats
+		return nil
+	}
+
+	l.endOfGameStats = []byte(metadata.StatsJSON)
+	l.replayData, err = json.Marshal(roflReplay(metadata, ph, string(encryptionKey), entries))
+	return err
+}
+
+// roflReplay builds the Replay of a .rofl file not written by
+// go-lol. Each Chunk is associated with the last KeyFrame starting
+// before it.
+func roflReplay(metadata roflMetadata, ph roflPayloadHeader, encryptionKey string, entries []roflEntryHeader) *Replay {
+	r := NewEmptyReplay()
+	r.Version = metadata.GameVersion
+	r.EncryptionKey = encryptionKey
+	r.MetaData.GameKey.ID = lol.GameID(ph.GameID)
+	r.MetaData.EncryptionKey = encryptionKey
+	r.MetaData.ChunkTimeInterval = roflChunkInterval
+	r.MetaData.KeyFrameInterval = DurationMs(ph.KeyFrameInterval)
+	r.MetaData.EndStartupChunkID = int(ph.EndStartupChunkID)
+	r.MetaData.StartGameChunkID = int(ph.StartGameChunkID)
+	r.MetaData.LastChunkID = metadata.LastGameChunkID
+	r.MetaData.EndGameChunkID = metadata.LastGameChunkID
+	r.MetaData.LastKeyFrameID = metadata.LastKeyFrameID
+	r.MetaData.EndGameKeyFrameID = metadata.LastKeyFrameID
+
+	keyFrames := make([]KeyFrame, 0, ph.KeyFrameCount)
+	chunks := make([]Chunk, 0, ph.ChunkCount)
+	for _, e := range entries {
+		if e.Type == roflKeyFrameType {
+			keyFrames = append(keyFrames, KeyFrame{
+				KeyFrameInfo: KeyFrameInfo{
+					ID:          KeyFrameID(e.ID),
+					NextChunkID: ChunkID(e.NextChunkID),
+				},
+			})
+		} else {
+			chunks = append(chunks, Chunk{
+				ChunkInfo: ChunkInfo{
+					ID:       ChunkID(e.ID),
+					Duration: roflChunkInterval,
+				},
+			})
+		}
+	}
+	sort.Sort(KeyFrameList(keyFrames))
+	sort.Sort(ChunkList(chunks))
+
+	kfIdx := -1
+	for _, c := range chunks {
+		for kfIdx+1 < len(keyFrames) && keyFrames[kfIdx+1].NextChunkID <= c.ID {
+			kfIdx++
+		}
+		if kfIdx >= 0 {
+			c.KeyFrame = keyFrames[kfIdx].ID
+			keyFrames[kfIdx].Chunks = append(keyFrames[kfIdx].Chunks, c.ID)
+		}
+		r.addChunk(c)
+	}
+	for _, kf := range keyFrames {
+		r.addKeyFrame(kf)
+	}
+	return r
+}
+
+// Close closes the file read by the formatter, or writes the data
+// of a new replay.
+func (l *RoflReplayFormatter) Close() error {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	if l.file != nil {
+		return l.file.Close()
+	}
+	if l.modified == false {
+		return nil
+	}
+	l.modified = false
+	return l.write()
+}
+
+// write writes all in memory data to a new .rofl file
+func (l *RoflReplayFormatter) write() error {
+	if len(l.replayData) == 0 {
+		return fmt.Errorf("Could not write ROFL file %s: missing replay data", l.filename)
+	}
+	r := &Replay{}
+	if err := json.Unmarshal(l.replayData, r); err != nil {
+		return fmt.Errorf("Could not write ROFL file %s: %s", l.filename, err)
+	}
+	r.rebuildChunksMap()
+	r.rebuildKeyFramesMap()
+	gameLength := DurationMs(r.GameTime(ChunkID(r.MetaData.EndGameChunkID)) / time.Millisecond)
+
+	metadata, err := json.Marshal(roflMetadata{
+		GameLength:          gameLength,
+		GameVersion:         r.Version,
+		LastGameChunkID:     r.MetaData.EndGameChunkID,
+		LastKeyFrameID:      r.MetaData.EndGameKeyFrameID,
+		StatsJSON:           "[]",
+		GoLolReplay:         l.replayData,
+		GoLolEndOfGameStats: l.endOfGameStats,
+	})
+	if err != nil {
+		return err
+	}
+
+	ph := roflPayloadHeader{
+		GameID:              uint64(r.MetaData.GameKey.ID),
+		GameLength:          uint32(gameLength),
+		KeyFrameCount:       uint32(len(l.keyFrames)),
+		ChunkCount:          uint32(len(l.chunks)),
+		EndStartupChunkID:   uint32(r.MetaData.EndStartupChunkID),
+		StartGameChunkID:    uint32(r.MetaData.StartGameChunkID),
+		KeyFrameInterval:    uint32(r.MetaData.KeyFrameInterval),
+		EncryptionKeyLength: uint16(len(r.EncryptionKey)),
+	}
+
+	entries := make([]roflEntryHeader, 0, len(l.chunks)+len(l.keyFrames))
+	data := make([][]byte, 0, cap(entries))
+	offset := uint32(0)
+	chunks := make([]Chunk, 0, len(l.chunks))
+	for id := range l.chunks {
+		chunks = append(chunks, Chunk{ChunkInfo: ChunkInfo{ID: id}})
+	}
+	sort.Sort(ChunkList(chunks))
+	for _, c := range chunks {
+		d := l.chunks[c.ID].data
+		entries = append(entries, roflEntryHeader{ID: uint32(c.ID), Type: roflChunkType, Length: uint32(len(d)), Offset: offset})
+		data = append(data, d)
+		offset += uint32(len(d))
+	}
+	keyFrames := make([]KeyFrame, 0, len(l.keyFrames))
+	for id := range l.keyFrames {
+		kf := KeyFrame{KeyFrameInfo: KeyFrameInfo{ID: id}}
+		if kfIdx, ok := r.keyframeByID[id]; ok == true {
+			kf.NextChunkID = r.KeyFrames[kfIdx].NextChunkID
+		}
+		keyFrames = append(keyFrames, kf)
+	}
+	sort.Sort(KeyFrameList(keyFrames))
+	for _, kf := range keyFrames {
+		d := l.keyFrames[kf.ID].data
+		entries = append(entries, roflEntryHeader{ID: uint32(kf.ID), Type: roflKeyFrameType, Length: uint32(len(d)), NextChunkID: uint32(kf.NextChunkID), Offset: offset})
+		data = append(data, d)
+		offset += uint32(len(d))
+	}
+
+	header := roflHeader{HeaderLength: uint16(binary.Size(roflHeader{}))}
+	copy(header.Magic[:], roflMagic)
+	header.MetadataOffset = uint32(header.HeaderLength)
+	header.MetadataLength = uint32(len(metadata))
+	header.PayloadHeaderOffset = header.MetadataOffset + header.MetadataLength
+	header.PayloadHeaderLength = uint32(binary.Size(ph)) + uint32(len(r.EncryptionKey))
+	header.PayloadOffset = header.PayloadHeaderOffset + header.PayloadHeaderLength
+	header.FileLength = header.PayloadOffset + uint32(len(entries)*binary.Size(roflEntryHeader{})) + offset
+
+	buffer := &bytes.Buffer{}
+	binary.Write(buffer, binary.LittleEndian, header)
+	buffer.Write(metadata)
+	binary.Write(buffer, binary.LittleEndian, ph)
+	buffer.WriteString(r.EncryptionKey)
+	binary.Write(buffer, binary.LittleEndian, entries)
+	for _, d := range data {
+		buffer.Write(d)
+	}
+
+	if err := ioutil.WriteFile(l.filename, buffer.Bytes(), 0644); err != nil {
+		return fmt.Errorf("Could not write ROFL file %s: %s", l.filename, err)
+	}
+	return nil
+}
+
+func (l *RoflReplayFormatter) open(e roflEntry, ok bool) (io.ReadCloser, error) {
+	if ok == false {
+		return nil, os.ErrNotExist
+	}
+	if e.data != nil {
+		return ioutil.NopCloser(bytes.NewReader(e.data)), nil
+	}
+	return ioutil.NopCloser(io.NewSectionReader(l.file, e.offset, e.size)), nil
+}
+
+func (l *RoflReplayFormatter) create(save func(l *RoflReplayFormatter, data []byte)) (io.WriteCloser, error) {
+	if l.file != nil {
+		return nil, fmt.Errorf("ROFL file %s is read-only", l.filename)
+	}
+	return &bufferedWriter{
+		save: func(data []byte) error {
+			l.mx.Lock()
+			defer l.mx.Unlock()
+			// data is kept, so it must not be modified
+			save(l, append([]byte{}, data...))
+			l.modified = true
+			return nil
+		},
+	}, nil
+}
+
+// HasChunk returns true if data is available for a given Chunk
+func (l *RoflReplayFormatter) HasChunk(id ChunkID) bool {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	e, ok := l.chunks[id]
+	return ok == true && (e.size > 0 || len(e.data) > 0)
+}
+
+// HasKeyFrame returns true if data is available for a given KeyFrame
+func (l *RoflReplayFormatter) HasKeyFrame(id KeyFrameID) bool {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	e, ok := l.keyFrames[id]
+	return ok == true && (e.size > 0 || len(e.data) > 0)
+}
+
+// HasEndOfGameStats returns true if data is available for End of Game
+// statistics
+func (l *RoflReplayFormatter) HasEndOfGameStats() bool {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	return len(l.endOfGameStats) > 0
+}
+
+// OpenChunk returns a io.ReadCloser for reading data for a given
+// Chunk
+func (l *RoflReplayFormatter) OpenChunk(id ChunkID) (io.ReadCloser, error) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	e, ok := l.chunks[id]
+	return l.open(e, ok)
+}
+
+// OpenKeyFrame returns a io.ReadCloser for reading data for a given
+// KeyFrame
+func (l *RoflReplayFormatter) OpenKeyFrame(id KeyFrameID) (io.ReadCloser, error) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	e, ok := l.keyFrames[id]
+	return l.open(e, ok)
+}
+
+// OpenEndOfGameStats returns a io.ReadCloser for reading data for the end
+// of game statistics
+func (l *RoflReplayFormatter) OpenEndOfGameStats() (io.ReadCloser, error) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	return l.open(roflEntry{data: l.endOfGameStats}, l.endOfGameStats != nil)
+}
+
+// Open returns a io.ReadCloser for reading replay data
+func (l *RoflReplayFormatter) Open() (io.ReadCloser, error) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	return l.open(roflEntry{data: l.replayData}, l.replayData != nil)
+}
+
+// CreateChunk returns a io.WriteCloser to write data for a given
+// Chunk. Data is saved once it is closed.
+func (l *RoflReplayFormatter) CreateChunk(id ChunkID) (io.WriteCloser, error) {
+	return l.create(func(l *RoflReplayFormatter, data []byte) {
+		l.chunks[id] = roflEntry{data: data}
+	})
+}
+
+// CreateKeyFrame returns a io.WriteCloser to write data for a given
+// KeyFrame. Data is saved once it is closed.
+func (l *RoflReplayFormatter) CreateKeyFrame(id KeyFrameID) (io.WriteCloser, error) {
+	return l.create(func(l *RoflReplayFormatter, data []byte) {
+		l.keyFrames[id] = roflEntry{data: data}
+	})
+}
+
+// CreateEndOfGameStats returns a io.WriteCloser to write data for the
+// end of game statistics. Data is saved once it is closed.
+func (l *RoflReplayFormatter) CreateEndOfGameStats() (io.WriteCloser, error) {
+	return l.create(func(l *RoflReplayFormatter, data []byte) {
+		l.endOfGameStats = data
+	})
+}
+
+// Create returns a io.WriteCloser to write replay data. Data is saved
+// once it is closed.
+func (l *RoflReplayFormatter) Create() (io.WriteCloser, error) {
+	return l.create(func(l *RoflReplayFormatter, data []byte) {
+		l.replayData = data
+	})
+}
+
+func init() {
+	RegisterReplayFileFormat(".rofl", func(filename string) (ReplayDataFormatter, error) {
+		return NewRoflReplayFormatter(filename)
+	})
+}
@@ -0,0 +1,165 @@
+package xlol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+
+	. "gopkg.in/check.v1"
+)
+
+type RoflFormatSuite struct{}
+
+var _ = Suite(&RoflFormatSuite{})
+
+func (s *RoflFormatSuite) TestWritesAndReadsReplay(c *C) {
+	filename := path.Join(c.MkDir(), "replay.rofl")
+	original := newTestReplay(20, 30000)
+
+	rofl, err := NewRoflReplayFormatter(filename)
+	c.Assert(err, IsNil)
+	c.Assert(original.SaveWithData(rofl), IsNil)
+	c.Assert(rofl.Close(), IsNil)
+
+	rofl, err = NewRoflReplayFormatter(filename)
+	c.Assert(err, IsNil)
+	defer rofl.Close()
+
+	_, err = rofl.CreateChunk(21)
+	c.Check(err, ErrorMatches, "ROFL file .* is read-only")
+
+	loaded, err := LoadReplayWithData(rofl)
+	c.Assert(err, IsNil)
+	c.Check(loaded.MetaData, DeepEquals, original.MetaData)
+	c.Check(loaded.Chunks, DeepEquals, original.Chunks)
+	c.Check(loaded.KeyFrames, DeepEquals, original.KeyFrames)
+	c.Check(loaded.endOfGameStats, DeepEquals, original.endOfGameStats)
+}
+
+// writeForeignRofl writes the Chunks and KeyFrames of r in a .rofl
+// file, as the LoL client would, without any go-lol data.
+func writeForeignRofl(c *C, filename string, r *Replay) {
+	metadata, err := json.Marshal(roflMetadata{
+		GameLength:      1800000,
+		GameVersion:     "5.14.0.329",
+		LastGameChunkID: r.MetaData.EndGameChunkID,
+		LastKeyFrameID:  r.MetaData.EndGameKeyFrameID,
+		StatsJSON:       `[{"NAME":"some summoner"}]`,
+	})
+	c.Assert(err, IsNil)
+
+	ph := roflPayloadHeader{
+		GameID:              uint64(r.MetaData.GameKey.ID),
+		KeyFrameCount:       uint32(len(r.KeyFrames)),
+		ChunkCount:          uint32(len(r.Chunks)),
+		EndStartupChunkID:   uint32(r.MetaData.EndStartupChunkID),
+		StartGameChunkID:    uint32(r.MetaData.StartGameChunkID),
+		KeyFrameInterval:    60000,
+		EncryptionKeyLength: uint16(len(r.EncryptionKey)),
+	}
+
+	entries := []roflEntryHeader{}
+	data := &bytes.Buffer{}
+	// the client writes KeyFrames and Chunks interleaved
+	for _, kf := range r.KeyFrames {
+		entries = append(entries, roflEntryHeader{ID: uint32(kf.ID), Type: roflKeyFrameType, Length: uint32(len(kf.data)), NextChunkID: uint32(kf.NextChunkID), Offset: uint32(data.Len())})
+		data.Write(kf.data)
+	}
+	for _, ch := range r.Chunks {
+		entries = append(entries, roflEntryHeader{ID: uint32(ch.ID), Type: roflChunkType, Length: uint32(len(ch.data)), Offset: uint32(data.Len())})
+		data.Write(ch.data)
+	}
+
+	header := roflHeader{HeaderLength: 288}
+	copy(header.Magic[:], roflMagic)
+	header.MetadataOffset = 288
+	header.MetadataLength = uint32(len(metadata))
+	header.PayloadHeaderOffset = header.MetadataOffset + header.MetadataLength
+	header.PayloadHeaderLength = 34 + uint32(len(r.EncryptionKey))
+	header.PayloadOffset = header.PayloadHeaderOffset + header.PayloadHeaderLength
+
+	buffer := &bytes.Buffer{}
+	c.Assert(binary.Write(buffer, binary.LittleEndian, header), IsNil)
+	buffer.Write(metadata)
+	c.Assert(binary.Write(buffer, binary.LittleEndian, ph), IsNil)
+	buffer.WriteString(r.EncryptionKey)
+	c.Assert(binary.Write(buffer, binary.LittleEndian, entries), IsNil)
+	buffer.Write(data.Bytes())
+	c.Assert(ioutil.WriteFile(filename, buffer.Bytes(), 0644), IsNil)
+}
+
+func (s *RoflFormatSuite) TestReadsForeignReplay(c *C) {
+	filename := path.Join(c.MkDir(), "foreign.rofl")
+	original := newTestReplay(20, 30000)
+	writeForeignRofl(c, filename, original)
+
+	rofl, err := NewRoflReplayFormatter(filename)
+	c.Assert(err, IsNil)
+	defer rofl.Close()
+
+	loaded, err := LoadReplayWithData(rofl)
+	c.Assert(err, IsNil)
+	c.Check(loaded.Version, Equals, "5.14.0.329")
+	c.Check(loaded.EncryptionKey, Equals, original.EncryptionKey)
+	c.Check(loaded.MetaData.GameKey.ID, Equals, original.MetaData.GameKey.ID)
+	c.Check(loaded.MetaData.GameKey.PlatformID, Equals, "")
+	c.Check(loaded.MetaData.EndGameChunkID, Equals, 20)
+	c.Check(loaded.MetaData.StartGameChunkID, Equals, 6)
+
+	c.Assert(len(loaded.Chunks), Equals, len(original.Chunks))
+	for i, ch := range loaded.Chunks {
+		c.Check(ch.ID, Equals, original.Chunks[i].ID)
+		c.Check(ch.KeyFrame, Equals, original.Chunks[i].KeyFrame)
+		c.Check(ch.data, DeepEquals, original.Chunks[i].data)
+	}
+	c.Assert(len(loaded.KeyFrames), Equals, len(original.KeyFrames))
+	for i, kf := range loaded.KeyFrames {
+		c.Check(kf.KeyFrameInfo.NextChunkID, Equals, original.KeyFrames[i].NextChunkID)
+		c.Check(kf.Chunks, DeepEquals, original.KeyFrames[i].Chunks)
+		c.Check(kf.data, DeepEquals, original.KeyFrames[i].data)
+	}
+	c.Check(string(loaded.endOfGameStats), Equals, `[{"NAME":"some summoner"}]`)
+}
+
+func (s *RoflFormatSuite) TestRejectsInvalidFile(c *C) {
+	filename := path.Join(c.MkDir(), "replay.rofl")
+	c.Assert(ioutil.WriteFile(filename, bytes.Repeat([]byte("not a replay "), 30), 0644), IsNil)
+
+	_, err := NewRoflReplayFormatter(filename)
+	c.Check(err, ErrorMatches, "Could not load ROFL file .*: Not a ROFL file")
+}
+
+func (s *RoflFormatSuite) TestRejectsCorruptHeader(c *C) {
+	filename := path.Join(c.MkDir(), "replay.rofl")
+	writeForeignRofl(c, filename, newTestReplay(20, 30000))
+	valid, err := ioutil.ReadFile(filename)
+	c.Assert(err, IsNil)
+	payloadHeaderOffset := binary.LittleEndian.Uint32(valid[276:280])
+
+	testdata := []struct {
+		offset   uint32
+		value    uint32
+		size     int
+		expected string
+	}{
+		{272, 0xffffffff, 4, "Truncated metadata"},
+		{280, 0xffffffff, 4, "Truncated payload header"},
+		{payloadHeaderOffset + 32, 0xffff, 2, "Invalid payload header: encryption key is truncated"},
+		{payloadHeaderOffset + 16, 0xffffffff, 4, "Truncated payload entries"},
+		{payloadHeaderOffset + 12, 0x10000000, 4, "Truncated payload entries"},
+	}
+
+	for _, d := range testdata {
+		data := append([]byte(nil), valid...)
+		if d.size == 2 {
+			binary.LittleEndian.PutUint16(data[d.offset:], uint16(d.value))
+		} else {
+			binary.LittleEndian.PutUint32(data[d.offset:], d.value)
+		}
+		c.Assert(ioutil.WriteFile(filename, data, 0644), IsNil)
+		_, err := NewRoflReplayFormatter(filename)
+		c.Check(err, ErrorMatches, "Could not load ROFL file .*: "+d.expected, Commentf("offset %d", d.offset))
+	}
+}
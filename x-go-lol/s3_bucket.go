@@ -0,0 +1,416 @@
+package xlol
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config configures the access to a bucket of an S3 compatible
+// object storage.
+type S3Config struct {
+	// Endpoint is the base URL of the storage, i.e.
+	// "https://s3.eu-west-1.amazonaws.com" or "http://localhost:9000"
+	Endpoint string
+	// Region of the bucket, "us-east-1" if empty
+	Region string
+	Bucket string
+	// AccessKey and SecretKey are the credentials used to sign the
+	// requests
+	AccessKey string
+	SecretKey string
+	// PartSize is the size of the parts of multipart uploads, at
+	// least 5 MiB, which is the default.
+	PartSize int
+	// Client is used to send requests, http.DefaultClient if nil
+	Client *http.Client
+}
+
+const s3MinPartSize = 5 * 1024 * 1024
+
+// An S3Bucket reads and writes objects of an S3 compatible bucket. It
+// uses path-style requests, which are supported by most S3 compatible
+// storages.
+type S3Bucket struct {
+	config   S3Config
+	endpoint *url.URL
+	// now is used to date the request signatures
+	now func() time.Time
+}
+
+// NewS3Bucket returns an S3Bucket for the given configuration
+func NewS3Bucket(config S3Config) (*S3Bucket, error) {
+	u, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid S3 endpoint %s: %s", config.Endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("Invalid S3 endpoint %s: unsupported scheme '%s'", config.Endpoint, u.Scheme)
+	}
+	if len(config.Bucket) == 0 {
+		return nil, fmt.Errorf("Empty S3 bucket name")
+	}
+	if len(config.Region) == 0 {
+		config.Region = "us-east-1"
+	}
+	if config.PartSize == 0 {
+		config.PartSize = s3MinPartSize
+	}
+	if config.PartSize < s3MinPartSize {
+		return nil, fmt.Errorf("S3 part size %d is smaller than the minimum %d", config.PartSize, s3MinPartSize)
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return &S3Bucket{
+		config:   config,
+		endpoint: u,
+		now:      time.Now,
+	}, nil
+}
+
+// An S3Error is returned when the storage answers with an error
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e S3Error) Error() string {
+	if len(e.Code) == 0 {
+		return fmt.Sprintf("S3 error %d", e.StatusCode)
+	}
+	return fmt.Sprintf("S3 error %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// s3Escape escapes s as required by S3 signatures: all but the
+// unreserved characters, and the slashes if keepSlash is true.
+func s3Escape(s string, keepSlash bool) string {
+	buf := &bytes.Buffer{}
+	for _, b := range []byte(s) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' || (b == '/' && keepSlash == true) {
+			buf.WriteByte(b)
+		} else {
+			fmt.Fprintf(buf, "%%%02X", b)
+		}
+	}
+	return buf.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sign signs req with the AWS signature version 4. All headers set
+// on req are signed.
+func (b *S3Bucket) sign(req *http.Request, payloadHash string) {
+	now := b.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	canonicalHeaders := &bytes.Buffer{}
+	for _, name := range names {
+		fmt.Fprintf(canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(keys))
+	for _, k := range keys {
+		params = append(params, s3Escape(k, false)+"="+s3Escape(query.Get(k), false))
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3Escape(req.URL.Path, true),
+		strings.Join(params, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/" + b.config.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+b.config.SecretKey), date)
+	key = hmacSHA256(key, b.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		b.config.AccessKey, scope, signedHeaders, signature))
+}
+
+// do sends a signed request for the object key, or for the bucket if
+// key is empty. Any error status is returned as an S3Error.
+func (b *S3Bucket) do(method, key string, query url.Values, body []byte) (*http.Response, error) {
+	u := *b.endpoint
+	u.Path = u.Path + "/" + b.config.Bucket
+	if len(key) != 0 {
+		u.Path += "/" + key
+	}
+	u.RawPath = s3Escape(u.Path, true)
+	u.RawQuery = strings.Replace(query.Encode(), "+", "%20", -1)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	payloadHash := sha256.Sum256(body)
+	b.sign(req, hex.EncodeToString(payloadHash[:]))
+
+	resp, err := b.config.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	s3err := S3Error{StatusCode: resp.StatusCode}
+	if data, err := ioutil.ReadAll(resp.Body); err == nil {
+		xml.Unmarshal(data, &s3err)
+	}
+	return nil, s3err
+}
+
+// doXML sends a signed request, and decodes its XML answer in v
+func (b *S3Bucket) doXML(method, key string, query url.Values, body []byte, v interface{}) error {
+	resp, err := b.do(method, key, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if v == nil {
+		return nil
+	}
+	return xml.NewDecoder(resp.Body).Decode(v)
+}
+
+func isS3NotFound(err error) bool {
+	s3err, ok := err.(S3Error)
+	return ok == true && s3err.StatusCode == http.StatusNotFound
+}
+
+// Get returns a reader on the content of an object. The content is
+// only fetched as it is read.
+func (b *S3Bucket) Get(key string) (io.ReadCloser, error) {
+	resp, err := b.do("GET", key, nil, nil)
+	if isS3NotFound(err) == true {
+		return nil, os.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Put writes the content of an object in a single request
+func (b *S3Bucket) Put(key string, data []byte) error {
+	return b.doXML("PUT", key, nil, data, nil)
+}
+
+// Delete removes an object. Deleting a missing object is not an
+// error.
+func (b *S3Bucket) Delete(key string) error {
+	err := b.doXML("DELETE", key, nil, nil, nil)
+	if isS3NotFound(err) == true {
+		return nil
+	}
+	return err
+}
+
+// S3Object describes an object of a bucket
+type S3Object struct {
+	Key  string `xml:"Key"`
+	Size int64  `xml:"Size"`
+}
+
+type s3ListResult struct {
+	IsTruncated           bool       `xml:"IsTruncated"`
+	NextContinuationToken string     `xml:"NextContinuationToken"`
+	Contents              []S3Object `xml:"Contents"`
+	CommonPrefixes        []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+}
+
+// List returns the objects whose key starts with prefix. If delimiter
+// is not empty, the keys containing delimiter after the prefix are
+// grouped in the returned common prefixes.
+func (b *S3Bucket) List(prefix, delimiter string) ([]S3Object, []string, error) {
+	var objects []S3Object
+	var prefixes []string
+	token := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if len(delimiter) != 0 {
+			query.Set("delimiter", delimiter)
+		}
+		if len(token) != 0 {
+			query.Set("continuation-token", token)
+		}
+		var result s3ListResult
+		if err := b.doXML("GET", "", query, nil, &result); err != nil {
+			return nil, nil, err
+		}
+		objects = append(objects, result.Contents...)
+		for _, p := range result.CommonPrefixes {
+			prefixes = append(prefixes, p.Prefix)
+		}
+		if result.IsTruncated == false || len(result.NextContinuationToken) == 0 {
+			return objects, prefixes, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+type s3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// s3Writer writes an object. Data is sent in a single request if it
+// fits in one part, or with a multipart upload otherwise.
+type s3Writer struct {
+	bucket   *S3Bucket
+	key      string
+	buffer   bytes.Buffer
+	uploadID string
+	parts    []s3CompletedPart
+	onClose  func(size int64)
+	size     int64
+	isClosed bool
+	err      error
+}
+
+// Create returns a writer for an object. The object is only visible
+// once the writer is closed.
+func (b *S3Bucket) Create(key string) io.WriteCloser {
+	return b.create(key, nil)
+}
+
+// create returns a writer for an object, onClose is called with its
+// size once it is written.
+func (b *S3Bucket) create(key string, onClose func(size int64)) *s3Writer {
+	return &s3Writer{bucket: b, key: key, onClose: onClose}
+}
+
+func (w *s3Writer) uploadPart(data []byte) error {
+	if len(w.uploadID) == 0 {
+		var result struct {
+			UploadID string `xml:"UploadId"`
+		}
+		if err := w.bucket.doXML("POST", w.key, url.Values{"uploads": {""}}, nil, &result); err != nil {
+			return err
+		}
+		w.uploadID = result.UploadID
+	}
+	partNumber := len(w.parts) + 1
+	resp, err := w.bucket.do("PUT", w.key, url.Values{
+		"partNumber": {strconv.Itoa(partNumber)},
+		"uploadId":   {w.uploadID},
+	}, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	w.parts = append(w.parts, s3CompletedPart{PartNumber: partNumber, ETag: resp.Header.Get("ETag")})
+	return nil
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.buffer.Write(p)
+	w.size += int64(len(p))
+	partSize := w.bucket.config.PartSize
+	// the last part must not be empty, so a full part is only sent
+	// once more data is written
+	for w.buffer.Len() > partSize {
+		if w.err = w.uploadPart(w.buffer.Next(partSize)); w.err != nil {
+			return 0, w.err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *s3Writer) abort() {
+	if len(w.uploadID) != 0 {
+		w.bucket.doXML("DELETE", w.key, url.Values{"uploadId": {w.uploadID}}, nil, nil)
+	}
+}
+
+func (w *s3Writer) Close() error {
+	if w.isClosed == true {
+		return fmt.Errorf("S3 object %s already closed", w.key)
+	}
+	w.isClosed = true
+	if w.err != nil {
+		w.abort()
+		return w.err
+	}
+
+	if len(w.uploadID) == 0 {
+		if err := w.bucket.Put(w.key, w.buffer.Bytes()); err != nil {
+			return err
+		}
+	} else {
+		if err := w.uploadPart(w.buffer.Bytes()); err != nil {
+			w.abort()
+			return err
+		}
+		body, err := xml.Marshal(struct {
+			XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+			Parts   []s3CompletedPart `xml:"Part"`
+		}{Parts: w.parts})
+		if err != nil {
+			return err
+		}
+		if err := w.bucket.doXML("POST", w.key, url.Values{"uploadId": {w.uploadID}}, body, nil); err != nil {
+			w.abort()
+			return err
+		}
+	}
+	if w.onClose != nil {
+		w.onClose(w.size)
+	}
+	return nil
+}
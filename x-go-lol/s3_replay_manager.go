@@ -0,0 +1,337 @@
+package xlol
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/atuleu/go-lol"
+)
+
+// An S3ReplayFormatter is a ReplayDataFormatter that stores a replay
+// in an S3 bucket, with the same layout than an
+// ExpandedReplayFormatter. Data is only fetched when it is read, so
+// a ReplayServer can stream a game directly from the bucket.
+type S3ReplayFormatter struct {
+	bucket *S3Bucket
+	prefix string
+
+	mx sync.Mutex
+	// objects are the sizes of the objects of the replay, listed
+	// once when first needed
+	objects map[string]int64
+}
+
+// NewS3ReplayFormatter returns a ReplayDataFormatter that stores its
+// data in bucket, under the given key prefix.
+func NewS3ReplayFormatter(bucket *S3Bucket, prefix string) *S3ReplayFormatter {
+	return &S3ReplayFormatter{
+		bucket: bucket,
+		prefix: strings.TrimSuffix(prefix, "/") + "/",
+	}
+}
+
+func (l *S3ReplayFormatter) list() error {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	if l.objects != nil {
+		return nil
+	}
+	objects, _, err := l.bucket.List(l.prefix, "")
+	if err != nil {
+		return err
+	}
+	l.objects = make(map[string]int64, len(objects))
+	for _, o := range objects {
+		l.objects[strings.TrimPrefix(o.Key, l.prefix)] = o.Size
+	}
+	return nil
+}
+
+func (l *S3ReplayFormatter) has(name string) bool {
+	if err := l.list(); err != nil {
+		return false
+	}
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	return l.objects[name] > 0
+}
+
+func (l *S3ReplayFormatter) exists() (bool, error) {
+	if err := l.list(); err != nil {
+		return false, err
+	}
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	_, ok := l.objects[replayData]
+	return ok, nil
+}
+
+func (l *S3ReplayFormatter) create(name string) (io.WriteCloser, error) {
+	return l.bucket.create(l.prefix+name, func(size int64) {
+		l.mx.Lock()
+		defer l.mx.Unlock()
+		if l.objects != nil {
+			l.objects[name] = size
+		}
+	}), nil
+}
+
+func chunkName(id ChunkID) string {
+	return fmt.Sprintf("%s.%04d.bin", chunk, id)
+}
+
+func keyFrameName(id KeyFrameID) string {
+	return fmt.Sprintf("%s.%04d.bin", keyframe, id)
+}
+
+// HasChunk returns true if data is available for a given Chunk
+func (l *S3ReplayFormatter) HasChunk(id ChunkID) bool {
+	return l.has(chunkName(id))
+}
+
+// HasKeyFrame returns true if data is available for a given KeyFrame
+func (l *S3ReplayFormatter) HasKeyFrame(id KeyFrameID) bool {
+	return l.has(keyFrameName(id))
+}
+
+// HasEndOfGameStats returns true if data is available for End of Game
+// statistics
+func (l *S3ReplayFormatter) HasEndOfGameStats() bool {
+	return l.has(eogStat)
+}
+
+// OpenChunk returns a io.ReadCloser for reading data for a given
+// Chunk
+func (l *S3ReplayFormatter) OpenChunk(id ChunkID) (io.ReadCloser, error) {
+	return l.bucket.Get(l.prefix + chunkName(id))
+}
+
+// OpenKeyFrame returns a io.ReadCloser for reading data for a given
+// KeyFrame
+func (l *S3ReplayFormatter) OpenKeyFrame(id KeyFrameID) (io.ReadCloser, error) {
+	return l.bucket.Get(l.prefix + keyFrameName(id))
+}
+
+// OpenEndOfGameStats returns a io.ReadCloser for reading data for the end
+// of game statistics
+func (l *S3ReplayFormatter) OpenEndOfGameStats() (io.ReadCloser, error) {
+	return l.bucket.Get(l.prefix + eogStat)
+}
+
+// Open returns a io.ReadCloser for reading replay data
+func (l *S3ReplayFormatter) Open() (io.ReadCloser, error) {
+	return l.bucket.Get(l.prefix + replayData)
+}
+
+// CreateChunk returns a io.WriteCloser to write data for a given
+// Chunk. Data is saved once it is closed.
+func (l *S3ReplayFormatter) CreateChunk(id ChunkID) (io.WriteCloser, error) {
+	return l.create(chunkName(id))
+}
+
+// CreateKeyFrame returns a io.WriteCloser to write data for a given
+// KeyFrame. Data is saved once it is closed.
+func (l *S3ReplayFormatter) CreateKeyFrame(id KeyFrameID) (io.WriteCloser, error) {
+	return l.create(keyFrameName(id))
+}
+
+// CreateEndOfGameStats returns a io.WriteCloser to write data for the
+// end of game statistics. Data is saved once it is closed.
+func (l *S3ReplayFormatter) CreateEndOfGameStats() (io.WriteCloser, error) {
+	return l.create(eogStat)
+}
+
+// Create returns a io.WriteCloser to write replay data. Data is saved
+// once it is closed.
+func (l *S3ReplayFormatter) Create() (io.WriteCloser, error) {
+	return l.create(replayData)
+}
+
+// An S3ReplayManager is a ReplayManager that stores its replays in an
+// S3 bucket, under <prefix><platformID>/<gameID>/
+type S3ReplayManager struct {
+	bucket *S3Bucket
+	prefix string
+}
+
+// NewS3ReplayManager creates a ReplayManager that stores its replays
+// in bucket, under the given key prefix, which may be empty.
+func NewS3ReplayManager(bucket *S3Bucket, prefix string) (*S3ReplayManager, error) {
+	if bucket == nil {
+		return nil, fmt.Errorf("Empty S3 bucket")
+	}
+	if len(prefix) != 0 {
+		prefix = strings.TrimSuffix(prefix, "/") + "/"
+	}
+	return &S3ReplayManager{
+		bucket: bucket,
+		prefix: prefix,
+	}, nil
+}
+
+func (m *S3ReplayManager) formatter(platformID string, id lol.GameID) *S3ReplayFormatter {
+	return NewS3ReplayFormatter(m.bucket, fmt.Sprintf("%s%s/%d", m.prefix, platformID, id))
+}
+
+// Store saves all the Replay data in the bucket.
+func (m *S3ReplayManager) Store(r *Replay) error {
+	return r.SaveWithData(m.formatter(r.MetaData.GameKey.PlatformID, r.MetaData.GameKey.ID))
+}
+
+// Get returns a ReplayDataLoader for a given lol.Region and
+// lol.GameID that is fully stored in the Manager. It will return an
+// error if the replay data is missing or incomplete for LoL client to
+// spectate.
+func (m *S3ReplayManager) Get(region *lol.Region, id lol.GameID) (ReplayDataLoader, error) {
+	formatter := m.formatter(region.PlatformID(), id)
+	if ok, err := formatter.exists(); err != nil {
+		return nil, err
+	} else if ok == false {
+		return nil, fmt.Errorf("No replay for game %s/%d", region.PlatformID(), id)
+	}
+	if formatter.HasEndOfGameStats() == false {
+		return nil, fmt.Errorf("Requested game %s/%d is not finished, missing EndOfGameStats",
+			region.PlatformID(), id)
+	}
+	return formatter, nil
+}
+
+// Create returns a ReplayDataWriter for a replay identified by its
+// lol.Region and lol.GameID. It will fails if a replay already exists
+// for that Game.
+func (m *S3ReplayManager) Create(region *lol.Region, id lol.GameID) (ReplayDataWriter, error) {
+	formatter := m.formatter(region.PlatformID(), id)
+	if ok, err := formatter.exists(); err != nil {
+		return nil, err
+	} else if ok == true {
+		return nil, fmt.Errorf("Cannot create a replay for game %s/%d: some replay data already exists",
+			region.PlatformID(), id)
+	}
+	return formatter, nil
+}
+
+// replaysOfRegion lists the replays of a region, and returns valid
+// replays, incomplete replays and the key prefixes of invalid ones.
+func (m *S3ReplayManager) replaysOfRegion(platformID string) ([]*Replay, []*Replay, []string, error) {
+	_, prefixes, err := m.bucket.List(m.prefix+platformID+"/", "/")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var res, incomplete []*Replay
+	var invalid []string
+	for _, p := range prefixes {
+		formatter := NewS3ReplayFormatter(m.bucket, p)
+		if gameIDRx.MatchString(path.Base(p)) == false {
+			invalid = append(invalid, formatter.prefix)
+			continue
+		}
+		r, complete, err := loadStoredReplay(formatter)
+		if err != nil {
+			invalid = append(invalid, formatter.prefix)
+			continue
+		}
+		if complete == true {
+			res = append(res, r)
+		} else {
+			incomplete = append(incomplete, r)
+		}
+	}
+	sort.Sort(sort.Reverse(replayList(res)))
+	sort.Sort(sort.Reverse(replayList(incomplete)))
+	return res, incomplete, invalid, nil
+}
+
+// listReplays returns all Replay stored in the S3ReplayManager, or
+// an error if a region cannot be listed
+func (m *S3ReplayManager) listReplays() (map[string][]*Replay, error) {
+	res := make(map[string][]*Replay)
+	for _, r := range lol.AllDynamicRegion() {
+		replays, _, _, err := m.replaysOfRegion(r.PlatformID())
+		if err != nil {
+			return nil, fmt.Errorf("Could not list replays of %s: %s", r.PlatformID(), err)
+		}
+		if len(replays) != 0 {
+			res[r.Code()] = replays
+		}
+	}
+	return res, nil
+}
+
+// Replays return all Replay stored in the S3ReplayManager. Regions
+// that cannot be listed are skipped.
+func (m *S3ReplayManager) Replays() map[string][]*Replay {
+	res := make(map[string][]*Replay)
+	for _, r := range lol.AllDynamicRegion() {
+		replays, _, _, err := m.replaysOfRegion(r.PlatformID())
+		if err == nil && len(replays) != 0 {
+			res[r.Code()] = replays
+		}
+	}
+	return res
+}
+
+// IncompleteReplays returns all the replays whose recording was
+// interrupted.
+func (m *S3ReplayManager) IncompleteReplays() map[string][]*Replay {
+	res := make(map[string][]*Replay)
+	for _, r := range lol.AllDynamicRegion() {
+		_, incomplete, _, err := m.replaysOfRegion(r.PlatformID())
+		if err == nil && len(incomplete) != 0 {
+			res[r.Code()] = incomplete
+		}
+	}
+	return res
+}
+
+// Resume returns a ReplayDataFormatter for a replay whose recording
+// was interrupted. It will fail if there is no such replay, or if the
+// replay is complete.
+func (m *S3ReplayManager) Resume(region *lol.Region, id lol.GameID) (ReplayDataFormatter, error) {
+	formatter := m.formatter(region.PlatformID(), id)
+	if _, complete, err := loadStoredReplay(formatter); err != nil {
+		return nil, fmt.Errorf("Could not resume replay for game %s/%d: %s", region.PlatformID(), id, err)
+	} else if complete == true {
+		return nil, fmt.Errorf("Replay for game %s/%d is complete", region.PlatformID(), id)
+	}
+	return formatter, nil
+}
+
+func (m *S3ReplayManager) deletePrefix(prefix string) error {
+	objects, _, err := m.bucket.List(prefix, "")
+	if err != nil {
+		return err
+	}
+	for _, o := range objects {
+		if err := m.bucket.Delete(o.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete ensure that the replay is deleted from the manager. If the
+// replay does not exist it will silently ignores the error.
+func (m *S3ReplayManager) Delete(region *lol.Region, id lol.GameID) error {
+	return m.deletePrefix(m.formatter(region.PlatformID(), id).prefix)
+}
+
+// CleanUp removes the replays whose data cannot be loaded. Incomplete
+// replays are kept.
+func (m *S3ReplayManager) CleanUp() error {
+	for _, r := range lol.AllDynamicRegion() {
+		_, _, invalid, err := m.replaysOfRegion(r.PlatformID())
+		if err != nil {
+			return err
+		}
+		for _, prefix := range invalid {
+			if err := m.deletePrefix(prefix); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package xlol
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -17,9 +18,22 @@ import (
 
 // SpectateAPI is an helper to use the REST api for spectate mode
 type SpectateAPI struct {
-	region *lol.Region
-	id     lol.GameID
-	debug  bool
+	region    *lol.Region
+	id        lol.GameID
+	debug     bool
+	client    *http.Client
+	baseURL   string
+	timeout   time.Duration
+	userAgent string
+	// minimal time between two polls of the game metadata
+	minPollInterval time.Duration
+	clock           Clock
+	// MaxParallelDownloads is the maximal number of Chunks and
+	// KeyFrames downloaded at the same time by SpectateGame
+	MaxParallelDownloads int
+	// Observer, if not nil, is notified of the progress of
+	// SpectateGame
+	Observer SpectateObserver
 }
 
 const (
@@ -48,32 +62,75 @@ const (
 )
 
 // NewSpectateAPI creates a new API endpoint dedicated to get data for
-// the specified game (from lol.Region and lol.GameID)
-func NewSpectateAPI(region *lol.Region, id lol.GameID) (*SpectateAPI, error) {
+// the specified game (from lol.Region and lol.GameID). By default it
+// queries the spectator server of the region with http.DefaultClient,
+// which can be changed with options.
+func NewSpectateAPI(region *lol.Region, id lol.GameID, options ...SpectateOption) (*SpectateAPI, error) {
 	if region.IsDynamic() == false {
 		return nil, fmt.Errorf("SpectateAPI is only working with dynamic region")
 	}
 
-	return &SpectateAPI{
-		region: region,
-		id:     id,
-		debug:  false,
-	}, nil
+	res := &SpectateAPI{
+		region:               region,
+		id:                   id,
+		debug:                false,
+		client:               http.DefaultClient,
+		baseURL:              "http://" + region.SpectatorURL(),
+		MaxParallelDownloads: 4,
+		minPollInterval:      time.Second,
+		clock:                SystemClock,
+	}
+
+	for _, o := range options {
+		if err := o(res); err != nil {
+			return nil, err
+		}
+	}
+
+	if res.timeout > 0 {
+		// we do not modify a client we do not own
+		client := *res.client
+		client.Timeout = res.timeout
+		res.client = &client
+	}
+
+	return res, nil
+}
+
+// get performs a GET request on url, and returns an error if the
+// server answers with an HTTP error status.
+func (a *SpectateAPI) get(url string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(a.userAgent) != 0 {
+		req.Header.Set("User-Agent", a.userAgent)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		resp.Body.Close()
+		return nil, lol.RESTError{Code: resp.StatusCode}
+	}
+	return resp, nil
 }
 
 // Format formats an URL appropriately for the API
 func (a *SpectateAPI) Format(function SpectateFunction, param int) string {
 	if param != NullParam {
-		return fmt.Sprintf("http://%s%s%s/%s/%d/%d/token",
-			a.region.SpectatorURL(),
+		return fmt.Sprintf("%s%s%s/%s/%d/%d/token",
+			a.baseURL,
 			Prefix,
 			function,
 			a.region.PlatformID(),
 			a.id,
 			param)
 	}
-	return fmt.Sprintf("http://%s%s%s/%s/%d/null",
-		a.region.SpectatorURL(),
+	return fmt.Sprintf("%s%s%s/%s/%d/null",
+		a.baseURL,
 		Prefix,
 		function,
 		a.region.PlatformID(),
@@ -83,21 +140,18 @@ func (a *SpectateAPI) Format(function SpectateFunction, param int) string {
 // VersionURL is returning the URL for getting the SpectateAPI version
 // used on the distant server.
 func (a *SpectateAPI) VersionURL() string {
-	return fmt.Sprintf("http://%s%s%s", a.region.SpectatorURL(), Prefix, Version)
+	return fmt.Sprintf("%s%s%s", a.baseURL, Prefix, Version)
 }
 
 // Get parses JSON data into the v param. Only GetGameMetaData,
 // GetLastChunkInfo and EndOfGameStats should use it
 func (a *SpectateAPI) Get(function SpectateFunction, param int, v interface{}) error {
 	url := a.Format(function, param)
-	resp, err := http.Get(url)
+	resp, err := a.get(url)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode >= 400 {
-		return lol.RESTError{Code: resp.StatusCode}
-	}
 
 	if a.debug == true {
 		debugPath := path.Join(os.TempDir(),
@@ -118,14 +172,11 @@ func (a *SpectateAPI) Get(function SpectateFunction, param int, v interface{}) e
 // log the json data from the function. Mainly for reverse engineering purpose
 func (a *SpectateAPI) logJSON(function SpectateFunction, param int) error {
 	url := a.Format(function, param)
-	resp, err := http.Get(url)
+	resp, err := a.get(url)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode >= 400 {
-		return lol.RESTError{Code: resp.StatusCode}
-	}
 	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return err
@@ -144,206 +195,392 @@ func (a *SpectateAPI) logJSON(function SpectateFunction, param int) error {
 // ReadAll reads the entire response from the REST Api and copy it to w io.Writer
 func (a *SpectateAPI) ReadAll(function SpectateFunction, param int, w io.Writer) error {
 	url := a.Format(function, param)
-	resp, err := http.Get(url)
+	resp, err := a.get(url)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode >= 400 {
-		return lol.RESTError{Code: resp.StatusCode}
-	}
 	_, err = io.Copy(w, resp.Body)
 	return err
 }
 
 // Version is getting from the Server the version currently used.
 func (a *SpectateAPI) Version() (string, error) {
-	url := fmt.Sprintf("http://%s%s%s", a.region.SpectatorURL(), Prefix, Version)
-	resp, err := http.Get(url)
+	resp, err := a.get(a.VersionURL())
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode >= 400 {
-		return "", lol.RESTError{Code: resp.StatusCode}
-	}
 	d, err := ioutil.ReadAll(resp.Body)
 	return string(d), err
 }
 
-func (a *SpectateAPI) readBinary(fn SpectateFunction, id int, onSuccess func([]byte) error, onUnreachable func()) error {
-	var res bytes.Buffer
-	if err := a.ReadAll(fn, id, &res); err != nil {
-		if rerr, ok := err.(lol.RESTError); ok == true {
-			if rerr.Code == http.StatusNotFound {
-				onUnreachable()
-				return nil
+// resumeReplay returns the Replay that was partially recorded through
+// w, with all its available binary data loaded in memory. If w is not
+// also a ReplayDataLoader, or if it does not hold any data yet, a new
+// empty Replay is returned.
+func resumeReplay(w ReplayDataWriter) (*Replay, error) {
+	loader, ok := w.(ReplayDataLoader)
+	if ok == false {
+		return NewEmptyReplay(), nil
+	}
+
+	f, err := loader.Open()
+	if err != nil {
+		if os.IsNotExist(err) == true {
+			return NewEmptyReplay(), nil
+		}
+		return nil, err
+	}
+	f.Close()
+
+	replay, err := loadPartialReplay(loader)
+	if err != nil {
+		return nil, fmt.Errorf("Could not load partially recorded replay: %s", err)
+	}
+
+	if err := replay.loadAvailableData(loader); err != nil {
+		return nil, fmt.Errorf("Could not load partially recorded replay data: %s", err)
+	}
+
+	if len(replay.Chunks) > 0 || len(replay.KeyFrames) > 0 {
+		log.Printf("Resuming recording, %d chunks and %d keyframes already available",
+			len(replay.Chunks), len(replay.KeyFrames))
+	}
+
+	return replay, nil
+}
+
+// a downloadJob is a Chunk or a KeyFrame to download
+type downloadJob struct {
+	function SpectateFunction
+	id       int
+}
+
+// a downloadResult is the outcome of a downloadJob
+type downloadResult struct {
+	downloadJob
+	data []byte
+	err  error
+}
+
+// a pollResult is the outcome of a poll of the game metadata and last
+// chunk information
+type pollResult struct {
+	metadata GameMetadata
+	cInfo    LastChunkInfo
+	// next is the time of the next poll
+	next time.Time
+	err  error
+}
+
+// downloadWorker downloads the jobs it receives until jobs is closed or
+// quit is closed
+func (a *SpectateAPI) downloadWorker(jobs <-chan downloadJob, results chan<- downloadResult, quit <-chan struct{}) {
+	for {
+		select {
+		case <-quit:
+			return
+		case job := <-jobs:
+			var data bytes.Buffer
+			res := downloadResult{downloadJob: job}
+			res.err = a.ReadAll(job.function, job.id, &data)
+			res.data = data.Bytes()
+			select {
+			case results <- res:
+			case <-quit:
+				return
 			}
 		}
-		return err
 	}
+}
+
+const (
+	// maximal time to wait before polling again after a failed
+	// poll
+	maxPollBackoff time.Duration = time.Minute
+	// number of consecutive failed polls after which we give up
+	maxPollFailures int = 10
+)
 
-	return onSuccess(res.Bytes())
+// pollMetadata regularly polls the game metadata and last chunk
+// information, at the rate given by the server, until quit is
+// closed. Failed polls are retried with an increasing delay, the
+// error is only reported after maxPollFailures consecutive failures.
+func (a *SpectateAPI) pollMetadata(polls chan<- pollResult, quit <-chan struct{}) {
+	failures := 0
+	backoff := a.minPollInterval
+	for {
+		res := pollResult{}
+		res.err = a.Get(GetGameMetaData, 1, &res.metadata)
+		if res.err == nil {
+			res.err = a.Get(GetLastChunkInfo, 1, &res.cInfo)
+		}
+
+		if res.err != nil {
+			failures++
+			if failures >= maxPollFailures {
+				select {
+				case polls <- res:
+				case <-quit:
+				}
+				return
+			}
+			log.Printf("Could not poll game metadata: %s. Retrying in %s", res.err, backoff)
+			select {
+			case <-a.clock.After(backoff):
+			case <-quit:
+				return
+			}
+			backoff *= 2
+			if backoff > maxPollBackoff {
+				backoff = maxPollBackoff
+			}
+			continue
+		}
+		failures = 0
+		backoff = a.minPollInterval
+
+		waitTime := res.cInfo.NextAvailableChunk
+		// special case, when player are in the loading screen, the
+		// Spectate API sends invalid chunk ID, so we wait 1 min to
+		// poll it again, (anyway the first valid chunkInfo will make
+		// us wait for the 3 min buffer for a game.
+		if res.cInfo.ID == 0 {
+			log.Printf("Received spurious LastChunkInfo %+v. waiting 1m", res.cInfo)
+			waitTime = 60000 //ms
+		}
+
+		wait := waitTime.Duration()
+		if wait < a.minPollInterval {
+			wait = a.minPollInterval
+		}
+		wait += res.cInfo.Duration.Duration() / 10
+		res.next = a.clock.Now().Add(wait)
+
+		select {
+		case polls <- res:
+		case <-quit:
+			return
+		}
+
+		log.Printf("Waiting until %s", res.next)
+		select {
+		case <-a.clock.After(wait):
+		case <-quit:
+			return
+		}
+	}
+}
+
+// notify reports event to the Observer, if any
+func (a *SpectateAPI) notify(event SpectateEvent) {
+	if a.Observer != nil {
+		a.Observer.Notify(event)
+	}
 }
 
 // SpectateGame is spectating a Game from the SpectateAPI endpoint. It
 // is fetching all data needed to spectate the Replay again and checks
-// for its integrity.
-func (a *SpectateAPI) SpectateGame(encryptionKey string, w ReplayDataWriter) (*Replay, error) {
+// for its integrity. Data is written through w as soon as it is
+// downloaded. If w is also a ReplayDataLoader, any data it already
+// holds (i.e. from a previous recording that was interrupted) is
+// reused and not downloaded again.
+//
+// The game metadata is polled in the background, and new Chunks and
+// KeyFrames are downloaded concurrently by at most
+// MaxParallelDownloads workers. Chunks or KeyFrames that are not
+// available yet, or whose download failed, are retried until they
+// leave the spectator window. If some of them could not be recovered,
+// the incomplete Replay is returned with a MissingDataError. Failed
+// polls of the metadata are retried too.
+//
+// If Observer is not nil, it is notified of the progress of the
+// recording, and of any error that ends it.
+//
+// The recording stops when ctx is cancelled. The metadata and the
+// data downloaded so far are then saved through w, and the partial
+// Replay is returned with ctx.Err(). The recording can be resumed
+// later with the same writer.
+func (a *SpectateAPI) SpectateGame(ctx context.Context, encryptionKey string, w ReplayDataWriter) (*Replay, error) {
+	replay, err := a.spectateGame(ctx, encryptionKey, w)
+	if err != nil {
+		a.notify(ErrorEvent{Err: err})
+	}
+	return replay, err
+}
+
+func (a *SpectateAPI) spectateGame(ctx context.Context, encryptionKey string, w ReplayDataWriter) (*Replay, error) {
 
-	replay := NewEmptyReplay()
+	replay, err := resumeReplay(w)
+	if err != nil {
+		return nil, err
+	}
 
 	//saves the encryption key. We would need this information to
 	//watch the replay again.
 	replay.EncryptionKey = encryptionKey
+	// a previous recording may have missed some data, we try again
+	replay.MissingChunks = nil
+	replay.MissingKeyFrames = nil
 	//Get the version
-	var err error
 	replay.Version, err = a.Version()
 	if err != nil {
 		return nil, err
 	}
 
-	// next should not use a loop, but some kind of Go channel stuff,
-	// but we will be waiting most of the time with a decent
-	// connection.
-	//
+	workers := a.MaxParallelDownloads
+	if workers <= 0 {
+		workers = 1
+	}
+
+	jobs := make(chan downloadJob)
+	results := make(chan downloadResult)
+	polls := make(chan pollResult)
+	quit := make(chan struct{})
+	defer close(quit)
+	pollQuit := make(chan struct{})
+	pollStopped := false
+	stopPolling := func() {
+		if pollStopped == false {
+			close(pollQuit)
+			pollStopped = true
+		}
+	}
+	defer stopPolling()
+
+	for i := 0; i < workers; i++ {
+		go a.downloadWorker(jobs, results, quit)
+	}
+	go a.pollMetadata(polls, pollQuit)
+
 	// We skip chunk 0 and KeyFrame 0, they do not Exists!
 	nextChunkToDownload := ChunkID(1)
 	nextKeyframeToDownload := KeyFrameID(1)
+	// jobs that are not yet sent to a worker
+	queue := []downloadJob{}
+	// jobs that are queued or being downloaded
+	pending := 0
+	endReached := false
+	endGameChunkID := ChunkID(0)
+	// Chunks and KeyFrames the server did not provide yet
+	missing := newMissingData()
+	var lastMetadata GameMetadata
+	finalRound := false
 
-	// Callback when a download of a chunk is successful
-	onSuccessChunkDownload := func(id ChunkID) func([]byte) error {
-		return func(data []byte) error {
-			log.Printf("Downloaded Chunk %d", id)
-			//ensure that the replay will contains the Chunk
-			c := Chunk{
-				ChunkInfo: ChunkInfo{
-					ID: id,
-				},
-			}
-			replay.addChunk(c)
-			cIdx, ok := replay.chunksByID[id]
-			if ok == false {
-				return fmt.Errorf("Internal error, Chunk %d should exists", id)
+	for {
+		if endReached == true && pending == 0 {
+			if finalRound == true {
+				break
 			}
-			//saves the data in the replay
-			replay.Chunks[cIdx].data = data
-			if w != nil {
-				return replay.saveChunk(w, replay.Chunks[cIdx])
+			// gives a last chance to missing data before we stop
+			finalRound = true
+			retries := missing.retries(lastMetadata)
+			if len(retries) == 0 {
+				break
 			}
-			return nil
+			log.Printf("Retrying %d missing Chunk(s) or KeyFrame(s) before the end", len(retries))
+			queue = append(queue, retries...)
+			pending += len(retries)
 		}
-	}
-	onUnreachableChunk := func(id ChunkID) func() {
-		return func() {
-			log.Printf("Skips download of Chunk %d, server returned 404", id)
+
+		var nextJobs chan<- downloadJob
+		var nextJob downloadJob
+		if len(queue) > 0 {
+			nextJobs = jobs
+			nextJob = queue[0]
 		}
-	}
-	// Callback when a download of a keyframe is successful
-	onSuccessKeyFrameDownload := func(id KeyFrameID) func([]byte) error {
-		return func(data []byte) error {
-			log.Printf("Downloaded KeyFrame %d", id)
-			//ensure that the replay will contains the KeyFrame
-			kf := KeyFrame{
-				KeyFrameInfo: KeyFrameInfo{
-					ID: id,
-				},
+
+		select {
+		case <-ctx.Done():
+			log.Printf("Recording interrupted: %s", ctx.Err())
+			if w != nil {
+				if err := replay.unsafeSave(w); err != nil {
+					return nil, err
+				}
 			}
-			replay.addKeyFrame(kf)
-			kfIdx, ok := replay.keyframeByID[id]
-			if ok == false {
-				return fmt.Errorf("Internal error, KeyFrame %d should exists", id)
+			return replay, ctx.Err()
+		case p := <-polls:
+			if p.err != nil {
+				return nil, p.err
 			}
-			//saves the data in the replay
-			replay.KeyFrames[kfIdx].data = data
+			//actually mergin the data
+			replay.MergeFromMetaData(p.metadata)
+			replay.MergeFromLastChunkInfo(p.cInfo)
+			replay.Consolidate()
+			lastMetadata = p.metadata
+			a.notify(MetadataUpdatedEvent{Metadata: p.metadata, LastChunk: p.cInfo})
+
+			//we save the replay we have so far
 			if w != nil {
-				return replay.saveKeyFrame(w, replay.KeyFrames[kfIdx])
+				if err := replay.unsafeSave(w); err != nil {
+					return nil, fmt.Errorf("Could not save replay: %s", err)
+				}
 			}
-			return nil
-		}
-	}
-	onUnreachableKeyFrame := func(id KeyFrameID) func() {
-		return func() {
-			log.Printf("Skips download of KeyFrame %d, server returned HTTP 404", id)
-		}
-	}
-
-	for {
-		// 1. get all current metadata, and merge it in our replay structure
-		var metadata GameMetadata
-		err = a.Get(GetGameMetaData, 1, &metadata)
-		if err != nil {
-			return nil, err
-		}
-
-		var cInfo LastChunkInfo
-		err := a.Get(GetLastChunkInfo, 1, &cInfo)
-		if err != nil {
-			return nil, err
-		}
-
-		// special case, when player are in the loading screen, the
-		// Spectate API sends invalid chunk ID, so we wait 1 min to
-		// poll it again, (anyway the first valid chunkInfo will make
-		// us wait for the 3 min buffer for a game.
-		if cInfo.ID == 0 {
-			log.Printf("Received spurious LastChunkInfo %+v. waiting 1m", cInfo)
-			cInfo.NextAvailableChunk = 60000 //ms
-		}
-
-		// at least wait 1s between loops
-		if cInfo.NextAvailableChunk < 1000 {
-			cInfo.NextAvailableChunk = 1000 //ms
-		}
-
-		nextAvailableChunkDate := time.Now().Add(cInfo.NextAvailableChunk.Duration() + cInfo.Duration.Duration()/10)
-
-		//actually mergin the data
-		replay.MergeFromMetaData(metadata)
-		replay.MergeFromLastChunkInfo(cInfo)
-		replay.Consolidate()
-
-		//we save the replay we have so far
-		if w != nil {
-			//we save the replay
-			replay.unsafeSave(w)
-		}
 
-		// We eagerly fetch all possible chunks and keyframe. Apparently chunks could be
-		// missing. I do not know if they reappears after
-		// sometime. Maybe ask kindly Riot ?
-		for ; nextChunkToDownload <= cInfo.ID; nextChunkToDownload++ {
-			if err := a.readBinary(GetGameDataChunk,
-				int(nextChunkToDownload),
-				onSuccessChunkDownload(nextChunkToDownload),
-				onUnreachableChunk(nextChunkToDownload)); err != nil {
-				return nil, err
+			// Data that was missing is retried, as long as it is
+			// still in the spectator window.
+			retries := missing.retries(p.metadata)
+			queue = append(queue, retries...)
+			pending += len(retries)
+
+			// We eagerly fetch all possible chunks and keyframe.
+			for ; nextChunkToDownload <= p.cInfo.ID; nextChunkToDownload++ {
+				if replay.hasChunkData(nextChunkToDownload) == true {
+					continue
+				}
+				queue = append(queue, downloadJob{GetGameDataChunk, int(nextChunkToDownload)})
+				pending++
+			}
+			for ; nextKeyframeToDownload <= p.cInfo.AssociatedKeyFrameID; nextKeyframeToDownload++ {
+				if replay.hasKeyFrameData(nextKeyframeToDownload) == true {
+					continue
+				}
+				queue = append(queue, downloadJob{GetKeyFrame, int(nextKeyframeToDownload)})
+				pending++
 			}
-		}
 
-		for ; nextKeyframeToDownload <= cInfo.AssociatedKeyFrameID; nextKeyframeToDownload++ {
-			if err := a.readBinary(GetKeyFrame,
-				int(nextKeyframeToDownload),
-				onSuccessKeyFrameDownload(nextKeyframeToDownload),
-				onUnreachableKeyFrame(nextKeyframeToDownload)); err != nil {
+			//checks for end of game
+			if p.cInfo.EndGameChunkID > 0 && nextChunkToDownload > p.cInfo.EndGameChunkID {
+				log.Printf("End of game detected and reached at %d", p.cInfo.EndGameChunkID)
+				endGameChunkID = p.cInfo.EndGameChunkID
+				endReached = true
+				stopPolling()
+				polls = nil
+			} else {
+				a.notify(WaitingEvent{Until: p.next})
+			}
+		case nextJobs <- nextJob:
+			queue = queue[1:]
+		case res := <-results:
+			pending--
+			if isNotFound(res.err) == true {
+				log.Printf("%s %d is not available, server returned HTTP 404. Will retry", res.function, res.id)
+				missing.add(res.downloadJob)
+				continue
+			}
+			if res.err != nil {
+				log.Printf("Could not download %s %d: %s. Will retry", res.function, res.id, res.err)
+				missing.add(res.downloadJob)
+				continue
+			}
+			if err := a.storeDownload(replay, w, res); err != nil {
 				return nil, err
 			}
 		}
+	}
 
-		//checks for end of game
-		if cInfo.EndGameChunkID > 0 && nextChunkToDownload > cInfo.EndGameChunkID {
-			log.Printf("End of game detected and reached at %d", cInfo.EndGameChunkID)
-			break
-		}
+	a.notify(GameEndedEvent{EndGameChunkID: endGameChunkID})
 
-		// wait until the next chunk info is available
-		cTime := time.Now()
-		if cTime.After(nextAvailableChunkDate) == true {
-			continue
-		}
-		log.Printf("Waiting until %s", nextAvailableChunkDate)
-		time.Sleep(nextAvailableChunkDate.Sub(cTime))
+	// Chunks and KeyFrames downloaded after the last poll may not be
+	// described yet, the final metadata describes them.
+	var final GameMetadata
+	if err := a.Get(GetGameMetaData, 1, &final); err != nil {
+		log.Printf("Could not fetch final game metadata: %s", err)
+	} else {
+		replay.MergeFromMetaData(final)
 	}
+	replay.Consolidate()
 
 	// fetching end of game stats
 	var eog bytes.Buffer
@@ -353,6 +590,20 @@ func (a *SpectateAPI) SpectateGame(encryptionKey string, w ReplayDataWriter) (*R
 	}
 	replay.endOfGameStats = eog.Bytes()
 
+	// data that is still missing is lost for good
+	missing.giveUp()
+	if err := missing.err(); err != nil {
+		mErr := err.(MissingDataError)
+		replay.MissingChunks = mErr.Chunks
+		replay.MissingKeyFrames = mErr.KeyFrames
+		if w != nil {
+			if err := replay.unsafeSave(w); err != nil {
+				return nil, fmt.Errorf("Could not save replay: %s", err)
+			}
+		}
+		return replay, err
+	}
+
 	// we check data integrity
 	err = replay.check(nil)
 	if err != nil {
@@ -362,3 +613,55 @@ func (a *SpectateAPI) SpectateGame(encryptionKey string, w ReplayDataWriter) (*R
 	// hourray !
 	return replay, nil
 }
+
+// isNotFound returns true if err is a HTTP 404 error
+func isNotFound(err error) bool {
+	rerr, ok := err.(lol.RESTError)
+	return ok == true && rerr.Code == http.StatusNotFound
+}
+
+// storeDownload adds the downloaded data to the replay, and writes it
+// through w.
+func (a *SpectateAPI) storeDownload(replay *Replay, w ReplayDataWriter, res downloadResult) error {
+	switch res.function {
+	case GetGameDataChunk:
+		id := ChunkID(res.id)
+		log.Printf("Downloaded Chunk %d", id)
+		//ensure that the replay will contains the Chunk
+		replay.addChunk(Chunk{ChunkInfo: ChunkInfo{ID: id}})
+		cIdx, ok := replay.chunksByID[id]
+		if ok == false {
+			return fmt.Errorf("Internal error, Chunk %d should exists", id)
+		}
+		//saves the data in the replay
+		replay.Chunks[cIdx].data = res.data
+		if w != nil {
+			if err := replay.saveChunk(w, replay.Chunks[cIdx]); err != nil {
+				return err
+			}
+		}
+		chunks, _ := replay.dataCount()
+		a.notify(ChunkStoredEvent{ID: id, GameTime: replay.GameTime(id), Chunks: chunks})
+	case GetKeyFrame:
+		id := KeyFrameID(res.id)
+		log.Printf("Downloaded KeyFrame %d", id)
+		//ensure that the replay will contains the KeyFrame
+		replay.addKeyFrame(KeyFrame{KeyFrameInfo: KeyFrameInfo{ID: id}})
+		kfIdx, ok := replay.keyframeByID[id]
+		if ok == false {
+			return fmt.Errorf("Internal error, KeyFrame %d should exists", id)
+		}
+		//saves the data in the replay
+		replay.KeyFrames[kfIdx].data = res.data
+		if w != nil {
+			if err := replay.saveKeyFrame(w, replay.KeyFrames[kfIdx]); err != nil {
+				return err
+			}
+		}
+		_, keyframes := replay.dataCount()
+		a.notify(KeyFrameStoredEvent{ID: id, KeyFrames: keyframes})
+	default:
+		return fmt.Errorf("Internal error, unexpected download of %s", res.function)
+	}
+	return nil
+}
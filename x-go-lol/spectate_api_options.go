@@ -0,0 +1,88 @@
+package xlol
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// A SpectateOption configures a SpectateAPI created by NewSpectateAPI
+type SpectateOption func(a *SpectateAPI) error
+
+// WithHTTPClient makes the SpectateAPI send its requests through
+// client, i.e. to use a proxy or a custom transport. The default is
+// http.DefaultClient.
+func WithHTTPClient(client *http.Client) SpectateOption {
+	return func(a *SpectateAPI) error {
+		if client == nil {
+			return fmt.Errorf("Empty HTTP client")
+		}
+		a.client = client
+		return nil
+	}
+}
+
+// WithBaseURL makes the SpectateAPI query the server at baseURL
+// (i.e. "http://localhost:8088") instead of the spectator server of
+// the region.
+func WithBaseURL(baseURL string) SpectateOption {
+	return func(a *SpectateAPI) error {
+		u, err := url.Parse(baseURL)
+		if err != nil {
+			return fmt.Errorf("Invalid base URL %s: %s", baseURL, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("Invalid base URL %s: unsupported scheme '%s'", baseURL, u.Scheme)
+		}
+		a.baseURL = strings.TrimSuffix(baseURL, "/")
+		return nil
+	}
+}
+
+// WithTimeout sets the time limit of each request made by the
+// SpectateAPI. A zero timeout means no timeout.
+func WithTimeout(timeout time.Duration) SpectateOption {
+	return func(a *SpectateAPI) error {
+		if timeout < 0 {
+			return fmt.Errorf("Invalid negative timeout %s", timeout)
+		}
+		a.timeout = timeout
+		return nil
+	}
+}
+
+// WithMinPollInterval sets the minimal time between two polls of
+// the game metadata by SpectateGame. The default is 1s, only tests
+// against a local server should lower it.
+func WithMinPollInterval(d time.Duration) SpectateOption {
+	return func(a *SpectateAPI) error {
+		if d <= 0 {
+			return fmt.Errorf("Invalid poll interval %s", d)
+		}
+		a.minPollInterval = d
+		return nil
+	}
+}
+
+// WithClock makes SpectateGame use clock to time its polls of the
+// game metadata, instead of SystemClock.
+func WithClock(clock Clock) SpectateOption {
+	return func(a *SpectateAPI) error {
+		if clock == nil {
+			return fmt.Errorf("Empty clock")
+		}
+		a.clock = clock
+		return nil
+	}
+}
+
+// WithUserAgent sets the User-Agent header of each request made by
+// the SpectateAPI.
+func WithUserAgent(userAgent string) SpectateOption {
+	return func(a *SpectateAPI) error {
+		a.userAgent = userAgent
+		return nil
+	}
+}
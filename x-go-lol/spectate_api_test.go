@@ -0,0 +1,139 @@
+package xlol
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atuleu/go-lol"
+	. "gopkg.in/check.v1"
+)
+
+type SpectateAPISuite struct {
+	region *lol.Region
+}
+
+var _ = Suite(&SpectateAPISuite{})
+
+func (s *SpectateAPISuite) SetUpSuite(c *C) {
+	var err error
+	s.region, err = lol.NewRegionByCode("euw")
+	c.Assert(err, IsNil)
+}
+
+func (s *SpectateAPISuite) TestUsesOptions(c *C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != Prefix+string(Version) {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "1.82.89 %s", r.Header.Get("User-Agent"))
+	}))
+	defer server.Close()
+
+	api, err := NewSpectateAPI(s.region, 42,
+		WithBaseURL(server.URL+"/"),
+		WithUserAgent("go-lol-test"),
+		WithTimeout(5*time.Second))
+	c.Assert(err, IsNil)
+	c.Check(api.client, Not(Equals), http.DefaultClient)
+	c.Check(http.DefaultClient.Timeout, Equals, time.Duration(0))
+	c.Check(api.Format(GetKeyFrame, 3), Equals,
+		server.URL+Prefix+"getKeyFrame/EUW1/42/3/token")
+
+	version, err := api.Version()
+	c.Assert(err, IsNil)
+	c.Check(version, Equals, "1.82.89 go-lol-test")
+
+	var data interface{}
+	err = api.Get(GetGameMetaData, 1, &data)
+	c.Check(err, DeepEquals, lol.RESTError{Code: http.StatusNotFound})
+}
+
+func (s *SpectateAPISuite) TestRejectsInvalidOptions(c *C) {
+	for _, o := range []SpectateOption{
+		WithHTTPClient(nil),
+		WithBaseURL("localhost:8088"),
+		WithBaseURL("ftp://localhost"),
+		WithTimeout(-time.Second),
+	} {
+		_, err := NewSpectateAPI(s.region, 42, o)
+		c.Check(err, NotNil)
+	}
+}
+
+// concurrencyCounter proxies the requests to a spectator server, and
+// records the maximal number of Chunks and KeyFrames downloaded at the
+// same time.
+type concurrencyCounter struct {
+	proxy    http.Handler
+	mx       sync.Mutex
+	inFlight int
+	max      int
+}
+
+func (h *concurrencyCounter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.Contains(r.URL.Path, string(GetGameDataChunk)) == false && strings.Contains(r.URL.Path, string(GetKeyFrame)) == false {
+		h.proxy.ServeHTTP(w, r)
+		return
+	}
+	h.mx.Lock()
+	h.inFlight++
+	if h.inFlight > h.max {
+		h.max = h.inFlight
+	}
+	h.mx.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	h.proxy.ServeHTTP(w, r)
+	h.mx.Lock()
+	h.inFlight--
+	h.mx.Unlock()
+}
+
+func (s *SpectateAPISuite) TestLimitsParallelDownloads(c *C) {
+	original := newTestReplay(16, 300)
+	for _, workers := range []int{1, 3} {
+		server, baseURL, closeServer := serveTestReplay(c, original, 10, SystemClock)
+		u, err := url.Parse(baseURL)
+		c.Assert(err, IsNil)
+		counter := &concurrencyCounter{proxy: httputil.NewSingleHostReverseProxy(u)}
+		proxy := httptest.NewServer(counter)
+
+		api := newTestSpectateAPI(c, original, proxy.URL, SystemClock, WithMinPollInterval(10*time.Millisecond))
+		api.MaxParallelDownloads = workers
+		replay, recorded := recordTestReplay(c, api, server.EncryptionKey())
+		checkRecordedReplay(c, original, replay, recorded, server.startStreamChunk)
+		proxy.Close()
+		closeServer()
+
+		// the loading screen is downloaded at once, by all workers
+		c.Check(counter.max, Equals, workers)
+	}
+}
+
+// failingWriter is a ReplayDataWriter that cannot save the replay
+// metadata
+type failingWriter struct {
+	*memoryReplayFormatter
+}
+
+func (w failingWriter) Create() (io.WriteCloser, error) {
+	return nil, fmt.Errorf("disk is full")
+}
+
+func (s *SpectateAPISuite) TestReportsSaveErrors(c *C) {
+	original := newTestReplay(16, 300)
+	server, baseURL, closeServer := serveTestReplay(c, original, 10, SystemClock)
+	defer closeServer()
+
+	api := newTestSpectateAPI(c, original, baseURL, SystemClock, WithMinPollInterval(10*time.Millisecond))
+	_, err := api.SpectateGame(context.Background(), server.EncryptionKey(), failingWriter{newMemoryReplayFormatter()})
+	c.Check(err, ErrorMatches, "Could not save replay: disk is full")
+}
@@ -0,0 +1,85 @@
+package xlol
+
+import "time"
+
+// A SpectateEvent is an event reported to a SpectateObserver while a
+// game is recorded by SpectateAPI.SpectateGame. It is one of
+// MetadataUpdatedEvent, ChunkStoredEvent, KeyFrameStoredEvent,
+// WaitingEvent, GameEndedEvent or ErrorEvent.
+type SpectateEvent interface {
+	isSpectateEvent()
+}
+
+// MetadataUpdatedEvent is reported each time the game metadata is
+// polled
+type MetadataUpdatedEvent struct {
+	Metadata  GameMetadata
+	LastChunk LastChunkInfo
+}
+
+// ChunkStoredEvent is reported when a Chunk is downloaded and written
+type ChunkStoredEvent struct {
+	ID ChunkID
+	// GameTime is the game time at the end of the Chunk
+	GameTime time.Duration
+	// Chunks is the number of Chunks recorded so far
+	Chunks int
+}
+
+// KeyFrameStoredEvent is reported when a KeyFrame is downloaded and
+// written
+type KeyFrameStoredEvent struct {
+	ID KeyFrameID
+	// KeyFrames is the number of KeyFrames recorded so far
+	KeyFrames int
+}
+
+// WaitingEvent is reported when the game metadata will not be polled
+// before Until
+type WaitingEvent struct {
+	Until time.Time
+}
+
+// GameEndedEvent is reported when the end of the game is reached and
+// all its data is downloaded
+type GameEndedEvent struct {
+	EndGameChunkID ChunkID
+}
+
+// ErrorEvent is reported when an error stops the recording
+type ErrorEvent struct {
+	Err error
+}
+
+func (MetadataUpdatedEvent) isSpectateEvent() {}
+func (ChunkStoredEvent) isSpectateEvent()     {}
+func (KeyFrameStoredEvent) isSpectateEvent()  {}
+func (WaitingEvent) isSpectateEvent()         {}
+func (GameEndedEvent) isSpectateEvent()       {}
+func (ErrorEvent) isSpectateEvent()           {}
+
+// A SpectateObserver is notified of the progress of a recording. All
+// events of a recording are notified from the goroutine that called
+// SpectateGame, in order. Notify should not block.
+type SpectateObserver interface {
+	Notify(event SpectateEvent)
+}
+
+// SpectateObserverFunc is a function that implements SpectateObserver
+type SpectateObserverFunc func(event SpectateEvent)
+
+// Notify calls f(event)
+func (f SpectateObserverFunc) Notify(event SpectateEvent) {
+	f(event)
+}
+
+// SpectateEventChannel returns a SpectateObserver that sends events
+// on ch. Events are dropped if ch is not ready to receive them.
+func SpectateEventChannel(ch chan<- SpectateEvent) SpectateObserver {
+	return SpectateObserverFunc(func(event SpectateEvent) {
+		select {
+		case ch <- event:
+		default:
+		}
+	})
+}
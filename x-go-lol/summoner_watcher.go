@@ -0,0 +1,205 @@
+package xlol
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/atuleu/go-lol"
+)
+
+// currentGameGetter is the part of a lol.APIEndpoint used to check
+// if a Summoner is in game
+type currentGameGetter interface {
+	GetCurrentGame(lol.SummonerID) (*lol.CurrentGameInfo, error)
+}
+
+// A SummonerWatcher regularly checks if any of a list of Summoner is
+// in game, and records their games through a ReplayRecorder. A game
+// is only recorded once, even if several watched Summoners are
+// playing it.
+type SummonerWatcher struct {
+	region    *lol.Region
+	api       currentGameGetter
+	recorder  *ReplayRecorder
+	summoners []lol.Summoner
+
+	// games we already started to record, and that are still
+	// played
+	recorded map[lol.GameID]bool
+	// game currently played by a Summoner, if it is recorded
+	playing map[lol.SummonerID]lol.GameID
+
+	// Interval is the time to wait between two checks of all
+	// Summoners
+	Interval time.Duration
+}
+
+const (
+	// maximal number of Summoner names that can be resolved at once
+	maxSummonerByNameRequest = 40
+)
+
+// NewSummonerWatcher creates a new SummonerWatcher for the Summoners
+// names on region. It returns an error if any of the names cannot be
+// found.
+func NewSummonerWatcher(region *lol.Region, api *lol.APIEndpoint, recorder *ReplayRecorder, names []string) (*SummonerWatcher, error) {
+	if api == nil {
+		return nil, fmt.Errorf("Empty API endpoint")
+	}
+	if recorder == nil {
+		return nil, fmt.Errorf("Empty replay recorder")
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("Need at least one Summoner to watch")
+	}
+
+	res := &SummonerWatcher{
+		region:   region,
+		api:      api,
+		recorder: recorder,
+		recorded: make(map[lol.GameID]bool),
+		playing:  make(map[lol.SummonerID]lol.GameID),
+		Interval: 150 * time.Second,
+	}
+
+	missing := make(map[string]string, len(names))
+	for _, n := range names {
+		missing[normalizeSummonerName(n)] = n
+	}
+
+	for start := 0; start < len(names); start += maxSummonerByNameRequest {
+		end := start + maxSummonerByNameRequest
+		if end > len(names) {
+			end = len(names)
+		}
+		summoners, err := api.GetSummonerByName(names[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range summoners {
+			if _, ok := missing[normalizeSummonerName(s.Name)]; ok == false {
+				// duplicated name
+				continue
+			}
+			delete(missing, normalizeSummonerName(s.Name))
+			res.summoners = append(res.summoners, s)
+		}
+	}
+
+	if len(missing) != 0 {
+		notFound := make([]string, 0, len(missing))
+		for _, n := range missing {
+			notFound = append(notFound, n)
+		}
+		return nil, fmt.Errorf("Could not find Summoners '%s'", strings.Join(notFound, "', '"))
+	}
+
+	return res, nil
+}
+
+// Summoners returns the list of watched Summoners
+func (w *SummonerWatcher) Summoners() []lol.Summoner {
+	return w.summoners
+}
+
+// isPlayingRecordedGame returns true if we know that the Summoner is
+// playing a game currently recorded, so we do not need to poll its
+// status
+func (w *SummonerWatcher) isPlayingRecordedGame(id lol.SummonerID) bool {
+	gid, ok := w.playing[id]
+	if ok == false {
+		return false
+	}
+	if w.recorder.IsRecording(w.region, gid) == true {
+		return true
+	}
+	delete(w.playing, id)
+	return false
+}
+
+// markPlaying marks all watched Summoners that plays game
+func (w *SummonerWatcher) markPlaying(game *lol.CurrentGameInfo) {
+	for _, p := range game.Participants {
+		for _, s := range w.summoners {
+			if s.ID == p.ID {
+				w.playing[s.ID] = game.ID
+			}
+		}
+	}
+}
+
+// poll checks once all watched Summoners. Games that are not played
+// by any of them anymore are forgotten.
+func (w *SummonerWatcher) poll(ctx context.Context) {
+	played := make(map[lol.GameID]bool)
+	failed := false
+	for _, s := range w.summoners {
+		if ctx.Err() != nil {
+			return
+		}
+		if w.isPlayingRecordedGame(s.ID) == true {
+			played[w.playing[s.ID]] = true
+			continue
+		}
+
+		game, err := w.api.GetCurrentGame(s.ID)
+		if err != nil {
+			log.Printf("Could not check if %s is in a game: %s", s.Name, err)
+			failed = true
+			continue
+		}
+		if game == nil {
+			continue
+		}
+		played[game.ID] = true
+
+		if w.recorded[game.ID] == true {
+			w.markPlaying(game)
+			continue
+		}
+
+		err = w.recorder.Record(ctx, w.region, *game, s.ID)
+		if err == ErrAlreadyRecording {
+			w.markPlaying(game)
+			continue
+		}
+		if err != nil {
+			log.Printf("Could not record game of %s: %s", s.Name, err)
+			continue
+		}
+		log.Printf("%s is in game, we start to download it", s.Name)
+		w.recorded[game.ID] = true
+		w.markPlaying(game)
+	}
+
+	// we do not know if the games of the Summoners we could not
+	// check have ended
+	if failed == true {
+		return
+	}
+	for id := range w.recorded {
+		if played[id] == false {
+			delete(w.recorded, id)
+		}
+	}
+}
+
+// Watch checks every Interval all watched Summoners, and records any
+// game they are playing. It returns ctx.Err() once ctx is cancelled,
+// the recordings are interrupted too.
+func (w *SummonerWatcher) Watch(ctx context.Context) error {
+	for {
+		w.poll(ctx)
+		log.Printf("Next check for %d summoner(s) in-game status at %s",
+			len(w.summoners),
+			time.Now().Add(w.Interval))
+		select {
+		case <-time.After(w.Interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
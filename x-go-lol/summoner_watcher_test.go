@@ -0,0 +1,102 @@
+package xlol
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/atuleu/go-lol"
+	. "gopkg.in/check.v1"
+)
+
+type SummonerWatcherSuite struct{}
+
+var _ = Suite(&SummonerWatcherSuite{})
+
+// fakeCurrentGames returns the game played by each Summoner
+type fakeCurrentGames struct {
+	mx    sync.Mutex
+	games map[lol.SummonerID]*lol.CurrentGameInfo
+	err   error
+}
+
+func (f *fakeCurrentGames) GetCurrentGame(id lol.SummonerID) (*lol.CurrentGameInfo, error) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	return f.games[id], f.err
+}
+
+func newWatchedGame(c *C, id lol.GameID, players ...lol.SummonerID) *lol.CurrentGameInfo {
+	participants := []string{}
+	for _, p := range players {
+		participants = append(participants, fmt.Sprintf(`{"summonerId":%d}`, p))
+	}
+	res := &lol.CurrentGameInfo{}
+	data := fmt.Sprintf(`{"gameId":%d,"participants":[%s]}`, id, strings.Join(participants, ","))
+	c.Assert(json.Unmarshal([]byte(data), res), IsNil)
+	return res
+}
+
+func (s *SummonerWatcherSuite) TestRecordsGamesOnce(c *C) {
+	region, err := lol.NewRegionByCode("euw")
+	c.Assert(err, IsNil)
+
+	// recordings last until the spectator server is released
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	recorder, err := NewReplayRecorder(NewMemoryReplayManager(), 2)
+	c.Assert(err, IsNil)
+	recorder.SpectateOptions = []SpectateOption{WithBaseURL(server.URL)}
+
+	api := &fakeCurrentGames{
+		games: map[lol.SummonerID]*lol.CurrentGameInfo{
+			1: newWatchedGame(c, 10, 1, 2),
+			2: newWatchedGame(c, 10, 1, 2),
+			3: newWatchedGame(c, 11, 3),
+		},
+	}
+	w := &SummonerWatcher{
+		region:    region,
+		api:       api,
+		recorder:  recorder,
+		summoners: []lol.Summoner{{ID: 1, Name: "One"}, {ID: 2, Name: "Two"}, {ID: 3, Name: "Three"}},
+		recorded:  make(map[lol.GameID]bool),
+		playing:   make(map[lol.SummonerID]lol.GameID),
+	}
+
+	w.poll(context.Background())
+	c.Check(w.recorded, DeepEquals, map[lol.GameID]bool{10: true, 11: true})
+	c.Check(recorder.IsRecording(region, 10), Equals, true)
+	c.Check(recorder.IsRecording(region, 11), Equals, true)
+	close(release)
+	recorder.Wait()
+
+	// games that are still played are not recorded again
+	w.poll(context.Background())
+	c.Check(w.recorded, DeepEquals, map[lol.GameID]bool{10: true, 11: true})
+	c.Check(recorder.IsRecording(region, 10), Equals, false)
+	c.Check(recorder.IsRecording(region, 11), Equals, false)
+
+	// games are forgotten once they ended, unless we could not check
+	api.mx.Lock()
+	api.games[3] = nil
+	api.err = fmt.Errorf("some error")
+	api.mx.Unlock()
+	w.poll(context.Background())
+	c.Check(w.recorded, DeepEquals, map[lol.GameID]bool{10: true, 11: true})
+
+	api.mx.Lock()
+	api.err = nil
+	api.mx.Unlock()
+	w.poll(context.Background())
+	c.Check(w.recorded, DeepEquals, map[lol.GameID]bool{10: true})
+	recorder.Wait()
+}